@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/metal-automata/agent/internal/audit"
+	"github.com/spf13/cobra"
+)
+
+var cmdAudit = &cobra.Command{
+	Use:   "audit",
+	Short: "Query the local audit log of firmware install task, action and step transitions",
+	Run: func(_ *cobra.Command, _ []string) {
+		if err := queryAuditLog(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// audit command
+var (
+	auditPath        string
+	auditServerID    string
+	auditConditionID string
+	auditJSON        bool
+)
+
+func queryAuditLog() error {
+	records, err := audit.Query(auditPath, audit.Filter{ServerID: auditServerID, ConditionID: auditConditionID})
+	if err != nil {
+		return err
+	}
+
+	if auditJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for idx := range records {
+			if err := enc.Encode(&records[idx]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tCONDITION\tSERVER\tKIND\tCOMPONENT\tVERSION\tSTEP\tSTATE\tBMC TASK")
+
+	for idx := range records {
+		r := &records[idx]
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Timestamp.Format(time.RFC3339),
+			r.ConditionID,
+			r.ServerID,
+			r.Kind,
+			r.Component,
+			r.FirmwareVersion,
+			r.Step,
+			r.State,
+			r.BMCTaskID,
+		)
+	}
+
+	return w.Flush()
+}
+
+func init() {
+	cmdAudit.Flags().StringVar(&auditPath, "path", audit.DefaultPath, "The audit log file path, rotated files are included in the query")
+	cmdAudit.Flags().StringVar(&auditServerID, "server-id", "", "List transitions for the server ID")
+	cmdAudit.Flags().StringVar(&auditConditionID, "condition-id", "", "List transitions for the condition ID")
+	cmdAudit.Flags().BoolVar(&auditJSON, "json", false, "Print the audit records as JSON lines")
+
+	rootCmd.AddCommand(cmdAudit)
+}
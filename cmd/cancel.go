@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/metal-automata/agent/internal/ctrl"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var cmdCancel = &cobra.Command{
+	Use:   "cancel",
+	Short: "Cancel a running condition, the condition is stopped once the firmware install step in progress completes",
+	Run: func(_ *cobra.Command, _ []string) {
+		if err := cancelCondition(); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("cancel requested for condition: %s\n", cancelConditionID)
+	},
+}
+
+// cancel command
+var (
+	cancelFacilityCode string
+	cancelConditionID  string
+)
+
+func cancelCondition() error {
+	conditionID, err := uuid.Parse(cancelConditionID)
+	if err != nil {
+		return errors.Wrap(ErrCommandParams, "invalid --condition-id: "+err.Error())
+	}
+
+	conn, js, err := natsJetstream("cancel")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return ctrl.RequestCancel(js, cancelFacilityCode, conditionID)
+}
+
+func init() {
+	addNatsFlags(cmdCancel)
+	cmdCancel.Flags().StringVar(&cancelFacilityCode, "facility-code", "", "The facility code of the agent service running the condition")
+	cmdCancel.Flags().StringVar(&cancelConditionID, "condition-id", "", "The condition ID to cancel")
+
+	for _, flag := range []string{"facility-code", "condition-id"} {
+		if err := cmdCancel.MarkFlagRequired(flag); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	rootCmd.AddCommand(cmdCancel)
+}
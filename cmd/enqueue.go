@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/metal-automata/agent/internal/ctrl"
+	"github.com/metal-automata/agent/internal/model"
+	rctypes "github.com/metal-automata/rivets/condition"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var cmdEnqueue = &cobra.Command{
+	Use:   "enqueue",
+	Short: "Enqueue a condition for the agent service to act on, intended for use with the embedded NATS server",
+	Run: func(_ *cobra.Command, _ []string) {
+		cond, err := enqueueCondition()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("enqueued %s condition: %s, server: %s\n", cond.Kind, cond.ID, cond.Target)
+	},
+}
+
+// NATS connection parameters for the enqueue, cancel commands
+var (
+	natsURL       string
+	natsUser      string
+	natsPass      string
+	natsCredsFile string
+)
+
+// enqueue command
+var (
+	enqueueFacilityCode  string
+	enqueueKind          string
+	enqueueServerID      string
+	enqueueFirmwareSetID string
+	enqueueParamsFile    string
+	enqueueDowngrade     string
+	enqueueRollback      bool
+)
+
+var (
+	ErrCommandParams = errors.New("command parameter error")
+)
+
+func enqueueCondition() (*rctypes.Condition, error) {
+	serverID, err := uuid.Parse(enqueueServerID)
+	if err != nil {
+		return nil, errors.Wrap(ErrCommandParams, "invalid --server-id: "+err.Error())
+	}
+
+	params, err := enqueueParameters(rctypes.Kind(enqueueKind), serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	cond := &rctypes.Condition{
+		Version:    rctypes.ConditionStructVersion,
+		Client:     model.AppName + "-enqueue",
+		ID:         uuid.New(),
+		Target:     serverID,
+		Kind:       rctypes.Kind(enqueueKind),
+		Parameters: params,
+		State:      rctypes.Pending,
+		CreatedAt:  time.Now(),
+	}
+
+	conn, js, err := natsJetstream("enqueue")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := ctrl.EnqueueCondition(js, enqueueFacilityCode, cond); err != nil {
+		return nil, err
+	}
+
+	return cond, nil
+}
+
+// natsJetstream connects to NATS with the NATS connection flag parameters,
+// the returned connection is to be closed by the caller.
+func natsJetstream(client string) (*nats.Conn, nats.JetStreamContext, error) {
+	opts := []nats.Option{nats.Name(model.AppName + "-" + client)}
+	if natsCredsFile != "" {
+		opts = append(opts, nats.UserCredentials(natsCredsFile))
+	} else {
+		opts = append(opts, nats.UserInfo(natsUser, natsPass))
+	}
+
+	conn, err := nats.Connect(natsURL, opts...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "NATS connect error")
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, nil, errors.Wrap(err, "NATS Jetstream context error")
+	}
+
+	return conn, js, nil
+}
+
+// addNatsFlags adds the NATS connection flags to the command, the defaults apply to the embedded NATS server.
+func addNatsFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&natsURL, "nats-url", fmt.Sprintf("nats://127.0.0.1:%d", ctrl.EmbeddedNatsPort), "The NATS server URL")
+	cmd.Flags().StringVar(&natsUser, "nats-user", ctrl.EmbeddedNatsUser, "The NATS user")
+	cmd.Flags().StringVar(&natsPass, "nats-pass", ctrl.EmbeddedNatsPass, "The NATS password")
+	cmd.Flags().StringVar(&natsCredsFile, "nats-creds-file", "", "The NATS creds file, when set the NATS user, password are ignored")
+}
+
+// enqueueParameters returns the condition parameters read from the parameters file,
+// or the default parameters for the condition kind.
+func enqueueParameters(kind rctypes.Kind, serverID uuid.UUID) (json.RawMessage, error) {
+	if enqueueParamsFile != "" {
+		b, err := os.ReadFile(enqueueParamsFile)
+		if err != nil {
+			return nil, errors.Wrap(ErrCommandParams, err.Error())
+		}
+
+		if !json.Valid(b) {
+			return nil, errors.Wrap(ErrCommandParams, "invalid JSON in parameters file: "+enqueueParamsFile)
+		}
+
+		return b, nil
+	}
+
+	switch kind {
+	case rctypes.Inventory:
+		return rctypes.MustDefaultInventoryJSON(serverID), nil
+	case rctypes.FirmwareInstall:
+		params := &rctypes.FirmwareInstallTaskParameters{AssetID: serverID}
+		if enqueueFirmwareSetID != "" {
+			setID, err := uuid.Parse(enqueueFirmwareSetID)
+			if err != nil {
+				return nil, errors.Wrap(ErrCommandParams, "invalid --firmware-set-id: "+err.Error())
+			}
+
+			params.FirmwareSetID = setID
+		}
+
+		return firmwareInstallParameters(params)
+	default:
+		return nil, errors.Wrap(ErrCommandParams, "unsupported condition kind: "+string(kind))
+	}
+}
+
+// firmwareInstallParameters returns the firmware install parameters with the downgrade policy and rollback on failure set,
+// the downgrade_policy and rollback_on_failure attributes are not part of the firmware install task parameters type and so are added here.
+func firmwareInstallParameters(params *rctypes.FirmwareInstallTaskParameters) (json.RawMessage, error) {
+	b, err := json.Marshal(params)
+	if err != nil || (enqueueDowngrade == "" && !enqueueRollback) {
+		return b, err
+	}
+
+	if enqueueDowngrade != "" && !slices.Contains(model.DowngradePolicies(), model.DowngradePolicy(enqueueDowngrade)) {
+		return nil, errors.Wrap(ErrCommandParams, "invalid --downgrade-policy: "+enqueueDowngrade)
+	}
+
+	attrs := map[string]any{}
+	if err := json.Unmarshal(b, &attrs); err != nil {
+		return nil, err
+	}
+
+	if enqueueDowngrade != "" {
+		attrs["downgrade_policy"] = enqueueDowngrade
+	}
+
+	if enqueueRollback {
+		attrs["rollback_on_failure"] = true
+	}
+
+	return json.Marshal(attrs)
+}
+
+func init() {
+	addNatsFlags(cmdEnqueue)
+	cmdEnqueue.Flags().StringVar(&enqueueFacilityCode, "facility-code", "", "The facility code of the agent service to act on the condition")
+	cmdEnqueue.Flags().StringVar(&enqueueKind, "kind", string(rctypes.FirmwareInstall), "The condition kind - firmwareInstall, inventory")
+	cmdEnqueue.Flags().StringVar(&enqueueServerID, "server-id", "", "The server ID the condition is for")
+	cmdEnqueue.Flags().StringVar(&enqueueFirmwareSetID, "firmware-set-id", "", "The firmware set to install, for the firmwareInstall condition")
+	cmdEnqueue.Flags().StringVar(&enqueueDowngrade, "downgrade-policy", "", "The firmware downgrade policy - allow, deny, warn, for the firmwareInstall condition")
+	cmdEnqueue.Flags().BoolVar(&enqueueRollback, "rollback-on-failure", false, "Reinstall the previously installed firmware when the install verification fails, for the firmwareInstall condition")
+	cmdEnqueue.Flags().StringVar(&enqueueParamsFile, "parameters", "", "File with the condition parameters in JSON, overrides the default parameters for the condition kind")
+
+	for _, flag := range []string{"facility-code", "server-id"} {
+		if err := cmdEnqueue.MarkFlagRequired(flag); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	rootCmd.AddCommand(cmdEnqueue)
+}
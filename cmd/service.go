@@ -3,15 +3,28 @@ package cmd
 import (
 	"context"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/equinix-labs/otel-init-go/otelinit"
 	"github.com/google/uuid"
 	"github.com/metal-automata/agent/internal/app"
+	"github.com/metal-automata/agent/internal/audit"
 	"github.com/metal-automata/agent/internal/ctrl"
+	"github.com/metal-automata/agent/internal/device"
+	devinb "github.com/metal-automata/agent/internal/device/inband"
+	devoob "github.com/metal-automata/agent/internal/device/outofband"
+	"github.com/metal-automata/agent/internal/download"
+	"github.com/metal-automata/agent/internal/firmware"
+	"github.com/metal-automata/agent/internal/health"
 	"github.com/metal-automata/agent/internal/metrics"
 	"github.com/metal-automata/agent/internal/model"
 	"github.com/metal-automata/agent/internal/service"
 	"github.com/metal-automata/agent/internal/store"
+	"github.com/metal-automata/agent/internal/version"
 
 	rctypes "github.com/metal-automata/rivets/condition"
 	"github.com/pkg/errors"
@@ -39,13 +52,18 @@ var cmdRun = &cobra.Command{
 
 // run worker command
 var (
-	dryrun         bool
-	runsInband     bool
-	runsOutofband  bool
-	faultInjection bool
-	facilityCode   string
-	storeKind      string
-	inbandServerID string
+	dryrun           bool
+	runsInband       bool
+	runsOutofband    bool
+	faultInjection   bool
+	facilityCode     string
+	storeKind        string
+	inbandServerID   string
+	embeddedNats     bool
+	embeddedNatsPort int
+	inbandDaemon     bool
+	statusAddress    string
+	drainAddress     string
 )
 
 var (
@@ -65,21 +83,17 @@ func runHandler(ctx context.Context, mode model.RunMode) {
 		log.Fatal(err)
 	}
 
-	// serve metrics endpoint
-	metrics.ListenAndServe()
+	// serve metrics, health endpoints
+	http.Handle("/healthz", health.LivenessHandler())
+	version.ExportBuildInfoMetric(metrics.Registry)
+	metrics.ListenAndServe(agent.Config.ListenAddress)
 
 	ctx, otelShutdown := otelinit.InitOpenTelemetry(ctx, "agent-"+string(mode))
 	defer otelShutdown(ctx)
 
 	// Setup cancel context with cancel func.
 	ctx, cancelFunc := context.WithCancel(ctx)
-
-	// routine listens for termination signal and cancels the context
-	go func() {
-		<-termCh
-		agent.Logger.Info("got TERM signal, exiting...")
-		cancelFunc()
-	}()
+	defer cancelFunc()
 
 	repository, err := initStore(ctx, agent.Config, agent.Logger)
 	if err != nil {
@@ -90,22 +104,58 @@ func runHandler(ctx context.Context, mode model.RunMode) {
 		agent.Logger.Fatal("--facility-code parameter required")
 	}
 
+	purgeStagingDirs(agent.Config, agent.Logger)
+
 	switch mode {
 	case model.RunInband:
+		// routine listens for termination signal and cancels the context
+		go func() {
+			<-termCh
+			agent.Logger.Info("got TERM signal, exiting...")
+			cancelFunc()
+		}()
+
 		runInband(ctx, agent, repository)
 		return
 	case model.RunOutofband:
-		runOutofband(ctx, agent, repository)
+		runOutofband(ctx, cancelFunc, termCh, agent, repository)
 		return
 	default:
 		agent.Logger.Fatal("unsupported run mode: " + mode)
 	}
 }
 
-func runOutofband(ctx context.Context, agent *app.App, repository store.Repository) {
-	natsCfg, err := agent.NatsParams()
-	if err != nil {
-		agent.Logger.Fatal(err)
+func runOutofband(ctx context.Context, cancelFunc context.CancelFunc, termCh <-chan os.Signal, agent *app.App, repository store.Repository) {
+	var natsCfg app.NatsConfig
+	if embeddedNats {
+		srv, err := ctrl.StartEmbeddedNats(embeddedNatsPort, model.ConditionKinds())
+		if err != nil {
+			agent.Logger.Fatal(err)
+		}
+
+		defer srv.Shutdown()
+
+		agent.Logger.WithField("url", srv.URL()).Info("embedded NATS server running")
+		natsCfg = app.EmbeddedNatsParams(srv.URL(), ctrl.EmbeddedNatsUser, ctrl.EmbeddedNatsPass)
+	} else {
+		var err error
+		natsCfg, err = agent.NatsParams()
+		if err != nil {
+			agent.Logger.Fatal(err)
+		}
+	}
+
+	ncOptions := []ctrl.Option{
+		ctrl.WithConcurrency(agent.Config.Concurrency),
+		ctrl.WithKVReplicas(natsCfg.KVReplicas),
+		ctrl.WithLogger(agent.Logger),
+		ctrl.WithConnectionTimeout(natsCfg.ConnectTimeout),
+		ctrl.WithStreamUserPass(natsCfg.StreamUser, natsCfg.StreamPass),
+		ctrl.WithKindLimits(kindLimits(agent.Config)),
+	}
+
+	if agent.Config.DrainTimeout != 0 {
+		ncOptions = append(ncOptions, ctrl.WithDrainTimeout(agent.Config.DrainTimeout))
 	}
 
 	nc := ctrl.NewNatsController(
@@ -114,26 +164,132 @@ func runOutofband(ctx context.Context, agent *app.App, repository store.Reposito
 		natsCfg.NatsURL,
 		natsCfg.CredsFile,
 		model.ConditionKinds(),
-		ctrl.WithConcurrency(agent.Config.Concurrency),
-		ctrl.WithKVReplicas(natsCfg.KVReplicas),
-		ctrl.WithLogger(agent.Logger),
-		ctrl.WithConnectionTimeout(natsCfg.ConnectTimeout),
+		ncOptions...,
 	)
 
 	if err := nc.Connect(ctx); err != nil {
 		agent.Logger.Fatal(err)
 	}
 
+	drainOnSignal(cancelFunc, termCh, nc, agent.Logger)
+
+	serveReadiness(repository, map[string]health.Check{
+		"nats": func(context.Context) error { return nc.Ready() },
+	})
+	http.Handle("/status", nc.StatusHandler())
+
+	firmwareCache, err := initFirmwareCache(agent.Config, agent.Logger)
+	if err != nil {
+		agent.Logger.Fatal(err)
+	}
+
+	verifier, err := initSignatureVerifier(agent.Config, agent.Logger)
+	if err != nil {
+		agent.Logger.Fatal(err)
+	}
+
+	uploadLimiter, err := initUploadLimiter(agent.Config)
+	if err != nil {
+		agent.Logger.Fatal(err)
+	}
+
+	auditLog, err := initAuditLog(agent.Config, agent.Logger)
+	if err != nil {
+		agent.Logger.Fatal(err)
+	}
+
 	service.RunOutofband(
 		ctx,
 		dryrun,
 		faultInjection,
 		repository,
+		[]firmware.Option{
+			firmware.WithFirmwareCache(firmwareCache),
+			firmware.WithSignatureVerifier(verifier),
+			firmware.WithDownloadTimeout(agent.Config.DownloadTimeout),
+			firmware.WithDownloadDir(agent.Config.DownloadDir),
+			firmware.WithBucketCredentials(bucketCredentials(agent.Config)),
+			firmware.WithUploadLimiter(uploadLimiter),
+			firmware.WithAuditLog(auditLog),
+			firmware.WithActionConcurrency(agent.Config.ActionConcurrency),
+			firmware.WithInstallRules(agent.Config.InstallRules),
+		},
 		nc,
 		agent.Logger,
 	)
 }
 
+// drainOnSignal drains the controller on a termination signal, a SIGUSR1 signal or a POST request to the /drain endpoint when enabled,
+// the service exits once the in-flight conditions are completed.
+//
+// While draining, an interrupt signal cancels the in-flight conditions, other termination signals are ignored.
+func drainOnSignal(cancelFunc context.CancelFunc, termCh <-chan os.Signal, nc *ctrl.NatsController, logger *logrus.Logger) {
+	drainSigCh := make(chan os.Signal, 1)
+	signal.Notify(drainSigCh, syscall.SIGUSR1)
+
+	drainReqCh := make(chan struct{}, 1)
+	if drainAddress != "" {
+		serveDrain(drainReqCh, logger)
+	}
+
+	go func() {
+		select {
+		case sig := <-termCh:
+			logger.WithField("signal", sig.String()).Info("got TERM signal, draining...")
+		case <-drainSigCh:
+			logger.Info("got SIGUSR1 signal, draining...")
+		case <-drainReqCh:
+			logger.Info("got drain request, draining...")
+		}
+
+		nc.Drain()
+
+		for sig := range termCh {
+			if sig == os.Interrupt {
+				logger.Info("got interrupt signal while draining, exiting...")
+				cancelFunc()
+
+				return
+			}
+
+			logger.WithField("signal", sig.String()).Info("draining in progress, ignoring signal")
+		}
+	}()
+}
+
+// serveDrain serves the drain endpoint on the drain address, a POST request to the endpoint is sent on the drain request channel.
+//
+// The endpoint is not authenticated and so is served on its own listener, which defaults to the loopback address.
+func serveDrain(drainReqCh chan<- struct{}, logger *logrus.Logger) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/drain", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		select {
+		case drainReqCh <- struct{}{}:
+		default:
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	server := &http.Server{
+		Addr:              drainAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+
+	go func() {
+		logger.WithField("address", drainAddress).Info("serving drain endpoint")
+		if err := server.ListenAndServe(); err != nil {
+			logger.WithError(err).Error("drain endpoint error")
+		}
+	}()
+}
+
 func runInband(ctx context.Context, agent *app.App, repository store.Repository) {
 	cfgOrcAPI := agent.Config.OrchestratorAPIParams
 	orcConfig := &ctrl.OrchestratorAPIConfig{
@@ -158,33 +314,220 @@ func runInband(ctx context.Context, agent *app.App, repository store.Repository)
 		agent.Logger.Fatal(err)
 	}
 
+	serveReadiness(repository, nil)
+
+	if inbandDaemon {
+		serveInbandStatus(nc, agent.Logger)
+	}
+
+	verifier, err := initSignatureVerifier(agent.Config, agent.Logger)
+	if err != nil {
+		agent.Logger.Fatal(err)
+	}
+
+	rebooter, err := initRebootCoordinator(agent.Config, agent.Logger)
+	if err != nil {
+		agent.Logger.Fatal(err)
+	}
+
+	auditLog, err := initAuditLog(agent.Config, agent.Logger)
+	if err != nil {
+		agent.Logger.Fatal(err)
+	}
+
 	service.RunInband(
 		ctx,
 		dryrun,
 		faultInjection,
+		inbandDaemon,
 		facilityCode,
 		repository,
+		[]firmware.Option{
+			firmware.WithSignatureVerifier(verifier),
+			firmware.WithDownloadTimeout(agent.Config.DownloadTimeout),
+			firmware.WithDownloadDir(agent.Config.DownloadDir),
+			firmware.WithBucketCredentials(bucketCredentials(agent.Config)),
+			firmware.WithAuditLog(auditLog),
+			firmware.WithInstallRules(agent.Config.InstallRules),
+		},
 		nc,
+		rebooter,
 		agent.Logger,
 	)
 }
 
+// initRebootCoordinator returns the coordinator the inband agent hands off host reboots to.
+func initRebootCoordinator(config *app.Configuration, logger *logrus.Logger) (device.RebootCoordinator, error) {
+	opts := config.Reboot
+	if opts == nil {
+		opts = &app.RebootOptions{}
+	}
+
+	return devinb.NewRebootCoordinator(
+		devinb.RebootKind(opts.Kind),
+		&devinb.RebootOptions{
+			FlagFile:     opts.FlagFile,
+			SystemdDBus:  opts.SystemdDBus,
+			KexecKernel:  opts.KexecKernel,
+			KexecInitrd:  opts.KexecInitrd,
+			KexecCmdline: opts.KexecCmdline,
+		},
+		logger,
+	)
+}
+
+// serveReadiness registers the readiness endpoint on the metrics listener,
+// the service is ready when the store is reachable and the given checks pass.
+func serveReadiness(repository store.Repository, checks map[string]health.Check) {
+	if checks == nil {
+		checks = map[string]health.Check{}
+	}
+
+	checks["store"] = repository.Ping
+
+	http.Handle("/readyz", health.ReadinessHandler(checks))
+}
+
+// serveInbandStatus serves the inband daemon status endpoint on the status address.
+func serveInbandStatus(nc *ctrl.HTTPController, logger *logrus.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/status", nc.StatusHandler())
+
+	server := &http.Server{
+		Addr:              statusAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+
+	go func() {
+		logger.WithField("address", statusAddress).Info("serving inband status endpoint")
+		if err := server.ListenAndServe(); err != nil {
+			logger.WithError(err).Error("inband status endpoint error")
+		}
+	}()
+}
+
 func initStore(ctx context.Context, config *app.Configuration, logger *logrus.Logger) (store.Repository, error) {
-	if storeKind == string(model.InventoryStoreServerservice) {
+	switch model.StoreKind(storeKind) {
+	case model.InventoryStoreServerservice:
 		return store.NewServerserviceStore(ctx, config.FleetDBAPIOptions, logger)
+	case model.InventoryStoreYAML:
+		return store.NewYamlStore(ctx, config.YamlStoreOptions, logger)
 	}
 
 	return nil, errors.Wrap(ErrInventoryStore, "expected a valid inventory store parameter")
 }
 
+// purgeStagingDirs removes firmware download directories left behind by a previous run of the service.
+func purgeStagingDirs(config *app.Configuration, logger *logrus.Logger) {
+	removed, err := download.PurgeStagingDirs(config.DownloadDir, config.DownloadTimeout)
+	if err != nil {
+		logger.WithError(err).Warn("error purging firmware download directories")
+	}
+
+	for _, dir := range removed {
+		logger.WithField("dir", dir).Info("purged firmware download directory left behind by a previous run")
+	}
+}
+
+// initFirmwareCache returns the firmware cache when a cache directory is configured.
+func initFirmwareCache(config *app.Configuration, logger *logrus.Logger) (*download.Cache, error) {
+	if config.FirmwareCache == nil || config.FirmwareCache.Dir == "" {
+		return nil, nil // nolint:nilnil // the firmware cache is optional
+	}
+
+	return download.NewCache(config.FirmwareCache.Dir, config.FirmwareCache.MaxSizeBytes, logger)
+}
+
+// initSignatureVerifier returns the firmware signature verifier for the configured signature policy.
+func initSignatureVerifier(config *app.Configuration, logger *logrus.Logger) (*download.SignatureVerifier, error) {
+	if config.FirmwareSignature == nil {
+		return download.NewSignatureVerifier(download.SignaturePolicyDisabled, "", "", logger)
+	}
+
+	return download.NewSignatureVerifier(
+		download.SignaturePolicy(config.FirmwareSignature.Policy),
+		config.FirmwareSignature.TrustStore,
+		config.FirmwareSignature.SignatureURLSuffix,
+		logger,
+	)
+}
+
+// kindLimits returns the controller concurrency, handler timeout limits by condition kind.
+func kindLimits(config *app.Configuration) map[rctypes.Kind]ctrl.KindLimits {
+	limits := make(map[rctypes.Kind]ctrl.KindLimits, len(config.ConditionLimits))
+	for kind, kindLimits := range config.ConditionLimits {
+		limits[rctypes.Kind(kind)] = ctrl.KindLimits{
+			Concurrency:    kindLimits.Concurrency,
+			HandlerTimeout: kindLimits.HandlerTimeout,
+		}
+	}
+
+	return limits
+}
+
+// initUploadLimiter returns the firmware upload limiter when upload limits are configured.
+func initUploadLimiter(config *app.Configuration) (*devoob.UploadLimiter, error) {
+	limits := config.UploadLimits
+	if limits == nil || (limits.SubnetConcurrency == 0 && limits.BMCConcurrency == 0) {
+		return nil, nil
+	}
+
+	return devoob.NewUploadLimiter(limits.SubnetConcurrency, limits.BMCConcurrency, limits.Subnets)
+}
+
+// initAuditLog returns the audit log when an audit log path is configured.
+func initAuditLog(config *app.Configuration, logger *logrus.Logger) (*audit.Log, error) {
+	opts := config.AuditLog
+	if opts == nil || opts.Path == "" {
+		return nil, nil // nolint:nilnil // the audit log is optional
+	}
+
+	auditLog, err := audit.New(opts.Path, opts.MaxSizeBytes, opts.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.WithField("path", opts.Path).Info("recording firmware install transitions to audit log")
+
+	return auditLog, nil
+}
+
+// bucketCredentials returns the credentials to download firmware from object storage URLs.
+func bucketCredentials(config *app.Configuration) *download.BucketCredentials {
+	creds := &download.BucketCredentials{}
+	if config.ObjectStorage == nil {
+		return creds
+	}
+
+	if s3 := config.ObjectStorage.S3; s3 != nil {
+		creds.S3Region = s3.Region
+		creds.S3Endpoint = s3.Endpoint
+		creds.S3AccessKeyID = s3.AccessKeyID
+		creds.S3SecretAccessKey = s3.SecretAccessKey
+		creds.S3UsePathStyle = s3.UsePathStyle
+	}
+
+	if gcs := config.ObjectStorage.GCS; gcs != nil {
+		creds.GCSCredentialsFile = gcs.CredentialsFile
+	}
+
+	return creds
+}
+
 func init() {
-	cmdRun.PersistentFlags().StringVar(&storeKind, "store", "", "Inventory store to lookup devices for update - fleetdb.")
+	cmdRun.PersistentFlags().StringVar(&storeKind, "store", "", "Inventory store to lookup devices for update - serverservice, yaml.")
 	cmdRun.PersistentFlags().StringVar(&inbandServerID, "server-id", "", "ServerID when running inband")
 	cmdRun.PersistentFlags().BoolVarP(&dryrun, "dry-run", "", false, "In dryrun mode, the agent actions the task without installing firmware")
 	cmdRun.PersistentFlags().BoolVarP(&runsInband, "inband", "", false, "Runs agent service in inband firmware mode (expects to run on the target device)")
 	cmdRun.PersistentFlags().BoolVarP(&runsOutofband, "outofband", "", false, "Runs service in out-of-band mode (target host is remote)")
 	cmdRun.PersistentFlags().BoolVarP(&faultInjection, "fault-injection", "", false, "Tasks can include a Fault attribute to allow fault injection for development purposes")
 	cmdRun.PersistentFlags().StringVar(&facilityCode, "facility-code", "", "The facility code this agent instance is associated with")
+	cmdRun.PersistentFlags().BoolVarP(&embeddedNats, "embedded-nats", "", false, "Runs an in-process NATS Jetstream server for local development, the nats configuration parameters are ignored")
+	cmdRun.PersistentFlags().BoolVarP(&inbandDaemon, "daemon", "", false, "Keeps the inband agent running to handle successive conditions, resuming tasks after a host power cycle")
+	cmdRun.PersistentFlags().StringVar(&statusAddress, "status-address", "127.0.0.1:9092", "The address the inband daemon status endpoint listens on")
+	cmdRun.PersistentFlags().StringVar(&drainAddress, "drain-address", "127.0.0.1:9093", "The address the outofband service drain endpoint listens on, the endpoint is disabled when set to an empty value")
+	cmdRun.PersistentFlags().IntVar(&embeddedNatsPort, "embedded-nats-port", ctrl.EmbeddedNatsPort, "The port the embedded NATS server listens on")
 
 	if err := cmdRun.MarkPersistentFlagRequired("store"); err != nil {
 		log.Fatal(err)
@@ -192,6 +535,8 @@ func init() {
 
 	cmdRun.MarkFlagsMutuallyExclusive("inband", "outofband")
 	cmdRun.MarkFlagsOneRequired("inband", "outofband")
+	cmdRun.MarkFlagsMutuallyExclusive("inband", "embedded-nats")
+	cmdRun.MarkFlagsMutuallyExclusive("outofband", "daemon")
 
 	rootCmd.AddCommand(cmdRun)
 }
@@ -19,6 +19,18 @@ Agent plans and executes an **Action** for each firmware to be installed within
 ## Steps
 A **Step** is the smallest unit of work carried out by agent as part of an **Action**.
 
+## BMC simulator
+The out of band install is tested end-to-end against a simulated Redfish BMC in
+[internal/device/outofband/simulator](../internal/device/outofband/simulator), no hardware is required.
+
+The simulator is served by an in-process TLS server which identifies as an OpenBMC device,
+the outofband device queryor is directed to it with the \`outofband.WithDialContext(sim.DialContext)\` option.
+It supports sessions, host power state, inventory, multipart firmware uploads and install tasks
+which transition from \`New\` to \`Running\` to \`Completed\`, along with BMC resets.
+
+Failures are injected with the simulator options - \`WithLoginFailures\`, \`WithTaskStuck\`, \`WithTaskFailed\`,
+and active sessions are invalidated with \`ExpireSessions()\`.
+
 ## Flow diagram
 
 The diagram below depicts a flow diagram for a agent **Task** to install one firmware.
@@ -77,11 +77,11 @@ func New(appKind model.AppKind, storeKind model.StoreKind, cfgFile, loglevel str
 	termCh := make(chan os.Signal, 1)
 	signal.Notify(termCh, syscall.SIGINT, syscall.SIGTERM)
 
-	if profiling {
-		enableProfilingEndpoint()
-	}
-
 	if appKind == model.AppKindCLI {
+		if profiling {
+			enableProfilingEndpoint(ProfilingEndpoint)
+		}
+
 		runtimeFormatter.ChildFormatter = &logrus.TextFormatter{}
 		return app, termCh, nil
 	}
@@ -90,14 +90,18 @@ func New(appKind model.AppKind, storeKind model.StoreKind, cfgFile, loglevel str
 		return nil, nil, err
 	}
 
+	if profiling {
+		enableProfilingEndpoint(app.Config.ProfilingAddress)
+	}
+
 	return app, termCh, nil
 }
 
-// enableProfilingEndpoint enables the profiling endpoint
-func enableProfilingEndpoint() {
+// enableProfilingEndpoint enables the profiling endpoint on the given address
+func enableProfilingEndpoint(address string) {
 	go func() {
 		server := &http.Server{
-			Addr:              ProfilingEndpoint,
+			Addr:              address,
 			ReadHeaderTimeout: 2 * time.Second, // nolint:gomnd // time duration value is clear as is.
 		}
 
@@ -106,5 +110,5 @@ func enableProfilingEndpoint() {
 		}
 	}()
 
-	log.Println("profiling enabled: " + ProfilingEndpoint + "/debug/pprof")
+	log.Println("profiling enabled: " + address + "/debug/pprof")
 }
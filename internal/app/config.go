@@ -3,12 +3,15 @@ package app
 import (
 	"net/url"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jeremywohl/flatten"
+	"github.com/metal-automata/agent/internal/metrics"
 	"github.com/metal-automata/agent/internal/model"
+	rctypes "github.com/metal-automata/rivets/condition"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 )
@@ -36,6 +39,20 @@ type Configuration struct {
 	// Worker configuration
 	Concurrency int `mapstructure:"concurrency"`
 
+	// ConditionLimits sets the concurrency and handler timeout by condition kind,
+	// kinds not listed here are limited by the Concurrency parameter and the default handler timeout.
+	ConditionLimits map[string]*ConditionLimits `mapstructure:"condition_limits"`
+
+	// ListenAddress is the address the metrics, health, readiness and status endpoints listen on - defaults to 0.0.0.0:9090.
+	ListenAddress string `mapstructure:"listen_address"`
+
+	// ProfilingAddress is the address the pprof endpoint listens on when enabled - defaults to localhost:9091.
+	ProfilingAddress string `mapstructure:"profiling_address"`
+
+	// DrainTimeout is the time to wait on in-flight conditions to complete when the service is draining - defaults to 60m,
+	// after which the in-flight conditions are canceled.
+	DrainTimeout time.Duration `mapstructure:"drain_timeout"`
+
 	// FacilityCode limits this agent to events in a facility.
 	FacilityCode string `mapstructure:"facility_code"`
 
@@ -49,6 +66,55 @@ type Configuration struct {
 	// This parameter is required when StoreKind is set to serverservice.
 	FleetDBAPIOptions *FleetDBAPIOptions `mapstructure:"serverservice"`
 
+	// YamlStoreOptions defines the yaml inventory store parameters
+	//
+	// This parameter is required when StoreKind is set to yaml.
+	YamlStoreOptions *YamlStoreOptions `mapstructure:"yaml"`
+
+	// FirmwareCache defines the local firmware file cache parameters
+	//
+	// When a cache directory is not defined, firmware files are downloaded for each install.
+	FirmwareCache *FirmwareCacheOptions `mapstructure:"firmware_cache"`
+
+	// DownloadDir is the directory firmware files are staged in before install - defaults to the system temp directory.
+	//
+	// This is expected to be on a disk backed filesystem with room for the largest firmware file.
+	DownloadDir string `mapstructure:"download_dir"`
+
+	// DownloadTimeout is the timeout for each firmware download attempt, interrupted downloads are resumed.
+	DownloadTimeout time.Duration `mapstructure:"download_timeout"`
+
+	// UploadLimits defines the limits for concurrent out-of-band firmware uploads
+	//
+	// When not defined, firmware uploads are not limited.
+	UploadLimits *UploadLimitsOptions `mapstructure:"upload_limits"`
+
+	// ActionConcurrency is the number of independent firmware install actions of a task run concurrently - defaults to 1,
+	// actions for components that interrupt other installs, like the BMC or BIOS, are always run on their own.
+	ActionConcurrency int `mapstructure:"action_concurrency"`
+
+	// InstallRules lists the firmware install ordering and dependency rules, limited by server vendor and models,
+	// the install order listed in the firmware set attributes takes precedence over the configured install order.
+	InstallRules []*model.InstallRules `mapstructure:"install_rules"`
+
+	// FirmwareSignature defines the firmware file signature verification parameters
+	FirmwareSignature *FirmwareSignatureOptions `mapstructure:"firmware_signature"`
+
+	// ObjectStorage defines the credentials to download firmware from s3:// and gs:// URLs
+	//
+	// When not defined, the default credential chain of the cloud provider applies.
+	ObjectStorage *ObjectStorageOptions `mapstructure:"object_storage"`
+
+	// Reboot defines how the inband agent reboots the host when a firmware install requires a power cycle
+	//
+	// When not defined, the reboot flag file is created for the host image to act on.
+	Reboot *RebootOptions `mapstructure:"reboot"`
+
+	// AuditLog defines the local audit log the firmware install task, action and step transitions are recorded to
+	//
+	// When not defined, transitions are not recorded.
+	AuditLog *AuditLogOptions `mapstructure:"audit_log"`
+
 	// ServerID parameter required for inband run mode
 	ServerID string `mapstructure:"serverid"`
 
@@ -56,6 +122,15 @@ type Configuration struct {
 	OrchestratorAPIParams *OrchestratorAPIParams `mapstructure:"orchestrator_api"`
 }
 
+// ConditionLimits defines the limits for conditions of a kind.
+type ConditionLimits struct {
+	// Concurrency is the number of conditions of the kind handled concurrently.
+	Concurrency int `mapstructure:"concurrency"`
+
+	// HandlerTimeout is the time after which the condition handler is canceled.
+	HandlerTimeout time.Duration `mapstructure:"handler_timeout"`
+}
+
 // FleetDBAPIOptions defines configuration for the FleetDBAPI client.
 // https://github.com/metal-automata/hollow-serverservice
 type FleetDBAPIOptions struct {
@@ -74,6 +149,106 @@ type FleetDBAPIOptions struct {
 	DisableOAuth           bool     `mapstructure:"disable_oauth"`
 }
 
+// YamlStoreOptions defines configuration for the file backed inventory store.
+type YamlStoreOptions struct {
+	// InventoryFile is the path to the YAML file with the server, BMC credential and firmware set records,
+	// component inventory collected by the agent is written back to this file.
+	InventoryFile string `mapstructure:"inventory_file"`
+}
+
+// FirmwareCacheOptions defines configuration for the local firmware file cache.
+type FirmwareCacheOptions struct {
+	// Dir is the directory firmware files are cached in.
+	Dir string `mapstructure:"dir"`
+
+	// MaxSizeBytes is the size limit of the cache, once exceeded the least recently used files are evicted,
+	// the limit is disabled when set to 0.
+	MaxSizeBytes int64 `mapstructure:"max_size_bytes"`
+}
+
+// RebootOptions defines configuration for the inband host reboot coordinator.
+type RebootOptions struct {
+	// Kind is the reboot coordinator - one of flagfile, systemd, kexec, noop.
+	Kind string `mapstructure:"kind"`
+
+	// FlagFile is the reboot flag file path for the flagfile coordinator, defaults to /var/run/reboot.
+	FlagFile string `mapstructure:"flag_file"`
+
+	// SystemdDBus has the systemd coordinator request the reboot through the logind D-Bus API instead of systemctl.
+	SystemdDBus bool `mapstructure:"systemd_dbus"`
+
+	// KexecKernel, KexecInitrd, KexecCmdline are loaded by the kexec coordinator,
+	// when the kernel is not set, the kernel previously loaded with kexec -l is booted.
+	KexecKernel  string `mapstructure:"kexec_kernel"`
+	KexecInitrd  string `mapstructure:"kexec_initrd"`
+	KexecCmdline string `mapstructure:"kexec_cmdline"`
+}
+
+// AuditLogOptions defines configuration for the local audit log.
+type AuditLogOptions struct {
+	// Path is the audit log file path, the audit log is disabled when not set.
+	Path string `mapstructure:"path"`
+
+	// MaxSizeBytes is the size the audit log file is rotated at, defaults to 100MB.
+	MaxSizeBytes int64 `mapstructure:"max_size_bytes"`
+
+	// MaxBackups is the number of rotated audit log files kept, defaults to 10.
+	MaxBackups int `mapstructure:"max_backups"`
+}
+
+// UploadLimitsOptions defines configuration for the limits on concurrent firmware uploads to BMCs.
+type UploadLimitsOptions struct {
+	// SubnetConcurrency is the number of concurrent firmware uploads to BMCs in a subnet,
+	// the limit is disabled when set to 0.
+	SubnetConcurrency int `mapstructure:"subnet_concurrency"`
+
+	// Subnets are the CIDRs BMCs are grouped by for the subnet limit,
+	// BMCs not in these subnets are grouped by their /24 subnet.
+	Subnets []string `mapstructure:"subnets"`
+
+	// BMCConcurrency is the number of concurrent firmware uploads to a BMC or chassis controller address,
+	// the limit is disabled when set to 0.
+	BMCConcurrency int `mapstructure:"bmc_concurrency"`
+}
+
+// FirmwareSignatureOptions defines configuration for the verification of detached firmware file signatures.
+type FirmwareSignatureOptions struct {
+	// Policy is one of disabled, warn, enforce - defaults to disabled.
+	Policy string `mapstructure:"policy"`
+
+	// TrustStore is the path to the file listing the trusted ed25519 or minisign public keys.
+	TrustStore string `mapstructure:"trust_store"`
+
+	// SignatureURLSuffix is appended to the firmware URL to fetch its signature - defaults to .sig
+	SignatureURLSuffix string `mapstructure:"signature_url_suffix"`
+}
+
+// ObjectStorageOptions defines configuration for the object storage buckets firmware files are downloaded from.
+type ObjectStorageOptions struct {
+	S3  *S3Options  `mapstructure:"s3"`
+	GCS *GCSOptions `mapstructure:"gcs"`
+}
+
+// S3Options defines configuration for firmware downloads from s3:// URLs.
+type S3Options struct {
+	// Region is the default bucket region, a region query parameter in the firmware URL takes precedence.
+	Region string `mapstructure:"region"`
+
+	// Endpoint is the endpoint URL for S3 compatible object stores.
+	Endpoint        string `mapstructure:"endpoint"`
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+
+	// UsePathStyle enables path style bucket addressing, required by most S3 compatible object stores.
+	UsePathStyle bool `mapstructure:"use_path_style"`
+}
+
+// GCSOptions defines configuration for firmware downloads from gs:// URLs.
+type GCSOptions struct {
+	// CredentialsFile is the path to a service account JSON key file.
+	CredentialsFile string `mapstructure:"credentials_file"`
+}
+
 type OrchestratorAPIParams struct {
 	OidcIssuerEndpoint   string   `mapstructure:"oidc_issuer_endpoint"`
 	OidcAudienceEndpoint string   `mapstructure:"oidc_audience_endpoint"`
@@ -96,6 +271,13 @@ func (a *App) LoadConfiguration(cfgFile string, storeKind model.StoreKind) error
 	// these are initialized here so viper can read in configuration from env vars
 	// once https://github.com/spf13/viper/pull/1429 is merged, this can go.
 	a.Config.FleetDBAPIOptions = &FleetDBAPIOptions{}
+	a.Config.YamlStoreOptions = &YamlStoreOptions{}
+	a.Config.FirmwareCache = &FirmwareCacheOptions{}
+	a.Config.FirmwareSignature = &FirmwareSignatureOptions{}
+	a.Config.UploadLimits = &UploadLimitsOptions{}
+	a.Config.Reboot = &RebootOptions{}
+	a.Config.AuditLog = &AuditLogOptions{}
+	a.Config.ObjectStorage = &ObjectStorageOptions{S3: &S3Options{}, GCS: &GCSOptions{}}
 
 	if cfgFile != "" {
 		fh, err := os.Open(cfgFile)
@@ -126,10 +308,34 @@ func (a *App) LoadConfiguration(cfgFile string, storeKind model.StoreKind) error
 		}
 	}
 
+	if storeKind == model.InventoryStoreYAML {
+		if err := a.envVarYamlStoreOverrides(); err != nil {
+			return errors.Wrap(ErrConfig, "yaml store env overrides error:"+err.Error())
+		}
+	}
+
 	if a.Config.Concurrency == 0 {
 		a.Config.Concurrency = WorkerConcurrency
 	}
 
+	if a.Config.ListenAddress == "" {
+		a.Config.ListenAddress = metrics.MetricsEndpoint
+	}
+
+	if a.Config.ProfilingAddress == "" {
+		a.Config.ProfilingAddress = ProfilingEndpoint
+	}
+
+	if err := a.conditionLimitsParams(); err != nil {
+		return errors.Wrap(ErrConfig, err.Error())
+	}
+
+	for _, rules := range a.Config.InstallRules {
+		if err := rules.Validate(); err != nil {
+			return errors.Wrap(ErrConfig, "install_rules: "+err.Error())
+		}
+	}
+
 	if a.Mode == model.RunInband {
 		if err := a.inbandInstallParams(); err != nil {
 			return errors.Wrap(ErrConfig, err.Error())
@@ -139,6 +345,39 @@ func (a *App) LoadConfiguration(cfgFile string, storeKind model.StoreKind) error
 	return nil
 }
 
+// conditionLimitsParams validates the condition limits are for supported condition kinds,
+// the condition kind keys are lower cased by viper and so are restored here.
+func (a *App) conditionLimitsParams() error {
+	if len(a.Config.ConditionLimits) == 0 {
+		return nil
+	}
+
+	limits := make(map[string]*ConditionLimits, len(a.Config.ConditionLimits))
+	for key, kindLimits := range a.Config.ConditionLimits {
+		idx := slices.IndexFunc(model.ConditionKinds(), func(kind rctypes.Kind) bool {
+			return strings.EqualFold(string(kind), key)
+		})
+
+		if idx == -1 {
+			return errors.New("condition_limits: unsupported condition kind: " + key)
+		}
+
+		if kindLimits == nil {
+			continue
+		}
+
+		if kindLimits.Concurrency < 0 || kindLimits.HandlerTimeout < 0 {
+			return errors.New("condition_limits: invalid limits for condition kind: " + key)
+		}
+
+		limits[string(model.ConditionKinds()[idx])] = kindLimits
+	}
+
+	a.Config.ConditionLimits = limits
+
+	return nil
+}
+
 func (a *App) envVarAppOverrides() {
 	if a.v.GetString("log.level") != "" {
 		a.Config.LogLevel = a.v.GetString("log.level")
@@ -175,6 +414,8 @@ func (a *App) envBindVars() error {
 type NatsConfig struct {
 	NatsURL        string
 	CredsFile      string
+	StreamUser     string
+	StreamPass     string
 	KVReplicas     int
 	ConnectTimeout time.Duration
 }
@@ -190,10 +431,18 @@ func (a *App) NatsParams() (NatsConfig, error) {
 		return NatsConfig{}, errors.New("missing parameter: nats.url")
 	}
 
-	if a.v.GetString("nats.creds.file") != "" {
+	// a creds file or a stream user, password is required
+	switch {
+	case a.v.GetString("nats.creds.file") != "":
 		cfg.CredsFile = a.v.GetString("nats.creds.file")
-	} else {
-		return NatsConfig{}, errors.New("missing parameter: nats.creds.file")
+	case a.v.GetString("nats.stream_user") != "":
+		cfg.StreamUser = a.v.GetString("nats.stream_user")
+		cfg.StreamPass = a.v.GetString("nats.stream_pass")
+		if cfg.StreamPass == "" {
+			return NatsConfig{}, errors.New("missing parameter: nats.stream_pass")
+		}
+	default:
+		return NatsConfig{}, errors.New("missing parameter: nats.creds.file or nats.stream_user")
 	}
 
 	if a.v.GetDuration("nats.connect.timeout") != 0 {
@@ -207,6 +456,16 @@ func (a *App) NatsParams() (NatsConfig, error) {
 	return cfg, nil
 }
 
+// EmbeddedNatsParams returns the parameters to connect to the embedded NATS server.
+func EmbeddedNatsParams(natsURL, user, pass string) NatsConfig {
+	return NatsConfig{
+		NatsURL:        natsURL,
+		StreamUser:     user,
+		StreamPass:     pass,
+		ConnectTimeout: defaultNatsConnectTimeout,
+	}
+}
+
 func (a *App) inbandInstallParams() error {
 	errInbandParam := errors.New("inband parameter error")
 
@@ -289,6 +548,23 @@ func (a *App) envVarOrchestratorAPIOverrides() error {
 	return nil
 }
 
+// Yaml store configuration options
+func (a *App) envVarYamlStoreOverrides() error {
+	if a.Config.YamlStoreOptions == nil {
+		a.Config.YamlStoreOptions = &YamlStoreOptions{}
+	}
+
+	if a.v.GetString("yaml.inventory.file") != "" {
+		a.Config.YamlStoreOptions.InventoryFile = a.v.GetString("yaml.inventory.file")
+	}
+
+	if a.Config.YamlStoreOptions.InventoryFile == "" {
+		return errors.New("yaml inventory_file not defined")
+	}
+
+	return nil
+}
+
 // Server service configuration options
 
 // nolint:gocyclo // parameter validation is cyclomatic
@@ -0,0 +1,305 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultPath is the audit log path used by the audit command when none is given.
+	DefaultPath = "/var/log/agent/audit.jsonl"
+
+	// DefaultMaxSizeBytes is the size the audit log is rotated at when not configured.
+	DefaultMaxSizeBytes = 100 << 20
+
+	// DefaultMaxBackups is the number of rotated audit log files kept when not configured.
+	DefaultMaxBackups = 10
+
+	// records larger than this are skipped when the audit log is read
+	maxRecordSize = 1 << 20
+)
+
+var (
+	ErrAuditLog = errors.New("audit log error")
+)
+
+// RecordKind identifies the object a Record is for.
+type RecordKind string
+
+const (
+	KindTask   RecordKind = "task"
+	KindAction RecordKind = "action"
+	KindStep   RecordKind = "step"
+)
+
+// Record is a task, action or step state transition written to the audit log.
+type Record struct {
+	Timestamp     time.Time  `json:"ts"`
+	Kind          RecordKind `json:"kind"`
+	ConditionID   string     `json:"conditionID"`
+	ConditionKind string     `json:"conditionKind,omitempty"`
+	ServerID      string     `json:"serverID"`
+	ServerVendor  string     `json:"serverVendor,omitempty"`
+	ServerModel   string     `json:"serverModel,omitempty"`
+	ActionID      string     `json:"actionID,omitempty"`
+	// Component is the component slug the firmware is installed on
+	Component       string `json:"component,omitempty"`
+	FirmwareID      string `json:"firmwareID,omitempty"`
+	FirmwareVendor  string `json:"firmwareVendor,omitempty"`
+	FirmwareVersion string `json:"firmwareVersion,omitempty"`
+	Step            string `json:"step,omitempty"`
+	State           string `json:"state"`
+	Status          string `json:"status,omitempty"`
+	BMCTaskID       string `json:"bmcTaskID,omitempty"`
+	// TaskCreatedAt is when the task the record is for was created
+	TaskCreatedAt time.Time `json:"taskCreatedAt"`
+	// TaskUpdatedAt is when the task the record is for was last updated
+	TaskUpdatedAt time.Time `json:"taskUpdatedAt"`
+}
+
+// Filter selects the records returned by Query, empty fields match all records.
+type Filter struct {
+	ServerID    string
+	ConditionID string
+}
+
+func (f Filter) match(r *Record) bool {
+	if f.ServerID != "" && f.ServerID != r.ServerID {
+		return false
+	}
+
+	if f.ConditionID != "" && f.ConditionID != r.ConditionID {
+		return false
+	}
+
+	return true
+}
+
+// Log is an append-only JSON lines audit log.
+//
+// The log file is rotated once it exceeds its size limit, the rotated files are suffixed
+// with .1 (the most recent) through .N, files beyond the backups limit are removed.
+type Log struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// New returns an audit Log writing to the given path,
+// the default size and backup limits apply when a limit is 0.
+func New(path string, maxSizeBytes int64, maxBackups int) (*Log, error) {
+	if path == "" {
+		return nil, errors.Wrap(ErrAuditLog, "expected an audit log path")
+	}
+
+	if maxSizeBytes == 0 {
+		maxSizeBytes = DefaultMaxSizeBytes
+	}
+
+	if maxBackups == 0 {
+		maxBackups = DefaultMaxBackups
+	}
+
+	if maxSizeBytes < 0 || maxBackups < 0 {
+		return nil, errors.Wrap(ErrAuditLog, "invalid audit log size or backups limit")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, errors.Wrap(ErrAuditLog, err.Error())
+	}
+
+	l := &Log{path: path, maxSize: maxSizeBytes, maxBackups: maxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Log) open() error {
+	fh, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return errors.Wrap(ErrAuditLog, err.Error())
+	}
+
+	info, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		return errors.Wrap(ErrAuditLog, err.Error())
+	}
+
+	l.file = fh
+	l.size = info.Size()
+
+	return nil
+}
+
+// Write appends the records to the audit log, the records are synced to disk before it returns.
+func (l *Log) Write(records ...Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var buf []byte
+	for idx := range records {
+		b, err := json.Marshal(&records[idx])
+		if err != nil {
+			return errors.Wrap(ErrAuditLog, err.Error())
+		}
+
+		buf = append(buf, b...)
+		buf = append(buf, '\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return errors.Wrap(ErrAuditLog, "audit log closed")
+	}
+
+	if l.size > 0 && l.size+int64(len(buf)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(buf)
+	l.size += int64(n)
+	if err != nil {
+		return errors.Wrap(ErrAuditLog, err.Error())
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return errors.Wrap(ErrAuditLog, err.Error())
+	}
+
+	return nil
+}
+
+// rotate shifts the rotated files by one, moves the current file to .1 and opens a new file.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return errors.Wrap(ErrAuditLog, err.Error())
+	}
+
+	l.file = nil
+
+	if err := os.Remove(backupPath(l.path, l.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(ErrAuditLog, err.Error())
+	}
+
+	for n := l.maxBackups - 1; n >= 1; n-- {
+		if err := os.Rename(backupPath(l.path, n), backupPath(l.path, n+1)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(ErrAuditLog, err.Error())
+		}
+	}
+
+	if err := os.Rename(l.path, backupPath(l.path, 1)); err != nil {
+		return errors.Wrap(ErrAuditLog, err.Error())
+	}
+
+	return l.open()
+}
+
+// Close closes the audit log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+func backupPath(path string, n int) string {
+	return path + "." + strconv.Itoa(n)
+}
+
+// Files returns the audit log file and its rotated files that exist, oldest first.
+func Files(path string) []string {
+	var files []string
+	for n := 1; ; n++ {
+		if _, err := os.Stat(backupPath(path, n)); err != nil {
+			break
+		}
+
+		files = append([]string{backupPath(path, n)}, files...)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+
+	return files
+}
+
+// Query returns the records in the audit log and its rotated files matching the filter, oldest first.
+//
+// Lines that are not valid records, as left behind by an interrupted write, are skipped.
+func Query(path string, filter Filter) ([]Record, error) {
+	files := Files(path)
+	if len(files) == 0 {
+		return nil, errors.Wrap(ErrAuditLog, "no audit log found at: "+path)
+	}
+
+	var records []Record
+	for _, file := range files {
+		found, err := queryFile(file, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, found...)
+	}
+
+	return records, nil
+}
+
+func queryFile(file string, filter Filter) ([]Record, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrap(ErrAuditLog, err.Error())
+	}
+	defer fh.Close()
+
+	var records []Record
+
+	reader := bufio.NewReader(fh)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && len(line) <= maxRecordSize {
+			record := Record{}
+			if jerr := json.Unmarshal(line, &record); jerr == nil && filter.match(&record) {
+				records = append(records, record)
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, errors.Wrap(ErrAuditLog, err.Error())
+		}
+	}
+
+	return records, nil
+}
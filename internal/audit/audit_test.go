@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogRotateQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+
+	record := func(conditionID, serverID, state string) Record {
+		return Record{
+			Timestamp:       time.Now(),
+			Kind:            KindStep,
+			ConditionID:     conditionID,
+			ServerID:        serverID,
+			Component:       "bmc",
+			FirmwareVersion: "1.2.3",
+			Step:            "uploadFirmware",
+			State:           state,
+		}
+	}
+
+	// size the log to hold two records, with one rotated file kept
+	l, err := New(path, 600, 1)
+	require.Nil(t, err)
+
+	require.Nil(t, l.Write(record("c1", "s1", "active")))
+	require.Nil(t, l.Write(record("c1", "s1", "succeeded")))
+	require.Nil(t, l.Write(record("c2", "s2", "active")))
+	require.Nil(t, l.Write(record("c2", "s2", "failed")))
+	require.Nil(t, l.Write(record("c3", "s1", "active")))
+	require.Nil(t, l.Close())
+
+	assert.ErrorIs(t, l.Write(record("c3", "s1", "succeeded")), ErrAuditLog)
+
+	// the oldest records are rotated out
+	assert.Equal(t, []string{path + ".1", path}, Files(path))
+
+	got, err := Query(path, Filter{})
+	require.Nil(t, err)
+	require.Len(t, got, 3)
+	assert.Equal(t, "c2", got[0].ConditionID)
+	assert.Equal(t, "c3", got[2].ConditionID)
+
+	got, err = Query(path, Filter{ServerID: "s1"})
+	require.Nil(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "c3", got[0].ConditionID)
+
+	got, err = Query(path, Filter{ConditionID: "c2"})
+	require.Nil(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, []string{"active", "failed"}, []string{got[0].State, got[1].State})
+
+	// a partially written record is skipped
+	fh, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o640)
+	require.Nil(t, err)
+	_, err = fh.WriteString(`{"conditionID":"c3","serverID":"s1","st`)
+	require.Nil(t, err)
+	require.Nil(t, fh.Close())
+
+	got, err = Query(path, Filter{ConditionID: "c3"})
+	require.Nil(t, err)
+	assert.Len(t, got, 1)
+
+	_, err = Query(filepath.Join(t.TempDir(), "missing.jsonl"), Filter{})
+	assert.ErrorIs(t, err, ErrAuditLog)
+}
@@ -0,0 +1,79 @@
+package ctrl
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/metal-automata/agent/internal/model"
+	"github.com/metal-automata/rivets/condition"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// CancelKVBucket holds the cancel requests for running conditions,
+	// the keys are the facility code and condition ID - the same as the condition status KV keys.
+	CancelKVBucket = "cancel-requests"
+)
+
+var (
+	errCancelRequest = errors.New("condition cancel request error")
+)
+
+// RequestCancel writes a cancel request for the running condition,
+// the controller running the condition stops the condition handler at a safe point and fails the condition.
+func RequestCancel(js nats.JetStreamContext, facilityCode string, conditionID uuid.UUID) error {
+	kv, err := js.KeyValue(CancelKVBucket)
+	if err != nil {
+		return errors.Wrap(errCancelRequest, err.Error())
+	}
+
+	key := condition.StatusValueKVKey(facilityCode, conditionID.String())
+	if _, err := kv.PutString(key, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return errors.Wrap(errCancelRequest, err.Error())
+	}
+
+	return nil
+}
+
+// watchCancelRequest watches for a cancel request for the condition,
+// on which the handler context is canceled with the model.ErrConditionCancelled cause.
+//
+// The returned func is to be invoked to stop the watch.
+func (n *NatsController) watchCancelRequest(ctx context.Context, conditionID string, cancel context.CancelCauseFunc) (stop func()) {
+	// cancel requests are not supported
+	if n.cancelKV == nil {
+		return func() {}
+	}
+
+	le := n.logger.WithField("conditionID", conditionID)
+
+	watcher, err := n.cancelKV.Watch(condition.StatusValueKVKey(n.facilityCode, conditionID), nats.Context(ctx))
+	if err != nil {
+		le.WithError(err).Warn("unable to watch for condition cancel requests")
+		return func() {}
+	}
+
+	go func() {
+		// the updates channel is closed when the watcher is stopped
+		for entry := range watcher.Updates() {
+			// nil indicates the initial values were received
+			if entry == nil || entry.Operation() != nats.KeyValuePut {
+				continue
+			}
+
+			le.WithFields(logrus.Fields{"requested": string(entry.Value())}).Info("condition cancel request received")
+			cancel(model.ErrConditionCancelled)
+
+			return
+		}
+	}()
+
+	return func() {
+		if err := watcher.Stop(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			le.WithError(err).Debug("error stopping cancel request watcher")
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package ctrl
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/metal-automata/agent/internal/model"
+	"github.com/metal-automata/rivets/events"
+	"github.com/metal-automata/rivets/events/pkg/kv"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchCancelRequest(t *testing.T) {
+	srv := startJetStreamServer(t)
+	defer shutdownJetStream(t, srv)
+	natsConn, js := jetStreamContext(t, srv) // nc is closed on evJS.Close(), js needs no cleanup
+	evJS := events.NewJetstreamFromConn(natsConn)
+	defer evJS.Close()
+
+	cancelKV, err := kv.CreateOrBindKVBucket(evJS, CancelKVBucket)
+	require.Nil(t, err)
+
+	l := logrus.New()
+	l.SetOutput(io.Discard) // unset this to debug
+
+	n := &NatsController{logger: l, facilityCode: "fc13", cancelKV: cancelKV}
+
+	t.Run("cancel request cancels the handler context", func(t *testing.T) {
+		conditionID := uuid.New()
+
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+
+		stop := n.watchCancelRequest(ctx, conditionID.String(), cancel)
+		defer stop()
+
+		// a cancel request for another condition is ignored
+		require.Nil(t, RequestCancel(js, "fc13", uuid.New()))
+		require.Nil(t, RequestCancel(js, "fc14", conditionID))
+
+		select {
+		case <-ctx.Done():
+			t.Fatal("unexpected handler context cancellation")
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		require.Nil(t, RequestCancel(js, "fc13", conditionID))
+
+		select {
+		case <-ctx.Done():
+			assert.ErrorIs(t, context.Cause(ctx), model.ErrConditionCancelled)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the handler context to be canceled")
+		}
+	})
+
+	t.Run("cancel requested before the watch", func(t *testing.T) {
+		conditionID := uuid.New()
+		require.Nil(t, RequestCancel(js, "fc13", conditionID))
+
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+
+		stop := n.watchCancelRequest(ctx, conditionID.String(), cancel)
+		defer stop()
+
+		select {
+		case <-ctx.Done():
+			assert.ErrorIs(t, context.Cause(ctx), model.ErrConditionCancelled)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the handler context to be canceled")
+		}
+	})
+
+	t.Run("cancel requests not supported", func(t *testing.T) {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+
+		stop := (&NatsController{logger: l}).watchCancelRequest(ctx, uuid.New().String(), cancel)
+		stop()
+
+		assert.Nil(t, ctx.Err())
+	})
+}
@@ -12,20 +12,17 @@ const (
 	subjectPrefix = "com.hollow.sh.controllers.commands"
 )
 
+// ConditionSubject returns the stream subject on which conditions of the kind are queued for controllers in the facility.
+func ConditionSubject(facilityCode string, kind condition.Kind) string {
+	// com.hollow.sh.controllers.commands.sandbox.servers.firmwareInstall
+	return fmt.Sprintf("%s.%s.servers.%s", subjectPrefix, facilityCode, kind)
+}
+
 func queueConfig(appName, facilityCode, natsURL, credsFile string, conditionKinds []condition.Kind) events.NatsOptions {
 	consumerSubjects := []string{}
 	for _, kind := range conditionKinds {
 		// prepare consumer subjects
-		sub := fmt.Sprintf(
-			// com.hollow.sh.controllers.commands.sandbox.servers.
-			// "%s.%s.servers.>",
-			"%s.%s.servers.%s",
-			subjectPrefix,
-			facilityCode,
-			kind,
-		)
-
-		consumerSubjects = append(consumerSubjects, sub)
+		consumerSubjects = append(consumerSubjects, ConditionSubject(facilityCode, kind))
 	}
 
 	return events.NatsOptions{
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
@@ -56,7 +57,12 @@ type HTTPController struct {
 	orcQueryRetries int
 	queryInterval   time.Duration
 	handlerTimeout  time.Duration
+	// pollIntervalMax is the max interval between the orchestrator API polls in the daemon loop
+	pollIntervalMax time.Duration
 	orcQueryor      orc.Queryor
+	// daemon loop status
+	statusMu sync.Mutex
+	status   DaemonStatus
 }
 
 type OrchestratorAPIConfig struct {
@@ -90,6 +96,7 @@ func NewHTTPController(
 		orcQueryRetries: orcQueryRetries,
 		handlerTimeout:  handlerTimeout,
 		queryInterval:   queryInterval,
+		pollIntervalMax: pollIntervalMax,
 		logger:          logger,
 	}
 
@@ -210,9 +217,7 @@ func (n *HTTPController) Run(ctx context.Context, handler TaskHandler) error {
 	task, err := n.fetchTaskWithRetries(ctx, n.serverID, n.orcQueryRetries, n.queryInterval)
 	if err != nil {
 		if errors.Is(err, errNothingToDo) {
-			n.logger.WithError(err).WithFields(logrus.Fields{
-				"conditionID": task.ID.String(),
-			}).Info("nothing to do here")
+			n.logger.WithError(err).Info("nothing to do here")
 
 			return nil
 		}
@@ -220,6 +225,13 @@ func (n *HTTPController) Run(ctx context.Context, handler TaskHandler) error {
 		return errors.Wrap(ErrHandlerInit, err.Error())
 	}
 
+	return n.runTask(ctx, handler, task)
+}
+
+// runTask publishes the initial task status and runs the task handler.
+func (n *HTTPController) runTask(ctx context.Context, handler TaskHandler, task *condition.Task[any, any]) error {
+	var err error
+
 	// init publisher
 	publisher := NewHTTPPublisher(n.appName, n.serverID, task.ID, n.conditionKind, n.orcQueryor, n.logger)
 	if task.State == condition.Pending {
@@ -251,7 +263,22 @@ func (n *HTTPController) Run(ctx context.Context, handler TaskHandler) error {
 		defer span.End()
 	}
 
-	return n.runTaskWithMonitor(ctx, handler, task, publisher, statusInterval)
+	metricsConditionInflight(task.Kind, 1)
+	defer metricsConditionInflight(task.Kind, -1)
+
+	startTS := time.Now()
+
+	err = n.runTaskWithMonitor(ctx, handler, task, publisher, statusInterval)
+	switch {
+	case errors.Is(err, model.ErrHostPowerCycleRequired):
+		// the task is resumed after the host power cycle
+	case err != nil:
+		registerConditionRuntimeMetric(task.Kind, startTS, string(condition.Failed))
+	default:
+		registerConditionRuntimeMetric(task.Kind, startTS, string(condition.Succeeded))
+	}
+
+	return err
 }
 
 func (n *HTTPController) runTaskWithMonitor(
@@ -339,6 +366,12 @@ func (n *HTTPController) runTaskWithMonitor(
 	defer cancel()
 
 	if err := handler.HandleTask(handlerCtx, task, publisher); err != nil {
+		// the task is resumed once the host is power cycled
+		if errors.Is(err, model.ErrHostPowerCycleRequired) {
+			logger.Info("Controller task paused, waiting for host power cycle")
+			return err
+		}
+
 		task.Status.Append("controller returned error: " + err.Error())
 		task.State = condition.Failed
 
@@ -0,0 +1,177 @@
+package ctrl
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/metal-automata/agent/internal/model"
+	"github.com/metal-automata/rivets/condition"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// Default max interval between the orchestrator API polls in the daemon loop
+	pollIntervalMax = 5 * time.Minute
+)
+
+// DaemonState is the state of the inband daemon loop
+type DaemonState string
+
+const (
+	// DaemonPolling indicates the daemon is polling the orchestrator API for a condition
+	DaemonPolling DaemonState = "polling"
+	// DaemonRunning indicates the daemon is running a condition task
+	DaemonRunning DaemonState = "running"
+	// DaemonPowerCycleWait indicates the daemon is waiting on the host power cycle to resume the condition task
+	DaemonPowerCycleWait DaemonState = "waitingPowerCycle"
+)
+
+// DaemonStatus is the inband daemon loop status served on the status endpoint.
+type DaemonStatus struct {
+	State       DaemonState `json:"state"`
+	ServerID    string      `json:"serverID"`
+	ConditionID string      `json:"conditionID,omitempty"`
+	LastPoll    time.Time   `json:"lastPoll,omitempty"`
+	LastError   string      `json:"lastError,omitempty"`
+	Handled     int         `json:"handled"`
+	StartedAt   time.Time   `json:"startedAt"`
+}
+
+// WithPollIntervalMax sets the max interval between the orchestrator API polls in the daemon loop.
+func WithPollIntervalMax(t time.Duration) OptionHTTPController {
+	return func(n *HTTPController) {
+		n.pollIntervalMax = t
+	}
+}
+
+// RunDaemon polls the orchestrator API for conditions and runs them as they arrive, until the context is canceled.
+//
+// The interval between polls backs off from the query interval up to the max poll interval while there are no conditions to run,
+// the orchestrator API is polled again right after a condition completes.
+//
+// A task that requires the host to be power cycled is left active and model.ErrHostPowerCycleRequired is returned,
+// for the caller to hand off the host reboot, the task is resumed when the daemon is started again after the host is up.
+func (n *HTTPController) RunDaemon(ctx context.Context, handler TaskHandler) error {
+	ctx, span := otel.Tracer(pkgHTTPController).Start(
+		ctx,
+		"RunDaemon",
+	)
+	defer span.End()
+
+	n.updateStatus(func(s *DaemonStatus) {
+		s.ServerID = n.serverID.String()
+		s.StartedAt = time.Now()
+	})
+
+	interval := n.queryInterval
+	for {
+		n.updateStatus(func(s *DaemonStatus) {
+			s.State = DaemonPolling
+			s.ConditionID = ""
+			s.LastPoll = time.Now()
+		})
+
+		// a single attempt, the backoff between polls is applied here
+		task, err := n.fetchTaskWithRetries(ctx, n.serverID, 0, 0)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err == nil, errors.Is(err, errNothingToDo):
+		default:
+			n.logger.WithError(err).Warn("condition poll error")
+			n.updateStatus(func(s *DaemonStatus) { s.LastError = err.Error() })
+		}
+
+		if task != nil {
+			if errRun := n.runDaemonTask(ctx, handler, task); errRun != nil {
+				if errors.Is(errRun, model.ErrHostPowerCycleRequired) {
+					n.logger.WithField("conditionID", task.ID.String()).Info("host power cycle required to proceed")
+
+					return errRun
+				}
+
+				n.logger.WithError(errRun).WithField("conditionID", task.ID.String()).Error("condition task run error")
+				n.updateStatus(func(s *DaemonStatus) { s.LastError = errRun.Error() })
+			}
+
+			// poll for the next condition right away
+			interval = n.queryInterval
+
+			continue
+		}
+
+		if errSleep := model.SleepInContext(ctx, interval); errSleep != nil {
+			return nil
+		}
+
+		interval = n.nextPollInterval(interval)
+	}
+}
+
+func (n *HTTPController) runDaemonTask(ctx context.Context, handler TaskHandler, task *condition.Task[any, any]) error {
+	n.updateStatus(func(s *DaemonStatus) {
+		s.State = DaemonRunning
+		s.ConditionID = task.ID.String()
+	})
+
+	n.logger.WithFields(
+		logrus.Fields{
+			"conditionID": task.ID.String(),
+			"state":       task.State,
+		},
+	).Info("running condition task")
+
+	err := n.runTask(ctx, handler, task)
+	if errors.Is(err, model.ErrHostPowerCycleRequired) {
+		n.updateStatus(func(s *DaemonStatus) { s.State = DaemonPowerCycleWait })
+		return err
+	}
+
+	n.updateStatus(func(s *DaemonStatus) { s.Handled++ })
+
+	return err
+}
+
+// nextPollInterval returns the doubled poll interval, limited to the max poll interval.
+func (n *HTTPController) nextPollInterval(current time.Duration) time.Duration {
+	next := current * 2
+	if next > n.pollIntervalMax {
+		return n.pollIntervalMax
+	}
+
+	return next
+}
+
+func (n *HTTPController) updateStatus(fn func(*DaemonStatus)) {
+	n.statusMu.Lock()
+	defer n.statusMu.Unlock()
+
+	fn(&n.status)
+}
+
+// Status returns the daemon loop status.
+func (n *HTTPController) Status() DaemonStatus {
+	n.statusMu.Lock()
+	defer n.statusMu.Unlock()
+
+	return n.status
+}
+
+// StatusHandler returns the http handler for the daemon loop status endpoint.
+func (n *HTTPController) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(n.Status()); err != nil {
+			n.logger.WithError(err).Warn("status endpoint response error")
+		}
+	})
+}
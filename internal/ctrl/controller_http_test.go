@@ -2,12 +2,15 @@ package ctrl
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/metal-automata/agent/internal/model"
 
 	"github.com/metal-automata/conditionorc/pkg/api/v1/orchestrator/types"
 	"github.com/metal-automata/rivets/condition"
@@ -508,3 +511,91 @@ func TestFetchTask(t *testing.T) {
 		})
 	}
 }
+
+func TestRunDaemon(t *testing.T) {
+	serverID := uuid.New()
+	conditionKind := condition.FirmwareInstallInband
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	setupMock := func(t *testing.T, cond *condition.Condition) *orc.MockQueryor {
+		ocm := orc.NewMockQueryor(t)
+		ocm.On("ConditionQuery", mock.Anything, serverID).Return(&types.ServerResponse{
+			StatusCode: http.StatusOK,
+			Condition:  cond,
+		}, nil).Once()
+
+		// the condition is in a final state on subsequent polls
+		finalCond := *cond
+		finalCond.State = condition.Succeeded
+		ocm.On("ConditionQuery", mock.Anything, serverID).Return(&types.ServerResponse{
+			StatusCode: http.StatusOK,
+			Condition:  &finalCond,
+		}, nil).Maybe()
+
+		ocm.On("ConditionTaskPublish", mock.Anything, conditionKind, serverID, cond.ID, mock.Anything, mock.Anything).
+			Return(&types.ServerResponse{StatusCode: http.StatusOK}, nil)
+		ocm.On("ConditionStatusUpdate", mock.Anything, conditionKind, serverID, cond.ID, mock.Anything, mock.Anything).
+			Return(&types.ServerResponse{StatusCode: http.StatusOK}, nil)
+
+		return ocm
+	}
+
+	newController := func(ocm orc.Queryor) *HTTPController {
+		return &HTTPController{
+			logger:          logger,
+			serverID:        serverID,
+			conditionKind:   conditionKind,
+			orcQueryor:      ocm,
+			queryInterval:   time.Millisecond,
+			pollIntervalMax: 10 * time.Millisecond,
+			handlerTimeout:  5 * time.Second,
+		}
+	}
+
+	t.Run("successive polls after a condition is handled", func(t *testing.T) {
+		cond := &condition.Condition{ID: uuid.New(), Kind: conditionKind, State: condition.Pending, Target: serverID}
+		controller := newController(setupMock(t, cond))
+
+		handler := NewMockTaskHandler(t)
+		handler.On("HandleTask", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := make(chan error, 1)
+		go func() { errCh <- controller.RunDaemon(ctx, handler) }()
+
+		assert.Eventually(t, func() bool {
+			status := controller.Status()
+			return status.Handled == 1 && status.State == DaemonPolling
+		}, 5*time.Second, 5*time.Millisecond)
+
+		cancel()
+		require.Nil(t, <-errCh)
+
+		status := controller.Status()
+		assert.Equal(t, serverID.String(), status.ServerID)
+		assert.Empty(t, status.LastError)
+	})
+
+	t.Run("returns on host power cycle", func(t *testing.T) {
+		cond := &condition.Condition{ID: uuid.New(), Kind: conditionKind, State: condition.Pending, Target: serverID}
+		controller := newController(setupMock(t, cond))
+
+		handler := NewMockTaskHandler(t)
+		handler.On("HandleTask", mock.Anything, mock.Anything, mock.Anything).Return(model.ErrHostPowerCycleRequired).Once()
+
+		err := controller.RunDaemon(context.Background(), handler)
+		require.ErrorIs(t, err, model.ErrHostPowerCycleRequired)
+
+		// the status endpoint serves the daemon status
+		rec := httptest.NewRecorder()
+		controller.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", http.NoBody))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		got := DaemonStatus{}
+		require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.Equal(t, DaemonPowerCycleWait, got.State)
+		assert.Equal(t, cond.ID.String(), got.ConditionID)
+	})
+}
@@ -7,12 +7,15 @@ import (
 	"os"
 	"runtime/debug"
 	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/metal-automata/agent/internal/model"
 	"github.com/metal-automata/rivets/condition"
 	"github.com/metal-automata/rivets/events"
+	"github.com/metal-automata/rivets/events/pkg/kv"
 	"github.com/nats-io/nats.go"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -43,6 +46,8 @@ const (
 	LivenessStaleThreshold = condition.StaleThreshold
 	// default number of KV replicas for created NATS buckets
 	kvReplicationFactor = 3
+	// Default time to wait on in-flight conditions when draining, after which their handlers are canceled
+	drainTimeout = 60 * time.Minute
 )
 
 var (
@@ -63,13 +68,33 @@ type NatsController struct {
 	handlerTimeout    time.Duration
 	connectionTimeout time.Duration
 	checkinInterval   time.Duration
+	drainTimeout      time.Duration
+	// drainCh is closed to have the controller stop pulling new events
+	drainCh   chan struct{}
+	drainOnce sync.Once
 	// Factory method returns a condition event handler
 	// set by the caller when calling ListenEvents()
 	conditionHandlerFactory ConditionHandlerFactory
 	// controller liveness interface
-	liveness    LivenessCheckin
+	liveness LivenessCheckin
+	// cancelKV holds cancel requests for running conditions
+	cancelKV nats.KeyValue
+	// kindLimits overrides the concurrency, handler timeout for a condition kind
+	kindLimits  map[condition.Kind]KindLimits
 	concurrency int
 	dispatched  int32
+	// dispatchedKinds counts the in-flight conditions by kind
+	dispatchedKinds map[condition.Kind]int
+	dispatchMu      sync.Mutex
+	// inflight lists the conditions being handled for the status endpoint
+	inflight inflightConditions
+}
+
+// KindLimits are the concurrency limit and handler timeout for conditions of a kind,
+// zero values fall back to the controller concurrency, handler timeout.
+type KindLimits struct {
+	Concurrency    int
+	HandlerTimeout time.Duration
 }
 
 // Option sets parameters on the NatsController
@@ -100,6 +125,8 @@ func NewNatsController(
 		pullEventInterval: pullEventInterval,
 		pullEventTimeout:  pullEventTimeout,
 		checkinInterval:   checkinInterval,
+		drainTimeout:      drainTimeout,
+		drainCh:           make(chan struct{}),
 		concurrency:       concurrency,
 		natsConfig:        queueCfg,
 	}
@@ -126,6 +153,8 @@ func WithLogger(logger *logrus.Logger) Option {
 	}
 }
 
+// WithConcurrency sets the number of conditions of each kind handled concurrently,
+// unless set for the kind with WithKindLimits.
 func WithConcurrency(c int) Option {
 	return func(n *NatsController) {
 		n.concurrency = c
@@ -141,12 +170,36 @@ func WithKVReplicas(c int) Option {
 	}
 }
 
+// WithStreamUserPass sets the user, password to connect to NATS, when no creds file is provided.
+func WithStreamUserPass(user, pass string) Option {
+	return func(n *NatsController) {
+		n.natsConfig.StreamUser = user
+		n.natsConfig.StreamPass = pass
+	}
+}
+
 func WithHandlerTimeout(t time.Duration) Option {
 	return func(n *NatsController) {
 		n.handlerTimeout = t
 	}
 }
 
+// WithKindLimits sets the concurrency limit and handler timeout for each condition kind,
+// conditions of kinds without limits set here are limited by the controller concurrency, handler timeout.
+func WithKindLimits(limits map[condition.Kind]KindLimits) Option {
+	return func(n *NatsController) {
+		n.kindLimits = limits
+	}
+}
+
+// WithDrainTimeout sets the time to wait on in-flight conditions when draining,
+// after which the in-flight condition handlers are canceled.
+func WithDrainTimeout(t time.Duration) Option {
+	return func(n *NatsController) {
+		n.drainTimeout = t
+	}
+}
+
 func WithConnectionTimeout(t time.Duration) Option {
 	return func(n *NatsController) {
 		n.natsConfig.ConnectTimeout = t
@@ -190,6 +243,20 @@ func (n *NatsController) Connect(ctx context.Context) error {
 		return errors.Wrap(errStreamSub, err.Error())
 	}
 
+	// running conditions can be canceled with a cancel request
+	cancelKV, err := kv.CreateOrBindKVBucket(
+		stream,
+		CancelKVBucket,
+		kv.WithDescription(fmt.Sprintf("%s condition cancel requests", n.natsConfig.AppName)),
+		kv.WithTTL(kvTTL),
+		kv.WithReplicas(n.natsConfig.KVReplicationFactor),
+	)
+	if err != nil {
+		n.logger.WithError(err).Warn("unable to bind to cancel requests KV bucket, condition cancel requests are not supported")
+	} else {
+		n.cancelKV = cancelKV
+	}
+
 	n.liveness = NewNatsLiveness(n.natsConfig, n.stream, n.logger, n.hostname, checkinInterval)
 	n.liveness.StartLivenessCheckin(ctx)
 	n.logger.WithFields(
@@ -198,6 +265,7 @@ func (n *NatsController) Connect(ctx context.Context) error {
 			"facility":      n.facilityCode,
 			"replica-count": n.natsConfig.KVReplicationFactor,
 			"concurrency":   n.concurrency,
+			"kind-limits":   n.kindLimits,
 			"connect-time":  time.Since(startTS).String(),
 		},
 	).Info("connected to event stream as controller")
@@ -232,17 +300,23 @@ func (n *NatsController) ListenEvents(ctx context.Context, chf ConditionHandlerF
 	pullTicker := time.NewTicker(n.pullEventInterval)
 	defer pullTicker.Stop()
 
+	// the condition handlers are canceled when the drain timeout expires
+	handlerCtx, cancelHandlers := context.WithCancel(ctx)
+	defer cancelHandlers()
+
 Loop:
 	for {
 		select {
 		case <-pullTicker.C:
-			if err := n.processEvents(ctx); err != nil {
+			if err := n.processEvents(handlerCtx); err != nil {
 				return errors.Wrap(errListenEvents, err.Error())
 			}
+		case <-n.drainCh:
+			n.drain(ctx, cancelHandlers)
+
+			break Loop
 		case <-ctx.Done():
-			if n.dispatched > 0 {
-				continue
-			}
+			n.syncWG.Wait()
 
 			break Loop
 		}
@@ -251,9 +325,65 @@ Loop:
 	return nil
 }
 
+// Drain has the controller stop pulling new events, ListenEvents returns once the in-flight conditions are completed.
+//
+// The in-flight condition handlers are canceled if they don't complete within the drain timeout,
+// the controller liveness check-ins continue while draining.
+func (n *NatsController) Drain() {
+	n.drainOnce.Do(func() {
+		close(n.drainCh)
+	})
+}
+
+// drain waits on the in-flight conditions to complete.
+func (n *NatsController) drain(ctx context.Context, cancelHandlers context.CancelFunc) {
+	le := n.logger.WithFields(
+		logrus.Fields{
+			"inflight": atomic.LoadInt32(&n.dispatched),
+			"timeout":  n.drainTimeout.String(),
+		},
+	)
+
+	le.Info("draining, waiting on in-flight conditions to complete")
+
+	doneCh := make(chan struct{})
+	go func() {
+		n.syncWG.Wait()
+		close(doneCh)
+	}()
+
+	timer := time.NewTimer(n.drainTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-doneCh:
+		n.logger.Info("drain complete")
+	case <-timer.C:
+		le.Warn("drain timeout, canceling in-flight conditions")
+		cancelHandlers()
+		<-doneCh
+	case <-ctx.Done():
+		<-doneCh
+	}
+}
+
 // process event into a condition
 func (n *NatsController) processEvents(ctx context.Context) error {
 	for _, subject := range n.natsConfig.Consumer.SubscribeSubjects {
+		// no new events are pulled once draining
+		select {
+		case <-n.drainCh:
+			return nil
+		default:
+		}
+
+		// conditions of a kind at its concurrency limit are left in the queue,
+		// while conditions of other kinds continue to be accepted.
+		kind := subjectKind(subject)
+		if n.concurrencyLimit(kind) {
+			continue
+		}
+
 		pullCtx, cancel := context.WithTimeout(ctx, n.pullEventTimeout)
 		defer cancel() // nolint:gocritic // a fresh context with timeout for each message pull is required
 
@@ -266,7 +396,7 @@ func (n *NatsController) processEvents(ctx context.Context) error {
 			n.logger.WithFields(
 				logrus.Fields{"info": err.Error()},
 			).Trace("no new events")
-			return nil
+			continue
 
 		default:
 			n.logger.WithFields(
@@ -280,20 +410,19 @@ func (n *NatsController) processEvents(ctx context.Context) error {
 		// event status setter to keep the JS updated on our progress
 		eventAcknowleger := n.newNatsEventStatusAcknowleger(msg)
 
-		// check concurrent threshold
-		if n.concurrencyLimit() {
-			eventAcknowleger.nak()
-			return nil
-		}
-
 		if ctx.Err() != nil {
 			eventAcknowleger.nak()
 			return errors.Wrap(errProcessEvent, ctx.Err().Error())
 		}
 
-		// spawn msg process handler
+		// spawn msg process handler,
+		// the condition is counted as dispatched here so the next pull sees the updated count.
+		n.dispatch(kind)
 		n.syncWG.Add(1)
-		go n.processConditionFromEvent(ctx, msg, eventAcknowleger)
+		go func() {
+			defer n.release(kind)
+			n.processConditionFromEvent(ctx, msg, eventAcknowleger)
+		}()
 	}
 
 	return nil
@@ -306,9 +435,6 @@ func (n *NatsController) processConditionFromEvent(ctx context.Context, msg even
 		"processConditionFromEvent",
 	)
 
-	atomic.AddInt32(&n.dispatched, 1)
-	defer atomic.AddInt32(&n.dispatched, -1)
-
 	cond, err := conditionFromEvent(msg)
 	if err != nil {
 		n.logger.WithError(err).WithField(
@@ -556,12 +682,28 @@ func (n *NatsController) processCondition(
 	// mark message as complete in th JS as the status KV record is in place
 	eventAcknowleger.complete()
 
-	handlerCtx, cancel := context.WithTimeout(ctx, n.handlerTimeout)
+	n.inflight.add(cond)
+	defer n.inflight.remove(cond.ID.String())
+
+	publisher = &inflightPublisher{Publisher: publisher, inflight: &n.inflight}
+
+	handlerCtx, cancel := context.WithTimeout(ctx, n.kindHandlerTimeout(cond.Kind))
 	defer cancel()
 
+	// a cancel request for the condition cancels the handler context
+	handlerCtx, cancelHandler := context.WithCancelCause(handlerCtx)
+	defer cancelHandler(nil)
+
+	stopCancelWatch := n.watchCancelRequest(handlerCtx, cond.ID.String(), cancelHandler)
+	defer stopCancelWatch()
+
 	errHandler := n.runTaskHandlerWithMonitor(handlerCtx, task, publisher, statusInterval)
 	if errHandler != nil {
 		task.Status.Append(errHandler.Error())
+		if errors.Is(context.Cause(handlerCtx), model.ErrConditionCancelled) {
+			task.Status.Append(model.ErrConditionCancelled.Error())
+		}
+
 		task.State = condition.Failed
 		if err := publisher.Publish(ctx, task, false); err != nil {
 			msg := "final failed task status publish failure"
@@ -570,7 +712,7 @@ func (n *NatsController) processCondition(
 			}).Error(msg)
 		}
 
-		registerConditionRuntimeMetric(startTS, string(condition.Failed))
+		registerConditionRuntimeMetric(cond.Kind, startTS, string(condition.Failed))
 
 		// handler indicates this must be retried
 		if errors.Is(errHandler, ErrRetryHandler) {
@@ -600,7 +742,7 @@ func (n *NatsController) processCondition(
 		return
 	}
 
-	registerConditionRuntimeMetric(startTS, string(condition.Succeeded))
+	registerConditionRuntimeMetric(cond.Kind, startTS, string(condition.Succeeded))
 
 	spanEvent(
 		span,
@@ -673,7 +815,55 @@ func (n *NatsController) runTaskHandlerWithMonitor(ctx context.Context, task *co
 	return n.conditionHandlerFactory().HandleTask(ctx, task, publisher)
 }
 
-func (n *NatsController) concurrencyLimit() bool {
-	//nolint:gosec //We are never going to overflow this
-	return n.dispatched >= int32(n.concurrency)
+// subjectKind returns the condition kind from the subject the condition was queued on - see ConditionSubject().
+func subjectKind(subject string) condition.Kind {
+	return condition.Kind(subject[strings.LastIndex(subject, ".")+1:])
+}
+
+// kindHandlerTimeout returns the handler timeout for conditions of the kind.
+func (n *NatsController) kindHandlerTimeout(kind condition.Kind) time.Duration {
+	if limits, exists := n.kindLimits[kind]; exists && limits.HandlerTimeout > 0 {
+		return limits.HandlerTimeout
+	}
+
+	return n.handlerTimeout
+}
+
+// kindConcurrency returns the concurrency limit for conditions of the kind.
+func (n *NatsController) kindConcurrency(kind condition.Kind) int {
+	if limits, exists := n.kindLimits[kind]; exists && limits.Concurrency > 0 {
+		return limits.Concurrency
+	}
+
+	return n.concurrency
+}
+
+// concurrencyLimit returns true when the in-flight conditions of the kind are at the concurrency limit for the kind.
+func (n *NatsController) concurrencyLimit(kind condition.Kind) bool {
+	n.dispatchMu.Lock()
+	defer n.dispatchMu.Unlock()
+
+	return n.dispatchedKinds[kind] >= n.kindConcurrency(kind)
+}
+
+func (n *NatsController) dispatch(kind condition.Kind) {
+	n.dispatchMu.Lock()
+	defer n.dispatchMu.Unlock()
+
+	if n.dispatchedKinds == nil {
+		n.dispatchedKinds = map[condition.Kind]int{}
+	}
+
+	n.dispatchedKinds[kind]++
+	atomic.AddInt32(&n.dispatched, 1)
+	metricsConditionInflight(kind, 1)
+}
+
+func (n *NatsController) release(kind condition.Kind) {
+	n.dispatchMu.Lock()
+	defer n.dispatchMu.Unlock()
+
+	n.dispatchedKinds[kind]--
+	atomic.AddInt32(&n.dispatched, -1)
+	metricsConditionInflight(kind, -1)
 }
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -55,6 +57,23 @@ func TestNewNatsControllerWithOptions(t *testing.T) {
 				assert.Equal(t, 15*time.Minute, nc.handlerTimeout, "handlerTimeout should match the expected value")
 			},
 		},
+		{
+			name: "WithKindLimits",
+			option: WithKindLimits(map[condition.Kind]KindLimits{
+				condition.Inventory: {Concurrency: 20, HandlerTimeout: 10 * time.Minute},
+			}),
+			validate: func(t *testing.T, nc *NatsController) {
+				assert.Equal(t, 20, nc.kindLimits[condition.Inventory].Concurrency, "kind concurrency should match the expected value")
+				assert.Equal(t, 10*time.Minute, nc.kindLimits[condition.Inventory].HandlerTimeout, "kind handlerTimeout should match the expected value")
+			},
+		},
+		{
+			name:   "WithDrainTimeout",
+			option: WithDrainTimeout(30 * time.Minute),
+			validate: func(t *testing.T, nc *NatsController) {
+				assert.Equal(t, 30*time.Minute, nc.drainTimeout, "drainTimeout should match the expected value")
+			},
+		},
 		{
 			name:   "WithConnectionTimeout",
 			option: WithConnectionTimeout(45 * time.Second),
@@ -95,6 +114,122 @@ func TestNatsControllerDefaultParameters(t *testing.T) {
 	assert.Equal(t, pullEventTimeout, c.pullEventTimeout, "pullEventTimeout should match the expected default value")
 	assert.Equal(t, concurrency, c.concurrency, "concurrency should match the expected default value")
 	assert.Equal(t, kvReplicationFactor, c.natsConfig.KVReplicationFactor, "kv replicas should match the expected default value")
+	assert.Equal(t, drainTimeout, c.drainTimeout, "drainTimeout should match the expected default value")
+}
+
+func TestKindLimits(t *testing.T) {
+	n := &NatsController{
+		concurrency:    2,
+		handlerTimeout: handlerTimeout,
+		kindLimits: map[condition.Kind]KindLimits{
+			condition.Inventory:       {Concurrency: 3, HandlerTimeout: 10 * time.Minute},
+			condition.FirmwareInstall: {Concurrency: 1},
+		},
+	}
+
+	assert.Equal(t, condition.FirmwareInstall, subjectKind(ConditionSubject("fc13", condition.FirmwareInstall)))
+	assert.Equal(t, condition.Inventory, subjectKind(ConditionSubject("fc13", condition.Inventory)))
+
+	// handler timeouts
+	assert.Equal(t, 10*time.Minute, n.kindHandlerTimeout(condition.Inventory))
+	assert.Equal(t, handlerTimeout, n.kindHandlerTimeout(condition.FirmwareInstall), "expected the default handler timeout")
+	assert.Equal(t, handlerTimeout, n.kindHandlerTimeout(condition.Kind("foo")), "expected the default handler timeout")
+
+	// the firmwareInstall limit is reached
+	n.dispatch(condition.FirmwareInstall)
+	assert.True(t, n.concurrencyLimit(condition.FirmwareInstall))
+
+	// while inventory conditions continue to be accepted
+	for i := 0; i < 3; i++ {
+		assert.False(t, n.concurrencyLimit(condition.Inventory))
+		n.dispatch(condition.Inventory)
+	}
+
+	assert.True(t, n.concurrencyLimit(condition.Inventory))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&n.dispatched))
+
+	// kinds without limits are limited by the controller concurrency
+	n.dispatch(condition.Kind("foo"))
+	assert.False(t, n.concurrencyLimit(condition.Kind("foo")))
+	n.dispatch(condition.Kind("foo"))
+	assert.True(t, n.concurrencyLimit(condition.Kind("foo")))
+
+	n.release(condition.FirmwareInstall)
+	assert.False(t, n.concurrencyLimit(condition.FirmwareInstall))
+	assert.True(t, n.concurrencyLimit(condition.Inventory))
+	assert.Equal(t, int32(5), atomic.LoadInt32(&n.dispatched))
+}
+
+func TestProcessEventsKindLimits(t *testing.T) {
+	l := logrus.New()
+	l.SetOutput(io.Discard) // unset this to debug
+
+	firmwareInstallSubject := ConditionSubject("fc13", condition.FirmwareInstall)
+	inventorySubject := ConditionSubject("fc13", condition.Inventory)
+
+	newController := func(t *testing.T, stream events.Stream) *NatsController {
+		lv := NewMockLivenessCheckin(t)
+		lv.On("ControllerID").Return(registry.GetID("test"))
+
+		return &NatsController{
+			stream:   stream,
+			logger:   l,
+			syncWG:   &sync.WaitGroup{},
+			liveness: lv,
+			natsConfig: events.NatsOptions{
+				Consumer: &events.NatsConsumerOptions{
+					SubscribeSubjects: []string{firmwareInstallSubject, inventorySubject},
+				},
+			},
+			pullEventTimeout: time.Second,
+			concurrency:      2,
+			kindLimits: map[condition.Kind]KindLimits{
+				condition.FirmwareInstall: {Concurrency: 1},
+			},
+		}
+	}
+
+	// the inventory message is nacked since the controller has no condition kinds configured
+	inventoryMsg := func(t *testing.T) events.Message {
+		cond := &condition.Condition{ID: uuid.New(), Kind: condition.Inventory}
+		data, err := json.Marshal(cond)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg := events.NewMockMessage(t)
+		msg.On("Data").Return(data)
+		msg.On("Subject").Return(inventorySubject).Maybe()
+		msg.On("Nak").Return(nil).Once()
+
+		return msg
+	}
+
+	t.Run("kind at its concurrency limit does not block other kinds", func(t *testing.T) {
+		stream := events.NewMockStream(t)
+		stream.On("PullOneMsg", mock.Anything, inventorySubject).Return(inventoryMsg(t), nil).Once()
+
+		n := newController(t, stream)
+		n.dispatch(condition.FirmwareInstall)
+
+		assert.Nil(t, n.processEvents(context.Background()))
+		n.syncWG.Wait()
+
+		stream.AssertNotCalled(t, "PullOneMsg", mock.Anything, firmwareInstallSubject)
+	})
+
+	t.Run("kind with no new events does not block other kinds", func(t *testing.T) {
+		stream := events.NewMockStream(t)
+		stream.On("PullOneMsg", mock.Anything, firmwareInstallSubject).Return(nil, events.ErrNatsMsgPull).Once()
+		stream.On("PullOneMsg", mock.Anything, inventorySubject).Return(inventoryMsg(t), nil).Once()
+
+		n := newController(t, stream)
+
+		assert.Nil(t, n.processEvents(context.Background()))
+		n.syncWG.Wait()
+
+		assert.Equal(t, int32(0), atomic.LoadInt32(&n.dispatched))
+	})
 }
 
 func TestStateFinalized(t *testing.T) {
@@ -437,3 +572,78 @@ func TestRunTaskHandlerWithMonitor(t *testing.T) {
 		})
 	}
 }
+
+func TestDrain(t *testing.T) {
+	l := logrus.New()
+	l.SetOutput(io.Discard) // unset this to debug
+
+	t.Run("in-flight conditions complete", func(t *testing.T) {
+		n := &NatsController{logger: l, syncWG: &sync.WaitGroup{}, drainTimeout: time.Minute}
+
+		handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+		defer cancelHandlers()
+
+		var completed atomic.Bool
+		n.syncWG.Add(1)
+		go func() {
+			defer n.syncWG.Done()
+			time.Sleep(50 * time.Millisecond)
+			completed.Store(true)
+		}()
+
+		n.drain(context.Background(), cancelHandlers)
+
+		assert.True(t, completed.Load())
+		assert.Nil(t, handlerCtx.Err())
+	})
+
+	t.Run("drain timeout cancels in-flight conditions", func(t *testing.T) {
+		n := &NatsController{logger: l, syncWG: &sync.WaitGroup{}, drainTimeout: 50 * time.Millisecond}
+
+		handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+		defer cancelHandlers()
+
+		n.syncWG.Add(1)
+		go func() {
+			defer n.syncWG.Done()
+			<-handlerCtx.Done()
+		}()
+
+		n.drain(context.Background(), cancelHandlers)
+
+		assert.NotNil(t, handlerCtx.Err())
+	})
+
+	t.Run("ListenEvents returns when drained", func(t *testing.T) {
+		srv := startJetStreamServer(t)
+		defer shutdownJetStream(t, srv)
+		natsConn, _ := jetStreamContext(t, srv) // nc is closed on evJS.Close(), js needs no cleanup
+		evJS := events.NewJetstreamFromConn(natsConn)
+		defer evJS.Close()
+
+		n := &NatsController{
+			logger:            l,
+			stream:            evJS,
+			syncWG:            &sync.WaitGroup{},
+			pullEventInterval: time.Hour,
+			drainTimeout:      time.Minute,
+			drainCh:           make(chan struct{}),
+		}
+
+		n.Drain()
+		// invoking Drain again is a no-op
+		n.Drain()
+
+		handlerFactory := func() TaskHandler { return NewMockTaskHandler(t) }
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- n.ListenEvents(context.Background(), handlerFactory) }()
+
+		select {
+		case err := <-errCh:
+			assert.Nil(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected ListenEvents to return once drained")
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package ctrl
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/metal-automata/rivets/condition"
+	"github.com/metal-automata/rivets/events"
+	"github.com/metal-automata/rivets/events/pkg/kv"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// EmbeddedNatsUser, EmbeddedNatsPass are the credentials to connect to the embedded NATS server.
+	//
+	// The embedded server listens on the loopback interface and is meant for local development and tests only.
+	EmbeddedNatsUser = "agent"
+	EmbeddedNatsPass = "agent"
+
+	// EmbeddedNatsPort is the default port the embedded NATS server listens on.
+	EmbeddedNatsPort = 4222
+
+	embeddedNatsReadyTimeout = 10 * time.Second
+)
+
+var (
+	errEmbeddedNats = errors.New("embedded NATS server error")
+)
+
+// EmbeddedNats is an in-process NATS Jetstream server,
+// it enables the agent to be run without a NATS deployment for local development and integration tests.
+type EmbeddedNats struct {
+	server   *server.Server
+	storeDir string
+}
+
+// StartEmbeddedNats starts a NATS Jetstream server on the loopback interface,
+// with the status KV buckets for the given condition kinds created.
+//
+// A port value of -1 has the server listen on a random port. The Jetstream data is stored in a temporary directory,
+// which is removed on Shutdown.
+func StartEmbeddedNats(port int, conditionKinds []condition.Kind) (*EmbeddedNats, error) {
+	storeDir, err := os.MkdirTemp("", "agent-nats-")
+	if err != nil {
+		return nil, errors.Wrap(errEmbeddedNats, err.Error())
+	}
+
+	opts := &server.Options{
+		ServerName: "agent-embedded",
+		Host:       "127.0.0.1",
+		Port:       port,
+		Username:   EmbeddedNatsUser,
+		Password:   EmbeddedNatsPass,
+		JetStream:  true,
+		StoreDir:   storeDir,
+		NoSigs:     true,
+	}
+
+	srv, err := server.NewServer(opts)
+	if err != nil {
+		_ = os.RemoveAll(storeDir)
+		return nil, errors.Wrap(errEmbeddedNats, err.Error())
+	}
+
+	e := &EmbeddedNats{server: srv, storeDir: storeDir}
+
+	go srv.Start()
+
+	if !srv.ReadyForConnections(embeddedNatsReadyTimeout) {
+		e.Shutdown()
+		return nil, errors.Wrap(errEmbeddedNats, "server not ready for connections")
+	}
+
+	if err := e.createStatusBuckets(conditionKinds); err != nil {
+		e.Shutdown()
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// The condition status KV buckets are expected to exist before a condition is received,
+// in a NATS deployment these are created by the Condition Orchestrator.
+func (e *EmbeddedNats) createStatusBuckets(conditionKinds []condition.Kind) error {
+	conn, err := nats.Connect(e.URL(), nats.UserInfo(EmbeddedNatsUser, EmbeddedNatsPass))
+	if err != nil {
+		return errors.Wrap(errEmbeddedNats, err.Error())
+	}
+
+	stream := events.NewJetstreamFromConn(conn)
+	defer stream.Close()
+
+	for _, kind := range conditionKinds {
+		if _, err := kv.CreateOrBindKVBucket(
+			stream,
+			string(kind),
+			kv.WithDescription(fmt.Sprintf("%s condition status tracking", kind)),
+			kv.WithTTL(kvTTL),
+		); err != nil {
+			return errors.Wrap(errEmbeddedNats, "status KV bucket create error: "+err.Error())
+		}
+	}
+
+	return nil
+}
+
+// URL returns the client URL of the embedded NATS server.
+func (e *EmbeddedNats) URL() string {
+	return e.server.ClientURL()
+}
+
+// Shutdown stops the embedded NATS server and removes its Jetstream data.
+func (e *EmbeddedNats) Shutdown() {
+	e.server.Shutdown()
+	e.server.WaitForShutdown()
+
+	_ = os.RemoveAll(e.storeDir)
+}
@@ -0,0 +1,76 @@
+package ctrl
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/metal-automata/rivets/condition"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedNats(t *testing.T) {
+	kinds := []condition.Kind{condition.FirmwareInstall, condition.Inventory}
+
+	srv, err := StartEmbeddedNats(-1, kinds)
+	require.Nil(t, err)
+	defer srv.Shutdown()
+
+	// connections without credentials are rejected
+	_, err = nats.Connect(srv.URL())
+	assert.NotNil(t, err)
+
+	conn, err := nats.Connect(srv.URL(), nats.UserInfo(EmbeddedNatsUser, EmbeddedNatsPass))
+	require.Nil(t, err)
+	defer conn.Close()
+
+	js, err := conn.JetStream()
+	require.Nil(t, err)
+
+	// the condition status KV buckets are created
+	for _, kind := range kinds {
+		_, err := js.KeyValue(string(kind))
+		assert.Nil(t, err, kind)
+	}
+
+	// the controllers stream is created by the controller on Connect
+	nc := NewNatsController("agent", "fc13", srv.URL(), "", kinds, WithStreamUserPass(EmbeddedNatsUser, EmbeddedNatsPass))
+	assert.Equal(t, EmbeddedNatsUser, nc.natsConfig.StreamUser)
+	assert.Equal(t, EmbeddedNatsPass, nc.natsConfig.StreamPass)
+
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     nc.natsConfig.Stream.Name,
+		Subjects: nc.natsConfig.Stream.Subjects,
+	})
+	require.Nil(t, err)
+
+	cond := &condition.Condition{
+		Version:    condition.ConditionStructVersion,
+		ID:         uuid.New(),
+		Target:     uuid.New(),
+		Kind:       condition.Inventory,
+		Parameters: condition.MustDefaultInventoryJSON(uuid.New()),
+		State:      condition.Pending,
+	}
+
+	require.Nil(t, EnqueueCondition(js, "fc13", cond))
+
+	// the condition is queued on the subject the controller consumes inventory conditions from
+	assert.Contains(t, nc.natsConfig.Consumer.SubscribeSubjects, ConditionSubject("fc13", condition.Inventory))
+
+	sub, err := js.PullSubscribe(ConditionSubject("fc13", condition.Inventory), "test")
+	require.Nil(t, err)
+
+	msgs, err := sub.Fetch(1, nats.MaxWait(5*time.Second))
+	require.Nil(t, err)
+	require.Len(t, msgs, 1)
+
+	got := &condition.Condition{}
+	require.Nil(t, json.Unmarshal(msgs[0].Data, got))
+	assert.Equal(t, cond.ID, got.ID)
+	assert.Equal(t, cond.Target, got.Target)
+	assert.Equal(t, condition.Inventory, got.Kind)
+}
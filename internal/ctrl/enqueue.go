@@ -0,0 +1,30 @@
+package ctrl
+
+import (
+	"encoding/json"
+
+	"github.com/metal-automata/rivets/condition"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+var (
+	errEnqueue = errors.New("condition enqueue error")
+)
+
+// EnqueueCondition publishes the condition on the controllers stream for the controllers in the facility to act on.
+//
+// In a NATS deployment conditions are queued by the Condition Orchestrator,
+// this is intended for local development against the embedded NATS server.
+func EnqueueCondition(js nats.JetStreamContext, facilityCode string, cond *condition.Condition) error {
+	data, err := json.Marshal(cond)
+	if err != nil {
+		return errors.Wrap(errEnqueue, err.Error())
+	}
+
+	if _, err := js.Publish(ConditionSubject(facilityCode, cond.Kind), data); err != nil {
+		return errors.Wrap(errEnqueue, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package ctrl
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/metal-automata/agent/internal/model"
+	"github.com/metal-automata/rivets/condition"
+	"github.com/metal-automata/rivets/events"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNotReady = errors.New("controller not ready")
+)
+
+// InflightCondition is a condition being handled by the controller, listed on the status endpoint.
+type InflightCondition struct {
+	ID       string         `json:"id"`
+	Kind     condition.Kind `json:"kind"`
+	ServerID string         `json:"serverID"`
+	// Action is the ID of the firmware install action running
+	Action string `json:"action,omitempty"`
+	// Step is the name of the action step running
+	Step      string    `json:"step,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	Elapsed   string    `json:"elapsed"`
+}
+
+// ControllerStatus is the controller status served on the status endpoint.
+type ControllerStatus struct {
+	ControllerID string              `json:"controllerID,omitempty"`
+	FacilityCode string              `json:"facilityCode"`
+	Draining     bool                `json:"draining"`
+	LastCheckin  time.Time           `json:"lastCheckin,omitempty"`
+	Conditions   []InflightCondition `json:"conditions"`
+}
+
+// inflightConditions tracks the conditions being handled by the controller.
+type inflightConditions struct {
+	mu         sync.Mutex
+	conditions map[string]*InflightCondition
+}
+
+func (i *inflightConditions) add(cond *condition.Condition) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.conditions == nil {
+		i.conditions = map[string]*InflightCondition{}
+	}
+
+	i.conditions[cond.ID.String()] = &InflightCondition{
+		ID:        cond.ID.String(),
+		Kind:      cond.Kind,
+		ServerID:  cond.Target.String(),
+		StartedAt: time.Now(),
+	}
+}
+
+func (i *inflightConditions) remove(conditionID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.conditions, conditionID)
+}
+
+// update sets the action and step running from the task published.
+func (i *inflightConditions) update(task *condition.Task[any, any]) {
+	action, step := taskActionStep(task)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if c, exists := i.conditions[task.ID.String()]; exists {
+		c.Action, c.Step = action, step
+	}
+}
+
+// list returns the in-flight conditions, ordered by their start time.
+func (i *inflightConditions) list() []InflightCondition {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	list := make([]InflightCondition, 0, len(i.conditions))
+	for _, c := range i.conditions {
+		ic := *c
+		ic.Elapsed = time.Since(c.StartedAt).Round(time.Second).String()
+		list = append(list, ic)
+	}
+
+	sort.Slice(list, func(a, b int) bool { return list[a].StartedAt.Before(list[b].StartedAt) })
+
+	return list
+}
+
+// taskActionStep returns the firmware install action and step running, from the task data.
+func taskActionStep(task *condition.Task[any, any]) (action, step string) {
+	if task.Kind != condition.FirmwareInstall && task.Kind != condition.FirmwareInstallInband {
+		return "", ""
+	}
+
+	var raw []byte
+	switch v := task.Data.(type) {
+	case json.RawMessage:
+		raw = v
+	case []byte:
+		raw = v
+	default:
+		return "", ""
+	}
+
+	data := &model.FirmwareTaskData{}
+	if err := data.Unmarshal(raw); err != nil {
+		return "", ""
+	}
+
+	return data.ActiveActionStep()
+}
+
+// inflightPublisher records the action and step running for the status endpoint as the task is published.
+type inflightPublisher struct {
+	Publisher
+	inflight *inflightConditions
+}
+
+func (p *inflightPublisher) Publish(ctx context.Context, task *condition.Task[any, any], tsUpdateOnly bool) error {
+	if !tsUpdateOnly {
+		p.inflight.update(task)
+	}
+
+	return p.Publisher.Publish(ctx, task, tsUpdateOnly)
+}
+
+// Ready returns an error when the controller is not connected to NATS
+// or the controller liveness check-in has not succeeded within the check-in TTL.
+func (n *NatsController) Ready() error {
+	js, ok := n.stream.(*events.NatsJetstream)
+	if !ok || js == nil {
+		return errors.Wrap(ErrNotReady, "NATS connection not initialized")
+	}
+
+	if conn := events.AsNatsConnection(js); conn == nil || !conn.IsConnected() {
+		status := "nil"
+		if conn != nil {
+			status = conn.Status().String()
+		}
+
+		return errors.Wrap(ErrNotReady, "NATS connection status: "+status)
+	}
+
+	if n.liveness == nil {
+		return errors.Wrap(ErrNotReady, "liveness check-in not started")
+	}
+
+	lastCheckin := n.liveness.LastCheckin()
+	if lastCheckin.IsZero() {
+		return errors.Wrap(ErrNotReady, "no successful liveness check-in")
+	}
+
+	if since := time.Since(lastCheckin); since > checkinLivenessTTL {
+		return errors.Wrap(ErrNotReady, "last successful liveness check-in "+since.Round(time.Second).String()+" ago")
+	}
+
+	return nil
+}
+
+// Status returns the controller status and the in-flight conditions.
+func (n *NatsController) Status() ControllerStatus {
+	status := ControllerStatus{
+		FacilityCode: n.facilityCode,
+		Conditions:   n.inflight.list(),
+	}
+
+	select {
+	case <-n.drainCh:
+		status.Draining = true
+	default:
+	}
+
+	if n.liveness != nil {
+		status.ControllerID = n.liveness.ControllerID().String()
+		status.LastCheckin = n.liveness.LastCheckin()
+	}
+
+	return status
+}
+
+// StatusHandler returns the http handler for the controller status endpoint.
+func (n *NatsController) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(n.Status()); err != nil {
+			n.logger.WithError(err).Warn("status endpoint response error")
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package ctrl
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/metal-automata/agent/internal/model"
+	"github.com/metal-automata/rivets/condition"
+	"github.com/metal-automata/rivets/events"
+	"github.com/metal-automata/rivets/events/registry"
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReady(t *testing.T) {
+	srv, err := StartEmbeddedNats(-1, []condition.Kind{condition.Inventory})
+	require.Nil(t, err)
+	defer srv.Shutdown()
+
+	conn, err := nats.Connect(srv.URL(), nats.UserInfo(EmbeddedNatsUser, EmbeddedNatsPass))
+	require.Nil(t, err)
+	defer conn.Close()
+
+	tests := []struct {
+		name        string
+		stream      events.Stream
+		lastCheckin time.Time
+		expectedErr string
+	}{
+		{
+			name:        "not connected",
+			expectedErr: "NATS connection not initialized",
+		},
+		{
+			name:        "no check-in",
+			stream:      events.NewJetstreamFromConn(conn),
+			expectedErr: "no successful liveness check-in",
+		},
+		{
+			name:        "stale check-in",
+			stream:      events.NewJetstreamFromConn(conn),
+			lastCheckin: time.Now().Add(-10 * time.Minute),
+			expectedErr: "last successful liveness check-in 10m0s ago",
+		},
+		{
+			name:        "ready",
+			stream:      events.NewJetstreamFromConn(conn),
+			lastCheckin: time.Now().Add(-time.Minute),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			liveness := NewMockLivenessCheckin(t)
+			liveness.On("LastCheckin").Return(tt.lastCheckin).Maybe()
+
+			n := &NatsController{stream: tt.stream, liveness: liveness}
+
+			err := n.Ready()
+			if tt.expectedErr != "" {
+				assert.ErrorIs(t, err, ErrNotReady)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+
+				return
+			}
+
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestStatusInflightConditions(t *testing.T) {
+	liveness := NewMockLivenessCheckin(t)
+	liveness.On("ControllerID").Return(registry.GetID("test"))
+	liveness.On("LastCheckin").Return(time.Now())
+
+	n := &NatsController{logger: logrus.New(), facilityCode: "fc13", liveness: liveness, drainCh: make(chan struct{})}
+
+	cond := &condition.Condition{ID: uuid.New(), Kind: condition.FirmwareInstall, Target: uuid.New()}
+	n.inflight.add(cond)
+
+	// the task published by the firmware install handler carries the action, step running
+	data := &model.FirmwareTaskData{
+		ActionsPlanned: model.Actions{
+			{ID: "action-1", State: model.StateSucceeded},
+			{
+				ID:    "action-2",
+				State: model.StateActive,
+				Steps: model.Steps{
+					{Name: "downloadFirmware", State: model.StateSucceeded},
+					{Name: "uploadFirmware", State: model.StateActive},
+				},
+			},
+		},
+	}
+
+	dataJSON, err := data.Marshal()
+	require.Nil(t, err)
+
+	publisher := NewMockPublisher(t)
+	publisher.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	p := &inflightPublisher{Publisher: publisher, inflight: &n.inflight}
+	task := &condition.Task[any, any]{ID: cond.ID, Kind: condition.FirmwareInstall, Data: dataJSON}
+	require.Nil(t, p.Publish(context.Background(), task, false))
+
+	rec := httptest.NewRecorder()
+	n.StatusHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	got := ControllerStatus{}
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, "fc13", got.FacilityCode)
+	assert.False(t, got.Draining)
+	require.Len(t, got.Conditions, 1)
+	assert.Equal(t, cond.ID.String(), got.Conditions[0].ID)
+	assert.Equal(t, condition.FirmwareInstall, got.Conditions[0].Kind)
+	assert.Equal(t, cond.Target.String(), got.Conditions[0].ServerID)
+	assert.Equal(t, "action-2", got.Conditions[0].Action)
+	assert.Equal(t, "uploadFirmware", got.Conditions[0].Step)
+
+	n.Drain()
+	n.inflight.remove(cond.ID.String())
+
+	status := n.Status()
+	assert.True(t, status.Draining)
+	assert.Empty(t, status.Conditions)
+}
@@ -3,6 +3,7 @@ package ctrl
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/metal-automata/rivets/events"
@@ -23,6 +24,8 @@ var (
 type LivenessCheckin interface {
 	StartLivenessCheckin(ctx context.Context)
 	ControllerID() registry.ControllerID
+	// LastCheckin returns the time of the last successful check-in, a zero value is returned until the first check-in.
+	LastCheckin() time.Time
 }
 
 // NatsLiveness provides methods to register and periodically check into the controller registry.
@@ -35,6 +38,8 @@ type NatsLiveness struct {
 	controllerID registry.ControllerID
 	interval     time.Duration
 	hostname     string
+	// lastCheckin is the unix nano timestamp of the last successful check-in
+	lastCheckin atomic.Int64
 }
 
 // NewNatsLiveness returns a NATS implementation of the LivenessCheckin interface
@@ -68,6 +73,16 @@ func (n *NatsLiveness) ControllerID() registry.ControllerID {
 	return n.controllerID
 }
 
+// LastCheckin returns the time of the last successful check-in
+func (n *NatsLiveness) LastCheckin() time.Time {
+	ts := n.lastCheckin.Load()
+	if ts == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, ts)
+}
+
 // This starts a go-routine to peridically check in with the NATS kv
 func (n *NatsLiveness) StartLivenessCheckin(ctx context.Context) {
 	once.Do(func() {
@@ -86,6 +101,8 @@ func (n *NatsLiveness) StartLivenessCheckin(ctx context.Context) {
 func (n *NatsLiveness) checkinRoutine(ctx context.Context) {
 	if err := registry.RegisterController(n.controllerID); err != nil {
 		n.logger.WithError(err).Warn("unable to do initial controller liveness registration")
+	} else {
+		n.lastCheckin.Store(time.Now().UnixNano())
 	}
 
 	tick := time.NewTicker(n.interval)
@@ -107,6 +124,8 @@ func (n *NatsLiveness) checkinRoutine(ctx context.Context) {
 						Fatal("unable to refresh controller liveness token")
 				}
 			}
+
+			n.lastCheckin.Store(time.Now().UnixNano())
 		case <-ctx.Done():
 			n.logger.Info("liveness check-in stopping on done context")
 			stop = true
@@ -4,54 +4,13 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/metal-automata/agent/internal/metrics"
 	"github.com/metal-automata/rivets/condition"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
-var (
-	metricsNATSErrors              *prometheus.CounterVec
-	metricsEventCounter            *prometheus.CounterVec
-	metricsConditionRunTimeSummary *prometheus.SummaryVec
-	metricsNATSConnectTime         *prometheus.SummaryVec
-)
-
-func init() {
-	metricsNATSErrors = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "nats_errors",
-			Help: "A count of errors while trying to use NATS.",
-		},
-		[]string{"operation"},
-	)
-
-	metricsEventCounter = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "events_received",
-			Help: "A counter metric to measure the total count of events received",
-		},
-		[]string{"valid", "response"}, // valid is true/false, response is ack/nack
-	)
-
-	metricsConditionRunTimeSummary = promauto.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Name: "condition_duration_seconds",
-			Help: "A summary metric to measure the total time spent in completing each condition",
-		},
-		[]string{"condition", "state"},
-	)
-
-	metricsNATSConnectTime = promauto.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Name: "nats_connection_time",
-			Help: "A summary metric to measure the time taken to connect and subscribe to the NATS Jetstream",
-		},
-		[]string{},
-	)
-}
-
 // spanEvent adds a span event along with the given attributes.
 //
 // event here is arbitrary and can be in the form of strings like - publishCondition, updateCondition etc
@@ -64,25 +23,31 @@ func spanEvent(span trace.Span, cond *condition.Condition, controllerID, event s
 }
 
 func metricsNATSError(op string) {
-	metricsNATSErrors.WithLabelValues(op).Inc()
+	metrics.NATSError(op)
 }
 
 func registerNATSConnectTimeMetric(startTS time.Time) {
-	metricsNATSConnectTime.With(prometheus.Labels{}).Observe(time.Since(startTS).Seconds())
+	metrics.NATSConnectDuration.Observe(time.Since(startTS).Seconds())
 }
 
 func metricsEventsCounter(valid bool, response string) {
-	metricsEventCounter.With(
+	metrics.EventsCounter.With(
 		prometheus.Labels{
 			"valid":    strconv.FormatBool(valid),
 			"response": response,
 		}).Inc()
 }
-func registerConditionRuntimeMetric(startTS time.Time, state string) {
-	metricsConditionRunTimeSummary.With(
+
+func registerConditionRuntimeMetric(kind condition.Kind, startTS time.Time, state string) {
+	metrics.ConditionRunTimeSummary.With(
 		prometheus.Labels{
-			"condition": string(condition.FirmwareInstall),
+			"condition": string(kind),
 			"state":     state,
 		},
 	).Observe(time.Since(startTS).Seconds())
 }
+
+// metricsConditionInflight adds the delta to the in-flight conditions gauge for the condition kind.
+func metricsConditionInflight(kind condition.Kind, delta float64) {
+	metrics.ConditionsInflight.With(prometheus.Labels{"condition": string(kind)}).Add(delta)
+}
@@ -0,0 +1,72 @@
+package ctrl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/metal-automata/agent/internal/metrics"
+	"github.com/metal-automata/rivets/condition"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conditionRuntimeCount returns the count of condition runtime observations for the condition kind, state.
+func conditionRuntimeCount(t *testing.T, kind condition.Kind, state condition.State) uint64 {
+	t.Helper()
+
+	families, err := metrics.Registry.Gather()
+	require.Nil(t, err)
+
+	for _, family := range families {
+		if family.GetName() != "agent_condition_duration_seconds" {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+
+			if labels["condition"] == string(kind) && labels["state"] == string(state) {
+				return m.GetSummary().GetSampleCount()
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestConditionMetricsByKind(t *testing.T) {
+	inventoryCount := conditionRuntimeCount(t, condition.Inventory, condition.Succeeded)
+	installCount := conditionRuntimeCount(t, condition.FirmwareInstall, condition.Succeeded)
+
+	registerConditionRuntimeMetric(condition.Inventory, time.Now(), string(condition.Succeeded))
+
+	assert.Equal(t, inventoryCount+1, conditionRuntimeCount(t, condition.Inventory, condition.Succeeded))
+	assert.Equal(t, installCount, conditionRuntimeCount(t, condition.FirmwareInstall, condition.Succeeded))
+
+	inflight := func(kind condition.Kind) float64 {
+		return testutil.ToFloat64(metrics.ConditionsInflight.WithLabelValues(string(kind)))
+	}
+
+	inventoryInflight := inflight(condition.Inventory)
+	installInflight := inflight(condition.FirmwareInstall)
+
+	n := &NatsController{}
+	n.dispatch(condition.Inventory)
+	n.dispatch(condition.Inventory)
+	n.dispatch(condition.FirmwareInstall)
+
+	assert.Equal(t, inventoryInflight+2, inflight(condition.Inventory))
+	assert.Equal(t, installInflight+1, inflight(condition.FirmwareInstall))
+
+	n.release(condition.Inventory)
+	n.release(condition.FirmwareInstall)
+
+	assert.Equal(t, inventoryInflight+1, inflight(condition.Inventory))
+	assert.Equal(t, installInflight, inflight(condition.FirmwareInstall))
+
+	n.release(condition.Inventory)
+}
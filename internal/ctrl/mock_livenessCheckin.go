@@ -4,6 +4,7 @@ package ctrl
 
 import (
 	context "context"
+	time "time"
 
 	registry "github.com/metal-automata/rivets/events/registry"
 	mock "github.com/stretchr/testify/mock"
@@ -69,6 +70,51 @@ func (_c *MockLivenessCheckin_ControllerID_Call) RunAndReturn(run func() registr
 	return _c
 }
 
+// LastCheckin provides a mock function with given fields:
+func (_m *MockLivenessCheckin) LastCheckin() time.Time {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for LastCheckin")
+	}
+
+	var r0 time.Time
+	if rf, ok := ret.Get(0).(func() time.Time); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(time.Time)
+	}
+
+	return r0
+}
+
+// MockLivenessCheckin_LastCheckin_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'LastCheckin'
+type MockLivenessCheckin_LastCheckin_Call struct {
+	*mock.Call
+}
+
+// LastCheckin is a helper method to define mock.On call
+func (_e *MockLivenessCheckin_Expecter) LastCheckin() *MockLivenessCheckin_LastCheckin_Call {
+	return &MockLivenessCheckin_LastCheckin_Call{Call: _e.mock.On("LastCheckin")}
+}
+
+func (_c *MockLivenessCheckin_LastCheckin_Call) Run(run func()) *MockLivenessCheckin_LastCheckin_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockLivenessCheckin_LastCheckin_Call) Return(_a0 time.Time) *MockLivenessCheckin_LastCheckin_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockLivenessCheckin_LastCheckin_Call) RunAndReturn(run func() time.Time) *MockLivenessCheckin_LastCheckin_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // StartLivenessCheckin provides a mock function with given fields: ctx
 func (_m *MockLivenessCheckin) StartLivenessCheckin(ctx context.Context) {
 	_m.Called(ctx)
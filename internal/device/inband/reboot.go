@@ -0,0 +1,195 @@
+package inband
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+
+	"github.com/metal-automata/agent/internal/device"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// RebootKind identifies the reboot coordinator implementation
+type RebootKind string
+
+const (
+	// RebootFlagFile drops a reboot flag file for an external process to act on
+	RebootFlagFile RebootKind = "flagfile"
+	// RebootSystemd has systemd reboot the host, through systemctl or the logind D-Bus API
+	RebootSystemd RebootKind = "systemd"
+	// RebootKexec boots into the kernel with kexec, skipping the firmware POST
+	RebootKexec RebootKind = "kexec"
+	// RebootNoop does not reboot the host, for tests
+	RebootNoop RebootKind = "noop"
+
+	// DefaultRebootFlagFile is the reboot flag file acted on by the host image
+	DefaultRebootFlagFile = "/var/run/reboot"
+)
+
+var (
+	ErrReboot = errors.New("host reboot error")
+
+	// execCommand runs the command and returns its combined output, this is replaced in tests.
+	execCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		return exec.CommandContext(ctx, name, args...).CombinedOutput()
+	}
+)
+
+// RebootOptions are the parameters for the reboot coordinators
+type RebootOptions struct {
+	// FlagFile is the reboot flag file path for the flagfile coordinator - defaults to /var/run/reboot
+	FlagFile string
+
+	// SystemdDBus has the systemd coordinator request the reboot through the logind D-Bus API instead of systemctl
+	SystemdDBus bool
+
+	// KexecKernel, KexecInitrd, KexecCmdline when set, are loaded by the kexec coordinator before the kexec,
+	// otherwise the kernel previously loaded with kexec -l is booted.
+	KexecKernel  string
+	KexecInitrd  string
+	KexecCmdline string
+}
+
+// NewRebootCoordinator returns the reboot coordinator of the given kind.
+func NewRebootCoordinator(kind RebootKind, opts *RebootOptions, logger *logrus.Logger) (device.RebootCoordinator, error) {
+	if opts == nil {
+		opts = &RebootOptions{}
+	}
+
+	switch kind {
+	case RebootFlagFile, "":
+		flagFile := opts.FlagFile
+		if flagFile == "" {
+			flagFile = DefaultRebootFlagFile
+		}
+
+		return &FlagFileReboot{path: flagFile, logger: logger}, nil
+	case RebootSystemd:
+		return &SystemdReboot{dbus: opts.SystemdDBus, logger: logger}, nil
+	case RebootKexec:
+		return &KexecReboot{kernel: opts.KexecKernel, initrd: opts.KexecInitrd, cmdline: opts.KexecCmdline, logger: logger}, nil
+	case RebootNoop:
+		return &NoopReboot{}, nil
+	default:
+		return nil, errors.Wrap(ErrReboot, "unsupported reboot coordinator: "+string(kind))
+	}
+}
+
+// FlagFileReboot creates the reboot flag file, the host image is expected to reboot the host when the flag file is present.
+type FlagFileReboot struct {
+	path   string
+	logger *logrus.Logger
+}
+
+func (f *FlagFileReboot) Kind() string {
+	return string(RebootFlagFile)
+}
+
+func (f *FlagFileReboot) Reboot(_ context.Context) error {
+	fh, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Wrap(ErrReboot, err.Error())
+	}
+	defer fh.Close()
+
+	f.logger.Infof("%s reboot flag created, waiting for host power cycle..", f.path)
+
+	return nil
+}
+
+// SystemdReboot has systemd reboot the host.
+type SystemdReboot struct {
+	dbus   bool
+	logger *logrus.Logger
+}
+
+func (s *SystemdReboot) Kind() string {
+	return string(RebootSystemd)
+}
+
+func (s *SystemdReboot) Reboot(ctx context.Context) error {
+	name, args := "systemctl", []string{"reboot"}
+	if s.dbus {
+		// the logind Reboot method, the boolean parameter being the interactive flag
+		name, args = "busctl", []string{
+			"call",
+			"org.freedesktop.login1",
+			"/org/freedesktop/login1",
+			"org.freedesktop.login1.Manager",
+			"Reboot",
+			"b",
+			"false",
+		}
+	}
+
+	s.logger.WithField("cmd", name+" "+strings.Join(args, " ")).Info("requesting host reboot from systemd")
+
+	if out, err := execCommand(ctx, name, args...); err != nil {
+		return errors.Wrap(ErrReboot, err.Error()+": "+string(out))
+	}
+
+	return nil
+}
+
+// KexecReboot boots into the loaded kernel with kexec, the services on the host are stopped by systemd before the kexec.
+type KexecReboot struct {
+	kernel  string
+	initrd  string
+	cmdline string
+	logger  *logrus.Logger
+}
+
+func (k *KexecReboot) Kind() string {
+	return string(RebootKexec)
+}
+
+func (k *KexecReboot) Reboot(ctx context.Context) error {
+	if k.kernel != "" {
+		args := []string{"-l", k.kernel}
+		if k.initrd != "" {
+			args = append(args, "--initrd="+k.initrd)
+		}
+
+		if k.cmdline != "" {
+			args = append(args, "--command-line="+k.cmdline)
+		} else {
+			args = append(args, "--reuse-cmdline")
+		}
+
+		k.logger.WithField("kernel", k.kernel).Info("loading kexec kernel")
+
+		if out, err := execCommand(ctx, "kexec", args...); err != nil {
+			return errors.Wrap(ErrReboot, "kexec load: "+err.Error()+": "+string(out))
+		}
+	}
+
+	k.logger.Info("requesting kexec from systemd")
+
+	if out, err := execCommand(ctx, "systemctl", "kexec"); err != nil {
+		return errors.Wrap(ErrReboot, err.Error()+": "+string(out))
+	}
+
+	return nil
+}
+
+// NoopReboot counts the reboot requests without rebooting the host.
+type NoopReboot struct {
+	reboots atomic.Int32
+}
+
+func (n *NoopReboot) Kind() string {
+	return string(RebootNoop)
+}
+
+func (n *NoopReboot) Reboot(_ context.Context) error {
+	n.reboots.Add(1)
+	return nil
+}
+
+// Reboots returns the number of reboot requests.
+func (n *NoopReboot) Reboots() int {
+	return int(n.reboots.Load())
+}
@@ -0,0 +1,115 @@
+package inband
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebootCoordinators(t *testing.T) {
+	ctx := context.Background()
+	logger := logrus.New()
+
+	var cmds []string
+	var cmdErr error
+	origExecCommand := execCommand
+	execCommand = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		cmds = append(cmds, name+" "+strings.Join(args, " "))
+		return []byte("failed"), cmdErr
+	}
+	defer func() { execCommand = origExecCommand }()
+
+	tests := []struct {
+		name         string
+		kind         RebootKind
+		opts         *RebootOptions
+		cmdErr       error
+		expectedCmds []string
+		expectedErr  error
+	}{
+		{
+			name:         "systemctl reboot",
+			kind:         RebootSystemd,
+			expectedCmds: []string{"systemctl reboot"},
+		},
+		{
+			name: "logind D-Bus reboot",
+			kind: RebootSystemd,
+			opts: &RebootOptions{SystemdDBus: true},
+			expectedCmds: []string{
+				"busctl call org.freedesktop.login1 /org/freedesktop/login1 org.freedesktop.login1.Manager Reboot b false",
+			},
+		},
+		{
+			name: "kexec loads the kernel",
+			kind: RebootKexec,
+			opts: &RebootOptions{KexecKernel: "/boot/vmlinuz", KexecInitrd: "/boot/initrd.img", KexecCmdline: "console=ttyS0"},
+			expectedCmds: []string{
+				"kexec -l /boot/vmlinuz --initrd=/boot/initrd.img --command-line=console=ttyS0",
+				"systemctl kexec",
+			},
+		},
+		{
+			name:         "kexec the loaded kernel",
+			kind:         RebootKexec,
+			expectedCmds: []string{"systemctl kexec"},
+		},
+		{
+			name:         "command error",
+			kind:         RebootSystemd,
+			cmdErr:       errors.New("exit status 1"),
+			expectedCmds: []string{"systemctl reboot"},
+			expectedErr:  ErrReboot,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmds = nil
+			cmdErr = tt.cmdErr
+
+			rebooter, err := NewRebootCoordinator(tt.kind, tt.opts, logger)
+			require.Nil(t, err)
+			assert.Equal(t, string(tt.kind), rebooter.Kind())
+
+			err = rebooter.Reboot(ctx)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.Nil(t, err)
+			}
+
+			assert.Equal(t, tt.expectedCmds, cmds)
+		})
+	}
+
+	t.Run("flag file", func(t *testing.T) {
+		flagFile := filepath.Join(t.TempDir(), "reboot")
+
+		rebooter, err := NewRebootCoordinator("", &RebootOptions{FlagFile: flagFile}, logger)
+		require.Nil(t, err)
+		assert.Equal(t, string(RebootFlagFile), rebooter.Kind())
+
+		require.Nil(t, rebooter.Reboot(ctx))
+		assert.FileExists(t, flagFile)
+	})
+
+	t.Run("noop", func(t *testing.T) {
+		rebooter, err := NewRebootCoordinator(RebootNoop, nil, logger)
+		require.Nil(t, err)
+
+		require.Nil(t, rebooter.Reboot(ctx))
+		assert.Equal(t, 1, rebooter.(*NoopReboot).Reboots())
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := NewRebootCoordinator("halt", nil, logger)
+		assert.ErrorIs(t, err, ErrReboot)
+	})
+}
@@ -46,6 +46,15 @@ type OutofbandQueryor interface {
 	BiosConfiguration(ctx context.Context) (map[string]string, error)
 }
 
+// RebootCoordinator hands off the host reboot required to complete a firmware install inband.
+type RebootCoordinator interface {
+	// Kind returns the reboot coordinator kind
+	Kind() string
+
+	// Reboot initiates the host reboot, it returns once the reboot is handed off.
+	Reboot(ctx context.Context) error
+}
+
 type InbandQueryor interface {
 	// Inventory returns the device inventory
 	Inventory(ctx context.Context) (*common.Device, error)
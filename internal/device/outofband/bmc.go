@@ -2,10 +2,12 @@ package outofband
 
 import (
 	"context"
+	"net"
 	"os"
 	"path"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bmc-toolbox/common"
@@ -48,21 +50,62 @@ var (
 )
 
 // bmc wraps the bmclib client and implements the device.Queryor interface
+//
+// The queryor is shared by the concurrently running actions of a task,
+// the BMC queries are serialized since the client, session and install provider are shared,
+// the firmware files are uploaded on a separate session so the other actions are able to query the BMC meanwhile.
 type bmc struct {
+	mu                 sync.Mutex
 	client             *bmclib.Client
 	logger             *logrus.Entry
 	server             *rctypes.Server
 	installProvider    string
 	availableProviders []string
+	// dialContext when set, dials the connections to the BMC.
+	dialContext DialContextFunc
+	// uploadLimiter when set, limits the concurrent firmware uploads to BMCs.
+	uploadLimiter *UploadLimiter
+	// uploadWaiting when set, is invoked when a firmware upload is waiting for an upload slot.
+	uploadWaiting func(ctx context.Context)
+}
+
+// DialContextFunc dials a network connection to the given address.
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Option sets parameters on the bmc queryor
+type Option func(*bmc)
+
+// WithDialContext sets the func to dial the BMC connections with,
+// this enables tests to direct the BMC connections to a simulated BMC.
+func WithDialContext(dial DialContextFunc) Option {
+	return func(b *bmc) {
+		b.dialContext = dial
+	}
+}
+
+// WithUploadLimiter sets the limiter for concurrent firmware uploads,
+// the waiting func when set is invoked when the firmware upload has to wait for an upload slot.
+func WithUploadLimiter(limiter *UploadLimiter, waiting func(ctx context.Context)) Option {
+	return func(b *bmc) {
+		b.uploadLimiter = limiter
+		b.uploadWaiting = waiting
+	}
 }
 
 // NewDeviceQueryor returns a bmc queryor that implements the DeviceQueryor interface
-func NewDeviceQueryor(server *rctypes.Server, logger *logrus.Entry) device.OutofbandQueryor {
-	return &bmc{
-		client: newBmclibv2Client(server, logger),
+func NewDeviceQueryor(server *rctypes.Server, logger *logrus.Entry, options ...Option) device.OutofbandQueryor {
+	b := &bmc{
 		logger: logger,
 		server: server,
 	}
+
+	for _, opt := range options {
+		opt(b)
+	}
+
+	b.client = newBmclibv2Client(server, logger, b.dialContext)
+
+	return b
 }
 
 type ErrBmcQuery struct {
@@ -102,8 +145,15 @@ func (b *bmc) tracelog() {
 		}).Trace(funcName + ": connection metadata")
 }
 
-func (b *bmc) ReinitializeClient(context.Context) {
-	newclient := newBmclibv2Client(b.server, b.logger)
+func (b *bmc) ReinitializeClient(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.reinitializeClient(ctx)
+}
+
+func (b *bmc) reinitializeClient(context.Context) {
+	newclient := newBmclibv2Client(b.server, b.logger, b.dialContext)
 	b.client = newclient
 
 	b.logger.WithFields(
@@ -115,6 +165,13 @@ func (b *bmc) ReinitializeClient(context.Context) {
 
 // Open creates a BMC session
 func (b *bmc) Open(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.open(ctx)
+}
+
+func (b *bmc) open(ctx context.Context) error {
 	if b.client == nil {
 		return errors.Wrap(errBMCLogin, "bmclib client not initialized")
 	}
@@ -128,6 +185,7 @@ func (b *bmc) Open(ctx context.Context) error {
 
 	// login to the bmc with retries
 	if err := b.loginWithRetries(ctx, loginAttempts, provider); err != nil {
+		b.registerQueryErrorMetric("Open", err)
 		return err
 	}
 
@@ -141,6 +199,9 @@ func (b *bmc) Open(ctx context.Context) error {
 
 // Close logs out of the BMC
 func (b *bmc) Close(traceCtx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	if b.client == nil {
 		return nil
 	}
@@ -161,7 +222,10 @@ func (b *bmc) Close(traceCtx context.Context) error {
 
 // PowerStatus returns the device power status
 func (b *bmc) PowerStatus(ctx context.Context) (string, error) {
-	if err := b.Open(ctx); err != nil {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.open(ctx); err != nil {
 		return "", err
 	}
 
@@ -171,12 +235,18 @@ func (b *bmc) PowerStatus(ctx context.Context) (string, error) {
 	}
 
 	defer b.tracelog()
-	return b.with(provider).GetPowerState(ctx)
+	state, err := b.with(provider).GetPowerState(ctx)
+	b.registerQueryErrorMetric("PowerStatus", err)
+
+	return state, err
 }
 
 // SetPowerState sets the given power state on the device
 func (b *bmc) SetPowerState(ctx context.Context, state string) error {
-	if err := b.Open(ctx); err != nil {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.open(ctx); err != nil {
 		return err
 	}
 
@@ -187,13 +257,17 @@ func (b *bmc) SetPowerState(ctx context.Context, state string) error {
 
 	defer b.tracelog()
 	_, err = b.with(provider).SetPowerState(ctx, state)
+	b.registerQueryErrorMetric("SetPowerState", err)
 
 	return err
 }
 
 // ResetBMC cold resets the BMC
 func (b *bmc) ResetBMC(ctx context.Context) error {
-	if err := b.Open(ctx); err != nil {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.open(ctx); err != nil {
 		return err
 	}
 
@@ -207,15 +281,20 @@ func (b *bmc) ResetBMC(ctx context.Context) error {
 	// BMCs may or may not return an error when resetting
 	// either way we re-initialize the client to make sure
 	// we're not re-using old session/cookies.
-	defer b.ReinitializeClient(ctx)
+	defer b.reinitializeClient(ctx)
 
 	_, err = b.with(provider).ResetBMC(ctx, "GracefulRestart")
+	b.registerQueryErrorMetric("ResetBMC", err)
+
 	return err
 }
 
 // Inventory queries the BMC for the device inventory and returns an object with the device inventory.
 func (b *bmc) Inventory(ctx context.Context) (*common.Device, error) {
-	if err := b.Open(ctx); err != nil {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.open(ctx); err != nil {
 		return nil, err
 	}
 
@@ -226,7 +305,8 @@ func (b *bmc) Inventory(ctx context.Context) (*common.Device, error) {
 
 	inventory, err := b.with(provider).Inventory(ctx)
 	if err != nil {
-		// increment inventory query error count metric
+		b.registerQueryErrorMetric("Inventory", err)
+
 		if strings.Contains(err.Error(), "no compatible System Odata IDs identified") {
 			return nil, errors.Wrap(errBMCInventory, "redfish_incompatible: no compatible System Odata IDs identified")
 		}
@@ -242,7 +322,10 @@ func (b *bmc) Inventory(ctx context.Context) (*common.Device, error) {
 }
 
 func (b *bmc) FirmwareInstallSteps(ctx context.Context, component string) (steps []bconsts.FirmwareInstallStep, err error) {
-	err = b.Open(ctx)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err = b.open(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -250,6 +333,7 @@ func (b *bmc) FirmwareInstallSteps(ctx context.Context, component string) (steps
 	defer b.tracelog()
 	steps, err = b.client.FirmwareInstallSteps(ctx, component)
 	if err != nil {
+		b.registerQueryErrorMetric("FirmwareInstallSteps", err)
 		return nil, err
 	}
 
@@ -271,26 +355,41 @@ func (b *bmc) FirmwareInstallSteps(ctx context.Context, component string) (steps
 }
 
 func (b *bmc) FirmwareInstallUploadAndInitiate(ctx context.Context, component string, file *os.File) (taskID string, err error) {
-	err = b.Open(ctx)
+	// the upload slot is acquired before the BMC is locked,
+	// so the other actions are able to query the BMC while this upload is waiting.
+	release, err := b.acquireUploadSlot(ctx)
 	if err != nil {
 		return "", err
 	}
+	defer release()
 
-	provider, err := b.provider()
+	session, err := b.uploadSession(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer session.closeUploadSession(ctx)
+
+	provider, err := session.provider()
 	if err != nil {
-		return "", errors.Wrap(ErrQueryorMethod, "Inventory: "+err.Error())
+		return "", errors.Wrap(ErrQueryorMethod, "FirmwareInstallUploadAndInitiate: "+err.Error())
 	}
 
 	installCtx, cancel := context.WithTimeout(ctx, firmwareInstallTimeout)
 	defer cancel()
 
-	defer b.tracelog()
-	return b.with(provider).FirmwareInstallUploadAndInitiate(installCtx, component, file)
+	defer session.tracelog()
+	taskID, err = session.with(provider).FirmwareInstallUploadAndInitiate(installCtx, component, file)
+	b.registerQueryErrorMetric("FirmwareInstallUploadAndInitiate", err)
+
+	return taskID, err
 }
 
 // FirmwareTaskStatus looks up the firmware upload/install state and status values
 func (b *bmc) FirmwareTaskStatus(ctx context.Context, kind bconsts.FirmwareInstallStep, component, taskID, installVersion string) (state bconsts.TaskState, status string, err error) {
-	if err = b.Open(ctx); err != nil {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err = b.open(ctx); err != nil {
 		return "", "", errors.Wrap(ErrBMCQuery, err.Error())
 	}
 
@@ -301,17 +400,27 @@ func (b *bmc) FirmwareTaskStatus(ctx context.Context, kind bconsts.FirmwareInsta
 
 	defer b.tracelog()
 	state, status, err = b.with(provider).FirmwareTaskStatus(ctx, kind, component, taskID, installVersion)
+	b.registerQueryErrorMetric("FirmwareTaskStatus", err)
 
 	return state, status, err
 }
 
 func (b *bmc) FirmwareUpload(ctx context.Context, component string, file *os.File) (uploadTaskID string, err error) {
-	err = b.Open(ctx)
+	// the upload slot is acquired before the BMC is locked,
+	// so the other actions are able to query the BMC while this upload is waiting.
+	release, err := b.acquireUploadSlot(ctx)
 	if err != nil {
 		return "", err
 	}
+	defer release()
 
-	provider, err := b.provider()
+	session, err := b.uploadSession(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer session.closeUploadSession(ctx)
+
+	provider, err := session.provider()
 	if err != nil {
 		return "", errors.Wrap(ErrQueryorMethod, "FirmwareUpload: "+err.Error())
 	}
@@ -319,12 +428,18 @@ func (b *bmc) FirmwareUpload(ctx context.Context, component string, file *os.Fil
 	installCtx, cancel := context.WithTimeout(ctx, firmwareInstallTimeout)
 	defer cancel()
 
-	defer b.tracelog()
-	return b.with(provider).FirmwareUpload(installCtx, component, file)
+	defer session.tracelog()
+	uploadTaskID, err = session.with(provider).FirmwareUpload(installCtx, component, file)
+	b.registerQueryErrorMetric("FirmwareUpload", err)
+
+	return uploadTaskID, err
 }
 
 func (b *bmc) FirmwareInstallUploaded(ctx context.Context, component, uploadVerifyTaskID string) (installTaskID string, err error) {
-	err = b.Open(ctx)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err = b.open(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -338,11 +453,64 @@ func (b *bmc) FirmwareInstallUploaded(ctx context.Context, component, uploadVeri
 	defer cancel()
 
 	defer b.tracelog()
-	return b.with(provider).FirmwareInstallUploaded(installCtx, component, uploadVerifyTaskID)
+	installTaskID, err = b.with(provider).FirmwareInstallUploaded(installCtx, component, uploadVerifyTaskID)
+	b.registerQueryErrorMetric("FirmwareInstallUploaded", err)
+
+	return installTaskID, err
+}
+
+// uploadSession returns a bmc queryor with its own BMC session to upload a firmware file with.
+//
+// The shared session sends a single request at a time, uploading on it would block
+// the other actions of the task from querying the BMC until the upload completes.
+func (b *bmc) uploadSession(ctx context.Context) (*bmc, error) {
+	b.mu.Lock()
+	// the install provider identified on the shared session is carried over
+	session := &bmc{
+		logger:          b.logger,
+		server:          b.server,
+		dialContext:     b.dialContext,
+		installProvider: b.installProvider,
+	}
+	b.mu.Unlock()
+
+	session.client = newBmclibv2Client(session.server, session.logger, session.dialContext)
+	if err := session.open(ctx); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// closeUploadSession logs out of the upload session, a logout error is only logged since the upload is done.
+func (b *bmc) closeUploadSession(ctx context.Context) {
+	if err := b.Close(ctx); err != nil {
+		b.logger.WithError(err).Warn("upload session logout error")
+	}
+}
+
+// acquireUploadSlot waits for a firmware upload slot when an upload limiter is set,
+// the returned func releases the upload slot.
+func (b *bmc) acquireUploadSlot(ctx context.Context) (release func(), err error) {
+	if b.uploadLimiter == nil {
+		return func() {}, nil
+	}
+
+	waiting := func() {
+		b.logger.Info("waiting for upload slot")
+		if b.uploadWaiting != nil {
+			b.uploadWaiting(ctx)
+		}
+	}
+
+	return b.uploadLimiter.Acquire(ctx, b.server.BMC.IPAddress, waiting)
 }
 
 func (b *bmc) BiosConfiguration(ctx context.Context) (map[string]string, error) {
-	err := b.Open(ctx)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err := b.open(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -352,5 +520,8 @@ func (b *bmc) BiosConfiguration(ctx context.Context) (map[string]string, error)
 		return nil, errors.Wrap(ErrQueryorMethod, "BiosConfiguration: "+err.Error())
 	}
 
-	return b.with(provider).GetBiosConfiguration(ctx)
+	config, err := b.with(provider).GetBiosConfiguration(ctx)
+	b.registerQueryErrorMetric("BiosConfiguration", err)
+
+	return config, err
 }
@@ -16,8 +16,10 @@ import (
 	"github.com/bmc-toolbox/bmclib/v2/providers"
 	"github.com/hashicorp/go-multierror"
 	"github.com/jpillora/backoff"
+	"github.com/metal-automata/agent/internal/metrics"
 	"github.com/metal-automata/agent/internal/model"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel"
 	"golang.org/x/exp/slices"
@@ -48,33 +50,41 @@ func BmcResetParams(steps []constants.FirmwareInstallStep) (bmcResetOnInstallFai
 	return bmcResetOnInstallFailure, bmcResetPostInstall
 }
 
-func newHTTPClient() *http.Client {
+func newHTTPClient(dial DialContextFunc) *http.Client {
 	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
 	if err != nil {
 		panic(err)
 	}
 
+	// nolint:gomnd // time duration declarations are clear as is.
+	transport := &http.Transport{
+		// nolint:gosec // BMCs don't have valid certs.
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+		Dial: (&net.Dialer{
+			Timeout:   180 * time.Second,
+			KeepAlive: 180 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout:   180 * time.Second,
+		ResponseHeaderTimeout: 600 * time.Second,
+		IdleConnTimeout:       180 * time.Second,
+	}
+
+	// the DialContext func takes precedence over Dial
+	if dial != nil {
+		transport.DialContext = dial
+	}
+
 	// nolint:gomnd // time duration declarations are clear as is.
 	return &http.Client{
-		Timeout: time.Second * 600,
-		Jar:     jar,
-		Transport: &http.Transport{
-			// nolint:gosec // BMCs don't have valid certs.
-			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-			DisableKeepAlives: true,
-			Dial: (&net.Dialer{
-				Timeout:   180 * time.Second,
-				KeepAlive: 180 * time.Second,
-			}).Dial,
-			TLSHandshakeTimeout:   180 * time.Second,
-			ResponseHeaderTimeout: 600 * time.Second,
-			IdleConnTimeout:       180 * time.Second,
-		},
+		Timeout:   time.Second * 600,
+		Jar:       jar,
+		Transport: transport,
 	}
 }
 
 // newBmclibv2Client initializes a bmclib client with the given credentials
-func newBmclibv2Client(server *rctypes.Server, l *logrus.Entry) *bmclib.Client {
+func newBmclibv2Client(server *rctypes.Server, l *logrus.Entry, dial DialContextFunc) *bmclib.Client {
 	logger := logrus.New()
 	if l != nil {
 		logger.Formatter = l.Logger.Formatter
@@ -98,7 +108,7 @@ func newBmclibv2Client(server *rctypes.Server, l *logrus.Entry) *bmclib.Client {
 		server.BMC.Username,
 		server.BMC.Password,
 		bmclib.WithLogger(logruslogr),
-		bmclib.WithHTTPClient(newHTTPClient()),
+		bmclib.WithHTTPClient(newHTTPClient(dial)),
 		bmclib.WithPerProviderTimeout(loginTimeout),
 		bmclib.WithRedfishEtagMatchDisabled(true),
 		bmclib.WithTracerProvider(otel.GetTracerProvider()),
@@ -294,7 +304,7 @@ func (b *bmc) retry(ctx context.Context, maxAttempts, attempts int, cause error,
 	// The bmclib client is re-initialized only if it was previously
 	// connected successfully with a provider - set as installProvider
 	if b.installProvider != "" {
-		b.ReinitializeClient(ctx)
+		b.reinitializeClient(ctx)
 	}
 
 	attempts++
@@ -318,6 +328,21 @@ func (b *bmc) installProviderAvailable() bool {
 	)
 }
 
+// registerQueryErrorMetric increments the BMC query error count when the query returned an error.
+func (b *bmc) registerQueryErrorMetric(queryKind string, err error) {
+	if err == nil {
+		return
+	}
+
+	metrics.BMCQueryErrorCount.With(
+		prometheus.Labels{
+			"vendor":    b.server.Vendor,
+			"model":     b.server.Model,
+			"queryKind": queryKind,
+		},
+	).Inc()
+}
+
 func (b *bmc) provider() (string, error) {
 	// the install provider is set after firmware install steps is queried
 	if b.installProvider != "" {
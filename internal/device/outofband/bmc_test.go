@@ -0,0 +1,206 @@
+package outofband
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/metal-automata/agent/internal/device/outofband/simulator"
+	"github.com/metal-automata/agent/internal/model"
+	rctypes "github.com/metal-automata/rivets/condition"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBMC(t *testing.T, sim *simulator.Simulator) *bmc {
+	t.Helper()
+
+	server := &rctypes.Server{
+		Vendor: simulator.Vendor,
+		BMC: &rctypes.BMC{
+			Username:  "foo",
+			Password:  "bar",
+			IPAddress: "127.0.0.1",
+		},
+	}
+
+	b := NewDeviceQueryor(server, logrus.NewEntry(logrus.New()), WithDialContext(sim.DialContext)).(*bmc)
+	t.Cleanup(func() { _ = b.Close(context.Background()) })
+
+	return b
+}
+
+func TestBMCSimulator(t *testing.T) {
+	// skip the login retry delays
+	t.Setenv(model.EnvTesting, "1")
+
+	ctx := context.Background()
+
+	t.Run("power state is queried and set", func(t *testing.T) {
+		sim := simulator.New()
+		defer sim.Close()
+
+		b := newTestBMC(t, sim)
+
+		state, err := b.PowerStatus(ctx)
+		require.Nil(t, err)
+		assert.Equal(t, "On", state)
+
+		require.Nil(t, b.SetPowerState(ctx, "off"))
+		assert.Equal(t, simulator.PowerStateOff, sim.PowerState())
+
+		require.Nil(t, b.SetPowerState(ctx, "on"))
+		assert.Equal(t, []string{"ForceOff", "On"}, sim.PowerActions())
+	})
+
+	t.Run("inventory includes the installed firmware", func(t *testing.T) {
+		sim := simulator.New(
+			simulator.WithInstalledFirmware("bios", "2.1.0"),
+			simulator.WithInstalledFirmware("bmc", "3.0.1"),
+		)
+		defer sim.Close()
+
+		inventory, err := newTestBMC(t, sim).Inventory(ctx)
+		require.Nil(t, err)
+		assert.Equal(t, "2.1.0", inventory.BIOS.Firmware.Installed)
+		assert.Equal(t, "3.0.1", inventory.BMC.Firmware.Installed)
+	})
+
+	t.Run("failed logins are retried", func(t *testing.T) {
+		sim := simulator.New(simulator.WithLoginFailures(2))
+		defer sim.Close()
+
+		require.Nil(t, newTestBMC(t, sim).Open(ctx))
+		assert.Contains(t, []int{1, 2}, sim.Logins())
+	})
+
+	t.Run("login fails after max attempts", func(t *testing.T) {
+		sim := simulator.New(simulator.WithLoginFailures(100))
+		defer sim.Close()
+
+		err := newTestBMC(t, sim).Open(ctx)
+		assert.ErrorIs(t, err, errBMCLogin)
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		sim := simulator.New(simulator.WithCredentials("foo", "baz"))
+		defer sim.Close()
+
+		err := newTestBMC(t, sim).Open(ctx)
+		assert.ErrorIs(t, err, errBMCLogin)
+		assert.Equal(t, 0, sim.Logins())
+	})
+
+	t.Run("expired session is re-established", func(t *testing.T) {
+		sim := simulator.New()
+		defer sim.Close()
+
+		b := newTestBMC(t, sim)
+		require.Nil(t, b.Open(ctx))
+
+		logins := sim.Logins()
+		sim.ExpireSessions()
+
+		_, err := b.PowerStatus(ctx)
+		require.Nil(t, err)
+		assert.Greater(t, sim.Logins(), logins)
+	})
+
+	t.Run("bmc reset", func(t *testing.T) {
+		sim := simulator.New()
+		defer sim.Close()
+
+		b := newTestBMC(t, sim)
+		require.Nil(t, b.ResetBMC(ctx))
+		assert.Equal(t, 1, sim.BMCResets())
+
+		// a new session is established after the reset
+		_, err := b.PowerStatus(ctx)
+		assert.Nil(t, err)
+	})
+
+	t.Run("concurrent queries share the client", func(t *testing.T) {
+		sim := simulator.New()
+		defer sim.Close()
+
+		b := newTestBMC(t, sim)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+
+			go func() {
+				defer wg.Done()
+
+				_, err := b.PowerStatus(ctx)
+				assert.Nil(t, err)
+			}()
+
+			go func() {
+				defer wg.Done()
+
+				b.ReinitializeClient(ctx)
+			}()
+		}
+
+		wg.Wait()
+	})
+
+	t.Run("queries are not blocked by a firmware upload", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		sim := simulator.New(simulator.WithUploadHold(started, release))
+		defer sim.Close()
+
+		b := newTestBMC(t, sim)
+
+		// identifies the install provider
+		_, err := b.FirmwareInstallSteps(ctx, "bios")
+		require.Nil(t, err)
+
+		file, err := os.CreateTemp(t.TempDir(), "firmware-*.bin")
+		require.Nil(t, err)
+		defer file.Close()
+
+		_, err = file.WriteString("firmware")
+		require.Nil(t, err)
+
+		_, err = file.Seek(0, io.SeekStart)
+		require.Nil(t, err)
+
+		uploadErr := make(chan error, 1)
+		go func() {
+			_, err := b.FirmwareInstallUploadAndInitiate(ctx, "bios", file)
+			uploadErr <- err
+		}()
+
+		select {
+		case <-started:
+		case err := <-uploadErr:
+			t.Fatalf("upload returned before it was held: %v", err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for the upload to start")
+		}
+
+		// another action polls the BMC while the upload is in progress
+		state, err := b.PowerStatus(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, "On", state)
+
+		close(release)
+
+		select {
+		case err := <-uploadErr:
+			assert.Nil(t, err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for the upload to complete")
+		}
+
+		assert.Equal(t, 1, sim.Uploads())
+	})
+}
@@ -0,0 +1,399 @@
+package simulator
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bmc-toolbox/common"
+)
+
+const (
+	serviceRoot     = "/redfish/v1/"
+	sessions        = "/redfish/v1/SessionService/Sessions"
+	systems         = "/redfish/v1/Systems"
+	system          = "/redfish/v1/Systems/system"
+	systemReset     = "/redfish/v1/Systems/system/Actions/ComputerSystem.Reset"
+	managers        = "/redfish/v1/Managers"
+	manager         = "/redfish/v1/Managers/bmc"
+	managerReset    = "/redfish/v1/Managers/bmc/Actions/Manager.Reset"
+	chassis         = "/redfish/v1/Chassis"
+	taskService     = "/redfish/v1/TaskService"
+	tasks           = "/redfish/v1/TaskService/Tasks"
+	updateService   = "/redfish/v1/UpdateService"
+	updateMultipart = "/redfish/v1/UpdateService/update-multipart"
+	firmwareInv     = "/redfish/v1/UpdateService/FirmwareInventory"
+
+	// maximum size of the firmware file uploads held in memory
+	maxUploadMemory = 32 << 20
+)
+
+type link struct {
+	ODataID string `json:"@odata.id"`
+}
+
+func (s *Simulator) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	// bmclib identifies OpenBMC devices by the contents of the index page
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, "<html><head><title>OpenBMC</title></head></html>")
+	})
+
+	mux.HandleFunc("GET /redfish/v1/{$}", s.getServiceRoot)
+	mux.HandleFunc("GET /redfish/v1", s.getServiceRoot)
+	mux.HandleFunc("POST "+sessions, s.createSession)
+	mux.HandleFunc("DELETE "+sessions+"/{id}", s.authenticated(s.deleteSession))
+	mux.HandleFunc("GET "+systems, s.authenticated(collection(system)))
+	mux.HandleFunc("GET "+system, s.authenticated(s.getSystem))
+	mux.HandleFunc("POST "+systemReset, s.authenticated(s.resetSystem))
+	mux.HandleFunc("GET "+managers, s.authenticated(collection(manager)))
+	mux.HandleFunc("GET "+manager, s.authenticated(s.getManager))
+	mux.HandleFunc("POST "+managerReset, s.authenticated(s.resetManager))
+	mux.HandleFunc("GET "+chassis, s.authenticated(collection()))
+	mux.HandleFunc("GET "+taskService, s.authenticated(s.getTaskService))
+	mux.HandleFunc("GET "+tasks, s.authenticated(s.listTasks))
+	mux.HandleFunc("GET "+tasks+"/{id}", s.authenticated(s.getTask))
+	mux.HandleFunc("GET "+updateService, s.authenticated(s.getUpdateService))
+	mux.HandleFunc("GET "+firmwareInv, s.authenticated(collection()))
+	mux.HandleFunc("POST "+updateMultipart, s.authenticated(s.uploadFirmware))
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{
+			"code":    "Base.1.8.GeneralError",
+			"message": msg,
+		},
+	})
+}
+
+// authenticated returns 401 for requests without a valid session token.
+func (s *Simulator) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		_, valid := s.sessions[r.Header.Get("X-Auth-Token")]
+		s.mu.Unlock()
+
+		if !valid {
+			writeError(w, http.StatusUnauthorized, "invalid session token")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func collection(members ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		links := []link{}
+		for _, m := range members {
+			links = append(links, link{ODataID: m})
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.id":           r.URL.Path,
+			"Members":             links,
+			"Members@odata.count": len(links),
+		})
+	}
+}
+
+func (s *Simulator) getServiceRoot(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":      "/redfish/v1",
+		"@odata.type":    "#ServiceRoot.v1_9_0.ServiceRoot",
+		"Id":             "RootService",
+		"Name":           "Root Service",
+		"RedfishVersion": "1.9.0",
+		"Systems":        link{systems},
+		"Managers":       link{managers},
+		"Chassis":        link{chassis},
+		"Tasks":          link{taskService},
+		"UpdateService":  link{updateService},
+		"SessionService": link{"/redfish/v1/SessionService"},
+		"Links": map[string]any{
+			"Sessions": link{sessions},
+		},
+	})
+}
+
+func (s *Simulator) createSession(w http.ResponseWriter, r *http.Request) {
+	var creds struct {
+		UserName string
+		Password string
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.loginFailures > 0 {
+		s.loginFailures--
+		writeError(w, http.StatusServiceUnavailable, "session service unavailable")
+
+		return
+	}
+
+	if creds.UserName != s.username || creds.Password != s.password {
+		writeError(w, http.StatusUnauthorized, "invalid credentials")
+		return
+	}
+
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+
+	s.sessionID++
+	id := strconv.Itoa(s.sessionID)
+	s.sessions[hex.EncodeToString(token)] = id
+	s.logins++
+
+	w.Header().Set("X-Auth-Token", hex.EncodeToString(token))
+	w.Header().Set("Location", sessions+"/"+id)
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"@odata.id": sessions + "/" + id,
+		"Id":        id,
+		"UserName":  creds.UserName,
+	})
+}
+
+func (s *Simulator) deleteSession(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token, id := range s.sessions {
+		if id == r.PathValue("id") {
+			delete(s.sessions, token)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Simulator) getSystem(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":    system,
+		"@odata.type":  "#ComputerSystem.v1_16_0.ComputerSystem",
+		"Id":           "system",
+		"Name":         "system",
+		"Manufacturer": "Simulated",
+		"Model":        "Redfish BMC",
+		"SerialNumber": "SIM0000001",
+		"PowerState":   s.powerState,
+		"BiosVersion":  s.installed[common.SlugBIOS],
+		"Status":       map[string]any{"Health": "OK", "State": "Enabled"},
+		"Actions": map[string]any{
+			"#ComputerSystem.Reset": map[string]any{
+				"target": systemReset,
+				"ResetType@Redfish.AllowableValues": []string{
+					"On", "ForceOff", "GracefulShutdown", "GracefulRestart", "ForceRestart", "PowerCycle",
+				},
+			},
+		},
+	})
+}
+
+func (s *Simulator) resetSystem(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		ResetType string
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch params.ResetType {
+	case "On":
+		s.powerState = PowerStateOn
+	case "ForceOff", "GracefulShutdown":
+		s.powerState = PowerStateOff
+	case "GracefulRestart", "ForceRestart", "PowerCycle":
+		if s.powerState == PowerStateOff {
+			writeError(w, http.StatusConflict, "host is powered off")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported reset type: "+params.ResetType)
+		return
+	}
+
+	s.powerCalls = append(s.powerCalls, params.ResetType)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Simulator) getManager(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":       manager,
+		"@odata.type":     "#Manager.v1_11_0.Manager",
+		"Id":              "bmc",
+		"Name":            "OpenBmc Manager",
+		"ManagerType":     "BMC",
+		"FirmwareVersion": s.installed[common.SlugBMC],
+		"Status":          map[string]any{"Health": "OK", "State": "Enabled"},
+		"Actions": map[string]any{
+			"#Manager.Reset": map[string]any{
+				"target":                            managerReset,
+				"ResetType@Redfish.AllowableValues": []string{"GracefulRestart", "ForceRestart"},
+			},
+		},
+	})
+}
+
+// resetManager restarts the BMC, the active sessions are invalidated.
+func (s *Simulator) resetManager(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bmcResets++
+	s.sessions = map[string]string{}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Simulator) getTaskService(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":      taskService,
+		"Id":             "TaskService",
+		"ServiceEnabled": true,
+		"Tasks":          link{tasks},
+	})
+}
+
+func (s *Simulator) listTasks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	ids := []string{}
+	for _, t := range s.tasks {
+		ids = append(ids, tasks+"/"+t.id)
+	}
+	s.mu.Unlock()
+
+	collection(ids...)(w, r)
+}
+
+// getTask returns the task, its state is transitioned on each query.
+func (s *Simulator) getTask(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tasks {
+		if t.id != r.PathValue("id") {
+			continue
+		}
+
+		s.advance(t)
+
+		status := "OK"
+		if t.state == taskStateException {
+			status = "Critical"
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.id":   tasks + "/" + t.id,
+			"@odata.type": "#Task.v1_4_3.Task",
+			"Id":          t.id,
+			"Name":        "Task " + t.id,
+			"TaskState":   t.state,
+			"TaskStatus":  status,
+			"Messages": []map[string]any{
+				{"Message": "The task with Id '" + t.id + "' has state '" + t.state + "'."},
+			},
+		})
+
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "task not found")
+}
+
+func (s *Simulator) getUpdateService(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":            updateService,
+		"Id":                   "UpdateService",
+		"ServiceEnabled":       true,
+		"MultipartHttpPushUri": updateMultipart,
+		"FirmwareInventory":    link{firmwareInv},
+	})
+}
+
+// uploadFirmware accepts a multipart firmware upload and queues a firmware install task.
+func (s *Simulator) uploadFirmware(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, ok := r.MultipartForm.Value["UpdateParameters"]; !ok {
+		writeError(w, http.StatusBadRequest, "expected UpdateParameters form field")
+		return
+	}
+
+	file, _, err := r.FormFile("UpdateFile")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "expected UpdateFile form field: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(io.Discard, file); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// the upload is held without the simulator lock, so the BMC can be queried meanwhile
+	if s.uploadStarted != nil {
+		s.uploadStarted <- struct{}{}
+		<-s.uploadRelease
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tasks {
+		if t.state == taskStateNew || t.state == taskStateRunning {
+			writeError(w, http.StatusConflict, "a firmware install task is active: "+t.id)
+			return
+		}
+	}
+
+	s.uploads++
+	s.taskID++
+
+	t := &task{id: strconv.Itoa(s.taskID), state: taskStateNew}
+	s.tasks = append(s.tasks, t)
+
+	w.Header().Set("Location", strings.Join([]string{tasks, t.id, "Monitor"}, "/"))
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"@odata.id":   tasks + "/" + t.id,
+		"@odata.type": "#Task.v1_4_3.Task",
+		"Id":          t.id,
+		"TaskState":   t.state,
+	})
+}
@@ -0,0 +1,271 @@
+// Package simulator provides an in-process Redfish BMC, for the out of band firmware install to be tested end-to-end.
+//
+// The simulated BMC identifies as an OpenBMC device and is served over TLS by a httptest server,
+// the outofband device queryor is directed to it with the outofband.WithDialContext option.
+package simulator
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/bmc-toolbox/common"
+)
+
+const (
+	// the bmclib provider the simulated BMC is identified as.
+	Vendor = "openbmc"
+
+	PowerStateOn  = "On"
+	PowerStateOff = "Off"
+
+	// the redfish task states the simulated firmware install tasks transition through.
+	taskStateNew       = "New"
+	taskStateRunning   = "Running"
+	taskStateCompleted = "Completed"
+	taskStateException = "Exception"
+)
+
+// Simulator is an in-process Redfish BMC
+type Simulator struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	username string
+	password string
+
+	powerState string
+	// installed firmware versions by component slug
+	installed map[string]string
+	// firmware versions by component slug, applied when an install task completes
+	updates map[string]string
+
+	// active session tokens mapped to the session IDs
+	sessions  map[string]string
+	sessionID int
+
+	tasks  []*task
+	taskID int
+
+	// injected failures
+	loginFailures int
+	taskStuck     bool
+	taskFailed    bool
+
+	// the firmware upload requests are held between these when set
+	uploadStarted chan<- struct{}
+	uploadRelease <-chan struct{}
+
+	// counters for test assertions
+	logins     int
+	uploads    int
+	bmcResets  int
+	powerCalls []string
+}
+
+type task struct {
+	id    string
+	state string
+	// the number of times the task was queried, the task state transitions on each query
+	queried int
+}
+
+// Option sets parameters on the Simulator
+type Option func(*Simulator)
+
+// WithCredentials sets the username and password to login to the simulated BMC, defaults to foo, bar.
+func WithCredentials(username, password string) Option {
+	return func(s *Simulator) {
+		s.username = username
+		s.password = password
+	}
+}
+
+// WithPowerState sets the initial host power state, defaults to On.
+func WithPowerState(state string) Option {
+	return func(s *Simulator) {
+		s.powerState = state
+	}
+}
+
+// WithInstalledFirmware sets the firmware version installed on the component - either bios or bmc.
+func WithInstalledFirmware(component, version string) Option {
+	return func(s *Simulator) {
+		s.installed[strings.ToUpper(component)] = version
+	}
+}
+
+// WithFirmwareUpdate sets the firmware version installed on the component when a firmware install task completes.
+//
+// The simulated BMC restarts when its own firmware is updated, this invalidates any active sessions.
+func WithFirmwareUpdate(component, version string) Option {
+	return func(s *Simulator) {
+		s.updates[strings.ToUpper(component)] = version
+	}
+}
+
+// WithLoginFailures sets the number of session login requests that fail before a session is created.
+func WithLoginFailures(count int) Option {
+	return func(s *Simulator) {
+		s.loginFailures = count
+	}
+}
+
+// WithTaskStuck sets the firmware install tasks to remain in the Running state.
+func WithTaskStuck() Option {
+	return func(s *Simulator) {
+		s.taskStuck = true
+	}
+}
+
+// WithTaskFailed sets the firmware install tasks to end in the Exception state.
+func WithTaskFailed() Option {
+	return func(s *Simulator) {
+		s.taskFailed = true
+	}
+}
+
+// WithUploadHold holds the firmware upload requests once the file is received,
+// started is sent on when an upload is held and the upload completes once release is closed.
+func WithUploadHold(started chan<- struct{}, release <-chan struct{}) Option {
+	return func(s *Simulator) {
+		s.uploadStarted = started
+		s.uploadRelease = release
+	}
+}
+
+// New starts a simulated BMC, the returned Simulator is to be closed when done.
+func New(options ...Option) *Simulator {
+	s := &Simulator{
+		username:   "foo",
+		password:   "bar",
+		powerState: PowerStateOn,
+		installed: map[string]string{
+			common.SlugBIOS: "1.0.0",
+			common.SlugBMC:  "1.0.0",
+		},
+		updates:  map[string]string{},
+		sessions: map[string]string{},
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	s.server = httptest.NewTLSServer(s.routes())
+
+	return s
+}
+
+// Close shuts down the simulated BMC
+func (s *Simulator) Close() {
+	s.server.Close()
+}
+
+// Addr returns the address the simulated BMC is listening on.
+func (s *Simulator) Addr() string {
+	return s.server.Listener.Addr().String()
+}
+
+// DialContext dials the simulated BMC regardless of the address given,
+// this is to be passed to the outofband device queryor with the outofband.WithDialContext option.
+func (s *Simulator) DialContext(ctx context.Context, network, _ string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, s.Addr())
+}
+
+// ExpireSessions invalidates the active sessions, as a BMC would when its session store is lost.
+func (s *Simulator) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = map[string]string{}
+}
+
+// PowerState returns the current host power state.
+func (s *Simulator) PowerState() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.powerState
+}
+
+// PowerActions returns the host reset types requested, in the order received.
+func (s *Simulator) PowerActions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.powerCalls...)
+}
+
+// InstalledFirmware returns the firmware version installed on the component.
+func (s *Simulator) InstalledFirmware(component string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.installed[strings.ToUpper(component)]
+}
+
+// Logins returns the number of sessions created.
+func (s *Simulator) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.logins
+}
+
+// Uploads returns the number of firmware files uploaded.
+func (s *Simulator) Uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.uploads
+}
+
+// BMCResets returns the number of BMC resets requested.
+func (s *Simulator) BMCResets() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bmcResets
+}
+
+// advance transitions the task state, the caller is expected to hold the lock.
+//
+// New -> Running -> Completed, or Exception when the task is set to fail.
+func (s *Simulator) advance(t *task) {
+	t.queried++
+
+	switch t.state {
+	case taskStateNew:
+		t.state = taskStateRunning
+	case taskStateRunning:
+		if s.taskStuck || t.queried < 3 {
+			return
+		}
+
+		if s.taskFailed {
+			t.state = taskStateException
+			return
+		}
+
+		t.state = taskStateCompleted
+		s.applyUpdates()
+	}
+}
+
+// applyUpdates installs the firmware updates, the caller is expected to hold the lock.
+func (s *Simulator) applyUpdates() {
+	for component, version := range s.updates {
+		s.installed[component] = version
+
+		// the BMC restarts to apply its own firmware
+		if component == common.SlugBMC {
+			s.sessions = map[string]string{}
+		}
+	}
+
+	s.updates = map[string]string{}
+}
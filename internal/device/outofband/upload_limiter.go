@@ -0,0 +1,160 @@
+package outofband
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// the prefix length BMC IPv4 addresses are grouped by when not in a configured subnet
+	defaultSubnetPrefixIPv4 = 24
+	// the prefix length BMC IPv6 addresses are grouped by when not in a configured subnet
+	defaultSubnetPrefixIPv6 = 64
+)
+
+var (
+	ErrUploadLimiter = errors.New("firmware upload limiter error")
+)
+
+// UploadLimiter limits the concurrent firmware uploads to BMCs in a subnet and to a BMC address,
+// this keeps concurrent conditions from saturating the management network links and the BMCs.
+//
+// Servers in a multi node chassis share the chassis controller address and so are limited together by the BMC limit.
+type UploadLimiter struct {
+	// subnets BMC addresses are grouped by, BMCs not in these subnets are grouped by their /24 (IPv4) or /64 (IPv6) subnet.
+	subnets []*net.IPNet
+	// concurrent uploads allowed to BMCs in a subnet, the limit is disabled when set to 0.
+	subnetLimit int
+	// concurrent uploads allowed to a BMC address, the limit is disabled when set to 0.
+	bmcLimit int
+
+	mu sync.Mutex
+	// in-flight uploads by subnet
+	subnetUploads map[string]int
+	// in-flight uploads by BMC address
+	bmcUploads map[string]int
+	// released is closed and replaced when an upload slot is released, to wake up waiting uploads.
+	released chan struct{}
+}
+
+// NewUploadLimiter returns an UploadLimiter for the given limits,
+// the subnets are CIDRs that BMC addresses are grouped by for the subnet limit.
+func NewUploadLimiter(subnetLimit, bmcLimit int, subnets []string) (*UploadLimiter, error) {
+	if subnetLimit < 0 || bmcLimit < 0 {
+		return nil, errors.Wrap(ErrUploadLimiter, "invalid limit, expected a value >= 0")
+	}
+
+	l := &UploadLimiter{
+		subnetLimit:   subnetLimit,
+		bmcLimit:      bmcLimit,
+		subnetUploads: map[string]int{},
+		bmcUploads:    map[string]int{},
+		released:      make(chan struct{}),
+	}
+
+	for _, cidr := range subnets {
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrap(ErrUploadLimiter, err.Error())
+		}
+
+		l.subnets = append(l.subnets, subnet)
+	}
+
+	return l, nil
+}
+
+// subnet returns the subnet the BMC address is grouped in,
+// an empty value is returned for BMC addresses that are not IP addresses.
+func (l *UploadLimiter) subnet(bmcAddr string) string {
+	ip := net.ParseIP(bmcAddr)
+	if ip == nil {
+		return ""
+	}
+
+	for _, subnet := range l.subnets {
+		if subnet.Contains(ip) {
+			return subnet.String()
+		}
+	}
+
+	if ip.To4() != nil {
+		return (&net.IPNet{IP: ip.Mask(net.CIDRMask(defaultSubnetPrefixIPv4, 32)), Mask: net.CIDRMask(defaultSubnetPrefixIPv4, 32)}).String()
+	}
+
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(defaultSubnetPrefixIPv6, 128)), Mask: net.CIDRMask(defaultSubnetPrefixIPv6, 128)}).String()
+}
+
+// tryAcquire returns true when an upload slot for the BMC was acquired,
+// when false the returned channel is closed once a slot is released.
+func (l *UploadLimiter) tryAcquire(bmcAddr, subnet string) (bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.bmcLimit > 0 && l.bmcUploads[bmcAddr] >= l.bmcLimit {
+		return false, l.released
+	}
+
+	if l.subnetLimit > 0 && subnet != "" && l.subnetUploads[subnet] >= l.subnetLimit {
+		return false, l.released
+	}
+
+	l.bmcUploads[bmcAddr]++
+	if subnet != "" {
+		l.subnetUploads[subnet]++
+	}
+
+	return true, nil
+}
+
+func (l *UploadLimiter) release(bmcAddr, subnet string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.bmcUploads[bmcAddr]--
+	if l.bmcUploads[bmcAddr] <= 0 {
+		delete(l.bmcUploads, bmcAddr)
+	}
+
+	if subnet != "" {
+		l.subnetUploads[subnet]--
+		if l.subnetUploads[subnet] <= 0 {
+			delete(l.subnetUploads, subnet)
+		}
+	}
+
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// Acquire blocks until an upload slot for the BMC address is available or the context is canceled,
+// the waiting func when set is invoked once if the upload has to wait for a slot.
+//
+// The returned func is to be invoked to release the upload slot.
+func (l *UploadLimiter) Acquire(ctx context.Context, bmcAddr string, waiting func()) (release func(), err error) {
+	subnet := l.subnet(bmcAddr)
+
+	var waited bool
+	for {
+		acquired, releasedCh := l.tryAcquire(bmcAddr, subnet)
+		if acquired {
+			var once sync.Once
+			return func() { once.Do(func() { l.release(bmcAddr, subnet) }) }, nil
+		}
+
+		if !waited && waiting != nil {
+			waiting()
+		}
+
+		waited = true
+
+		select {
+		case <-releasedCh:
+		case <-ctx.Done():
+			return nil, errors.Wrap(ErrUploadLimiter, "waiting for upload slot: "+ctx.Err().Error())
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package outofband
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadLimiterSubnet(t *testing.T) {
+	l, err := NewUploadLimiter(1, 1, []string{"10.1.0.0/22"})
+	require.Nil(t, err)
+
+	assert.Equal(t, "10.1.0.0/22", l.subnet("10.1.3.10"))
+	assert.Equal(t, "10.2.3.0/24", l.subnet("10.2.3.10"))
+	assert.Equal(t, "fd00:1::/64", l.subnet("fd00:1::10"))
+	assert.Equal(t, "", l.subnet("bmc.example.com"))
+
+	_, err = NewUploadLimiter(1, 1, []string{"10.1.0.0"})
+	assert.ErrorIs(t, err, ErrUploadLimiter)
+
+	_, err = NewUploadLimiter(-1, 1, nil)
+	assert.ErrorIs(t, err, ErrUploadLimiter)
+}
+
+func TestUploadLimiterAcquire(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("uploads to a BMC are limited", func(t *testing.T) {
+		l, err := NewUploadLimiter(0, 1, nil)
+		require.Nil(t, err)
+
+		release, err := l.Acquire(ctx, "10.1.0.10", nil)
+		require.Nil(t, err)
+
+		// uploads to other BMCs are not held up
+		releaseOther, err := l.Acquire(ctx, "10.1.0.11", nil)
+		require.Nil(t, err)
+		releaseOther()
+
+		waitingCh := make(chan struct{})
+		acquiredCh := make(chan func())
+		go func() {
+			r, errAcquire := l.Acquire(ctx, "10.1.0.10", func() { close(waitingCh) })
+			assert.Nil(t, errAcquire)
+			acquiredCh <- r
+		}()
+
+		select {
+		case <-waitingCh:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the upload to wait for a slot")
+		}
+
+		release()
+		// releasing again is a no-op
+		release()
+
+		select {
+		case r := <-acquiredCh:
+			r()
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the upload slot to be acquired once released")
+		}
+
+		assert.Empty(t, l.bmcUploads)
+	})
+
+	t.Run("uploads to BMCs in a subnet are limited", func(t *testing.T) {
+		l, err := NewUploadLimiter(2, 0, []string{"10.1.0.0/22"})
+		require.Nil(t, err)
+
+		release1, err := l.Acquire(ctx, "10.1.0.10", nil)
+		require.Nil(t, err)
+		defer release1()
+
+		release2, err := l.Acquire(ctx, "10.1.2.10", nil)
+		require.Nil(t, err)
+		defer release2()
+
+		// BMCs in other subnets are not held up
+		release3, err := l.Acquire(ctx, "10.1.4.10", nil)
+		require.Nil(t, err)
+		defer release3()
+
+		waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		var waited bool
+		_, err = l.Acquire(waitCtx, "10.1.3.10", func() { waited = true })
+		assert.ErrorIs(t, err, ErrUploadLimiter)
+		assert.True(t, waited)
+		assert.Equal(t, 2, l.subnetUploads["10.1.0.0/22"])
+	})
+}
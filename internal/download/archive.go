@@ -0,0 +1,274 @@
+package download
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// firmware URL fragment parameters that identify the payload within a firmware archive
+	payloadParam         = "payload"
+	payloadChecksumParam = "payload_checksum"
+
+	// tar archives are identified by the ustar magic at this offset
+	tarMagicOffset = 257
+)
+
+var (
+	ErrArchive = errors.New("error extracting firmware payload from archive")
+
+	zipMagic  = []byte("PK\x03\x04")
+	gzipMagic = []byte{0x1f, 0x8b}
+	tarMagic  = []byte("ustar")
+)
+
+// Payload identifies the firmware file to be installed within a vendor firmware archive.
+type Payload struct {
+	// Pattern is the path or glob of the payload within the archive,
+	// a pattern without a directory separator is matched against the base name of each archive entry.
+	Pattern string
+
+	// Checksum of the payload file, in the same format as the firmware checksum.
+	Checksum string
+}
+
+// ParsePayload returns the payload declared in the firmware URL fragment - #payload=<glob>&payload_checksum=<checksum>,
+// nil is returned when the firmware URL does not declare a payload.
+func ParsePayload(fileURL string) (*Payload, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return nil, errors.Wrap(ErrFormat, err.Error())
+	}
+
+	if u.Fragment == "" {
+		return nil, nil // nolint:nilnil // the firmware file is not an archive
+	}
+
+	params, err := url.ParseQuery(u.Fragment)
+	if err != nil {
+		return nil, errors.Wrap(ErrFormat, "invalid firmware URL fragment: "+err.Error())
+	}
+
+	pattern := params.Get(payloadParam)
+	if pattern == "" {
+		return nil, nil // nolint:nilnil // the firmware file is not an archive
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, errors.Wrap(ErrFormat, "invalid payload pattern: "+pattern)
+	}
+
+	checksum := params.Get(payloadChecksumParam)
+	if checksum == "" {
+		return nil, errors.Wrap(ErrFormat, "expected a payload_checksum for payload: "+pattern)
+	}
+
+	if _, _, _, err := parseChecksum(checksum); err != nil {
+		return nil, err
+	}
+
+	return &Payload{Pattern: pattern, Checksum: checksum}, nil
+}
+
+func (p *Payload) match(name string) bool {
+	name = path.Clean(strings.TrimPrefix(filepath.ToSlash(name), "/"))
+
+	if !strings.Contains(p.Pattern, "/") {
+		name = path.Base(name)
+	}
+
+	matched, _ := path.Match(p.Pattern, name)
+
+	return matched
+}
+
+// IsArchive returns true when the file is a zip, tar or gzip compressed tar archive.
+func IsArchive(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, tarMagicOffset+len(tarMagic))
+
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+
+	return archiveKind(header[:n]) != "", nil
+}
+
+func archiveKind(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, zipMagic):
+		return "zip"
+	case bytes.HasPrefix(header, gzipMagic):
+		return "tar.gz"
+	case len(header) >= tarMagicOffset+len(tarMagic) &&
+		bytes.Equal(header[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic):
+		return "tar"
+	default:
+		return ""
+	}
+}
+
+// ExtractPayload extracts the payload from the archive into the dst directory and validates its checksum,
+// the path to the extracted payload is returned.
+//
+// The archive is expected to contain exactly one file matching the payload pattern.
+func ExtractPayload(ctx context.Context, archive, dst string, payload *Payload) (string, error) {
+	if payload == nil {
+		return "", errors.Wrap(ErrArchive, "expected a payload to extract")
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return "", errors.Wrap(ErrArchive, err.Error())
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+
+	header, err := reader.Peek(tarMagicOffset + len(tarMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", errors.Wrap(ErrArchive, err.Error())
+	}
+
+	var file string
+
+	switch archiveKind(header) {
+	case "zip":
+		file, err = extractZip(ctx, f, dst, payload)
+	case "tar.gz":
+		gz, errGzip := gzip.NewReader(reader)
+		if errGzip != nil {
+			return "", errors.Wrap(ErrArchive, errGzip.Error())
+		}
+		defer gz.Close()
+
+		file, err = extractTar(ctx, gz, dst, payload)
+	case "tar":
+		file, err = extractTar(ctx, reader, dst, payload)
+	default:
+		return "", errors.Wrap(ErrArchive, "unsupported archive format: "+filepath.Base(archive))
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := ChecksumValidate(ctx, file, payload.Checksum); err != nil {
+		os.Remove(file)
+		return "", err
+	}
+
+	return file, nil
+}
+
+func extractZip(ctx context.Context, f *os.File, dst string, payload *Payload) (string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return "", errors.Wrap(ErrArchive, err.Error())
+	}
+
+	zr, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		return "", errors.Wrap(ErrArchive, err.Error())
+	}
+
+	var match *zip.File
+
+	for _, entry := range zr.File {
+		if entry.FileInfo().IsDir() || !payload.match(entry.Name) {
+			continue
+		}
+
+		if match != nil {
+			return "", errors.Wrap(ErrArchive, "multiple files match payload: "+payload.Pattern)
+		}
+
+		match = entry
+	}
+
+	if match == nil {
+		return "", errors.Wrap(ErrArchive, "no file matches payload: "+payload.Pattern)
+	}
+
+	rc, err := match.Open()
+	if err != nil {
+		return "", errors.Wrap(ErrArchive, err.Error())
+	}
+	defer rc.Close()
+
+	return writePayload(ctx, rc, dst, match.Name)
+}
+
+func extractTar(ctx context.Context, r io.Reader, dst string, payload *Payload) (string, error) {
+	tr := tar.NewReader(r)
+
+	var file string
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return "", errors.Wrap(ErrArchive, err.Error())
+		}
+
+		if hdr.Typeflag != tar.TypeReg || !payload.match(hdr.Name) {
+			continue
+		}
+
+		if file != "" {
+			os.Remove(file)
+			return "", errors.Wrap(ErrArchive, "multiple files match payload: "+payload.Pattern)
+		}
+
+		// the tar archive is read sequentially, the payload is written out to continue looking for duplicate matches
+		file, err = writePayload(ctx, tr, dst, hdr.Name)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if file == "" {
+		return "", errors.Wrap(ErrArchive, "no file matches payload: "+payload.Pattern)
+	}
+
+	return file, nil
+}
+
+// writePayload writes the archive entry into the dst directory, only the base name of the entry is retained.
+func writePayload(ctx context.Context, r io.Reader, dst, name string) (string, error) {
+	file := filepath.Join(dst, path.Base(filepath.ToSlash(name)))
+
+	out, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", errors.Wrap(ErrArchive, err.Error())
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, &contextReader{ctx: ctx, r: r}); err != nil {
+		os.Remove(file)
+		return "", errors.Wrap(ErrArchive, err.Error())
+	}
+
+	return file, nil
+}
@@ -0,0 +1,178 @@
+package download
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// archive entries, with the payload contents 'BLOB'
+var testArchiveEntries = map[string][]byte{
+	"X11DPH9_B2.bin":             []byte("BLOB"),
+	"docs/README.txt":            []byte("README"),
+	"docs/release-notes.txt":     []byte("NOTES"),
+	"../../escaped/outside.bin":  []byte("BLOB"),
+	"UEFI/BIOS/X11DPH9_B3.rom":   []byte("BLOB2"),
+	"UEFI/BIOS/X11DPH9_B3.files": []byte("FILES"),
+}
+
+func writeTestZip(t *testing.T, file string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	for name, content := range testArchiveEntries {
+		w, err := zw.Create(name)
+		require.Nil(t, err)
+
+		_, err = w.Write(content)
+		require.Nil(t, err)
+	}
+
+	require.Nil(t, zw.Close())
+	require.Nil(t, os.WriteFile(file, buf.Bytes(), 0o600))
+}
+
+func writeTestTar(t *testing.T, file string, compress bool) {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	var gz *gzip.Writer
+
+	tw := tar.NewWriter(&buf)
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	}
+
+	for name, content := range testArchiveEntries {
+		require.Nil(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+
+		_, err := tw.Write(content)
+		require.Nil(t, err)
+	}
+
+	require.Nil(t, tw.Close())
+
+	if gz != nil {
+		require.Nil(t, gz.Close())
+	}
+
+	require.Nil(t, os.WriteFile(file, buf.Bytes(), 0o600))
+}
+
+func TestParsePayload(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		expected    *Payload
+		expectedErr error
+	}{
+		{"no fragment", "https://example.com/bios.zip", nil, nil},
+		{"fragment without payload", "https://example.com/bios.zip#foo=bar", nil, nil},
+		{
+			"payload glob",
+			"https://example.com/bios.zip#payload=X11DPH*.bin&payload_checksum=" + testBlobSHA256,
+			&Payload{Pattern: "X11DPH*.bin", Checksum: testBlobSHA256},
+			nil,
+		},
+		{
+			"payload path",
+			"s3://firmware/bios.tar.gz#payload=UEFI/BIOS/X11DPH9_B3.rom&payload_checksum=" + testBlobMD5,
+			&Payload{Pattern: "UEFI/BIOS/X11DPH9_B3.rom", Checksum: testBlobMD5},
+			nil,
+		},
+		{"payload checksum required", "https://example.com/bios.zip#payload=X11DPH*.bin", nil, ErrFormat},
+		{"invalid payload checksum", "https://example.com/bios.zip#payload=X11DPH*.bin&payload_checksum=foo:bar", nil, ErrFormat},
+		{"invalid payload pattern", "https://example.com/bios.zip#payload=[&payload_checksum=" + testBlobMD5, nil, ErrFormat},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParsePayload(tc.url)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestExtractPayload(t *testing.T) {
+	dir := t.TempDir()
+
+	archives := map[string]string{
+		"zip":    filepath.Join(dir, "bios.zip"),
+		"tar":    filepath.Join(dir, "bios.tar"),
+		"tar.gz": filepath.Join(dir, "bios.tgz"),
+	}
+
+	writeTestZip(t, archives["zip"])
+	writeTestTar(t, archives["tar"], false)
+	writeTestTar(t, archives["tar.gz"], true)
+
+	tests := []struct {
+		name         string
+		payload      *Payload
+		expectedFile string
+		expectedErr  error
+	}{
+		{"payload glob", &Payload{Pattern: "X11DPH*.bin", Checksum: testBlobMD5}, "X11DPH9_B2.bin", nil},
+		{"payload path", &Payload{Pattern: "UEFI/BIOS/*.rom", Checksum: testBlob2MD5sum}, "X11DPH9_B3.rom", nil},
+		{"entry outside archive root is written to dst", &Payload{Pattern: "outside.bin", Checksum: testBlobMD5}, "outside.bin", nil},
+		{"payload checksum mismatch", &Payload{Pattern: "X11DPH*.bin", Checksum: testBlob2MD5sum}, "", ErrChecksum},
+		{"multiple files match", &Payload{Pattern: "*.txt", Checksum: testBlobMD5}, "", ErrArchive},
+		{"no file matches", &Payload{Pattern: "foo.bin", Checksum: testBlobMD5}, "", ErrArchive},
+	}
+
+	for kind, archive := range archives {
+		isArchive, err := IsArchive(archive)
+		require.Nil(t, err)
+		assert.True(t, isArchive, kind)
+
+		for _, tc := range tests {
+			t.Run(kind+"/"+tc.name, func(t *testing.T) {
+				dst := t.TempDir()
+
+				file, err := ExtractPayload(context.Background(), archive, dst, tc.payload)
+				if tc.expectedErr != nil {
+					assert.ErrorIs(t, err, tc.expectedErr)
+
+					// failed extractions are purged
+					entries, errRead := os.ReadDir(dst)
+					require.Nil(t, errRead)
+					assert.Empty(t, entries)
+
+					return
+				}
+
+				require.Nil(t, err)
+				assert.Equal(t, filepath.Join(dst, tc.expectedFile), file)
+			})
+		}
+	}
+
+	// plain files are not archives
+	plain := filepath.Join(dir, "bios.bin")
+	require.Nil(t, os.WriteFile(plain, []byte("BLOB"), 0o600))
+
+	isArchive, err := IsArchive(plain)
+	require.Nil(t, err)
+	assert.False(t, isArchive)
+
+	_, err = ExtractPayload(context.Background(), plain, t.TempDir(), &Payload{Pattern: "*", Checksum: testBlobMD5})
+	assert.ErrorIs(t, err, ErrArchive)
+}
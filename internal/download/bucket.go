@@ -0,0 +1,240 @@
+package download
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/errors"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/fileblob"
+	"gocloud.dev/blob/gcsblob"
+	"gocloud.dev/blob/s3blob"
+	"gocloud.dev/gcerrors"
+	"gocloud.dev/gcp"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	schemeS3   = "s3"
+	schemeGCS  = "gs"
+	schemeFile = "file"
+
+	gcsReadOnlyScope = "https://www.googleapis.com/auth/devstorage.read_only"
+)
+
+// BucketCredentials defines the parameters to access firmware files in object storage buckets.
+//
+// When the credentials are not set, the default credential chain of the cloud provider SDK applies.
+type BucketCredentials struct {
+	// S3Region is the bucket region, this is overridden by the region query parameter in the firmware URL.
+	S3Region string
+	// S3Endpoint is the endpoint for S3 compatible object stores.
+	S3Endpoint        string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	// S3UsePathStyle enables path style bucket addressing, required by most S3 compatible object stores.
+	S3UsePathStyle bool
+
+	// GCSCredentialsFile is the path to a GCP service account JSON key file.
+	GCSCredentialsFile string
+}
+
+// WithBucketCredentials sets the credentials used to download firmware from object storage buckets.
+func WithBucketCredentials(c *BucketCredentials) Option {
+	return func(d *downloader) {
+		d.bucketCredentials = c
+	}
+}
+
+// isBucketURL returns true when the URL scheme identifies an object storage bucket or a local file.
+func isBucketURL(u *url.URL) bool {
+	switch u.Scheme {
+	case schemeS3, schemeGCS, schemeFile:
+		return true
+	default:
+		return false
+	}
+}
+
+// openBucket returns the bucket and the object key for the given URL.
+func (d *downloader) openBucket(ctx context.Context, u *url.URL) (*blob.Bucket, string, error) {
+	creds := d.bucketCredentials
+	if creds == nil {
+		creds = &BucketCredentials{}
+	}
+
+	switch u.Scheme {
+	case schemeFile:
+		path := filepath.FromSlash(u.Path)
+
+		bucket, err := fileblob.OpenBucket(filepath.Dir(path), nil)
+		if err != nil {
+			return nil, "", errors.Wrap(ErrDownload, err.Error())
+		}
+
+		return bucket, filepath.Base(path), nil
+
+	case schemeS3:
+		bucket, err := openS3Bucket(ctx, u, creds)
+		if err != nil {
+			return nil, "", errors.Wrap(ErrDownload, err.Error())
+		}
+
+		return bucket, strings.TrimPrefix(u.Path, "/"), nil
+
+	case schemeGCS:
+		bucket, err := openGCSBucket(ctx, u, creds)
+		if err != nil {
+			return nil, "", errors.Wrap(ErrDownload, err.Error())
+		}
+
+		return bucket, strings.TrimPrefix(u.Path, "/"), nil
+
+	default:
+		return nil, "", errors.Wrap(ErrDownload, "unsupported URL scheme: "+u.Scheme)
+	}
+}
+
+func openS3Bucket(ctx context.Context, u *url.URL, creds *BucketCredentials) (*blob.Bucket, error) {
+	region := creds.S3Region
+	if u.Query().Get("region") != "" {
+		region = u.Query().Get("region")
+	}
+
+	loadOpts := []func(*awsconfig.LoadOptions) error{}
+	if region != "" {
+		loadOpts = append(loadOpts, awsconfig.WithRegion(region))
+	}
+
+	if creds.S3AccessKeyID != "" {
+		loadOpts = append(loadOpts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(creds.S3AccessKeyID, creds.S3SecretAccessKey, ""),
+		))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if creds.S3Endpoint != "" {
+			o.BaseEndpoint = aws.String(creds.S3Endpoint)
+		}
+
+		o.UsePathStyle = creds.S3UsePathStyle
+	})
+
+	return s3blob.OpenBucketV2(ctx, client, u.Host, nil)
+}
+
+func openGCSBucket(ctx context.Context, u *url.URL, creds *BucketCredentials) (*blob.Bucket, error) {
+	var gcpCreds *google.Credentials
+	var err error
+
+	if creds.GCSCredentialsFile != "" {
+		b, errRead := os.ReadFile(creds.GCSCredentialsFile)
+		if errRead != nil {
+			return nil, errRead
+		}
+
+		gcpCreds, err = google.CredentialsFromJSON(ctx, b, gcsReadOnlyScope)
+	} else {
+		gcpCreds, err = gcp.DefaultCredentials(ctx)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := gcp.NewHTTPClient(gcp.DefaultTransport(), gcp.CredentialsTokenSource(gcpCreds))
+	if err != nil {
+		return nil, err
+	}
+
+	return gcsblob.OpenBucket(ctx, client, u.Host, nil)
+}
+
+// fetchBucket downloads the object identified by the URL from the offset into the fileHandle.
+func (d *downloader) fetchBucket(ctx context.Context, u *url.URL, fileHandle *os.File, offset int64) error {
+	attemptCtx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	bucket, key, err := d.openBucket(attemptCtx, u)
+	if err != nil {
+		return err
+	}
+
+	defer bucket.Close()
+
+	attrs, err := bucket.Attributes(attemptCtx, key)
+	if err != nil {
+		return bucketError(u, err)
+	}
+
+	switch {
+	case offset == attrs.Size:
+		// the file was previously downloaded completely
+		return nil
+	case offset > attrs.Size:
+		if err := fileHandle.Truncate(0); err != nil {
+			return err
+		}
+
+		return errors.Wrap(errResumable, "partial file larger than object")
+	}
+
+	// preflight - the file system is expected to have room for the remaining bytes
+	if err := checkDiskSpace(fileHandle.Name(), attrs.Size-offset); err != nil {
+		return err
+	}
+
+	reader, err := bucket.NewRangeReader(attemptCtx, key, offset, -1, nil)
+	if err != nil {
+		return bucketError(u, err)
+	}
+
+	defer reader.Close()
+
+	return d.copy(ctx, fileHandle, reader, offset, attrs.Size)
+}
+
+// readBucket returns the contents of the object identified by the URL, upto limit bytes are read.
+func (d *downloader) readBucket(ctx context.Context, u *url.URL, limit int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	bucket, key, err := d.openBucket(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	defer bucket.Close()
+
+	reader, err := bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		return nil, bucketError(u, err)
+	}
+
+	defer reader.Close()
+
+	return io.ReadAll(io.LimitReader(reader, limit))
+}
+
+// bucketError returns ErrDownload for errors that are not expected to be resolved by a retry.
+func bucketError(u *url.URL, err error) error {
+	switch gcerrors.Code(err) {
+	case gcerrors.NotFound, gcerrors.PermissionDenied, gcerrors.InvalidArgument:
+		return errors.Wrap(ErrDownload, "URL: "+u.Redacted()+", "+err.Error())
+	default:
+		return errors.Wrap(errResumable, err.Error())
+	}
+}
@@ -0,0 +1,165 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromURLToFileLocal(t *testing.T) {
+	content := []byte(strings.Repeat("BLOB", 1024))
+
+	src := filepath.Join(t.TempDir(), "blob.bin")
+	require.Nil(t, os.WriteFile(src, content, 0o600))
+
+	fileURL := "file://" + filepath.ToSlash(src)
+
+	tests := []struct {
+		name        string
+		url         string
+		existing    []byte
+		expectedErr error
+	}{
+		{"file is downloaded", fileURL, nil, nil},
+		{"partial file is resumed", fileURL, content[:100], nil},
+		{"complete file is not downloaded again", fileURL, content, nil},
+		{"not found", "file://" + filepath.ToSlash(filepath.Join(filepath.Dir(src), "foo.bin")), nil, ErrDownload},
+		{"unsupported scheme", "ftp://example.com/blob.bin", nil, ErrDownload},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "blob.bin")
+			if tc.existing != nil {
+				require.Nil(t, os.WriteFile(dst, tc.existing, 0o600))
+			}
+
+			var progress []Progress
+			err := FromURLToFile(context.Background(), tc.url, dst, WithProgress(time.Nanosecond, func(p Progress) {
+				progress = append(progress, p)
+			}))
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+
+			require.Nil(t, err)
+
+			got, err := os.ReadFile(dst)
+			require.Nil(t, err)
+			assert.Equal(t, content, got)
+
+			if len(tc.existing) < len(content) {
+				require.NotEmpty(t, progress)
+				assert.Equal(t, int64(len(content)), progress[len(progress)-1].Bytes)
+			}
+		})
+	}
+}
+
+// newTestS3Server returns a stand-in S3 server, serving objects from path style URLs.
+func newTestS3Server(t *testing.T, objects map[string][]byte, ranges *[]string) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, exists := objects[r.URL.Path]
+		if !exists {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+
+			if r.Method != http.MethodHead {
+				_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`))
+			}
+
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			*ranges = append(*ranges, r.Header.Get("Range"))
+			mu.Unlock()
+		}
+
+		w.Header().Set("ETag", `"etag"`)
+		http.ServeContent(w, r, "", time.Unix(1700000000, 0), bytes.NewReader(content))
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestFromURLToFileS3(t *testing.T) {
+	content := []byte(strings.Repeat("BLOB", 1024))
+
+	var ranges []string
+	server := newTestS3Server(t, map[string][]byte{"/firmware/dell/blob.bin": content}, &ranges)
+
+	creds := WithBucketCredentials(&BucketCredentials{
+		S3Region:          "us-east-1",
+		S3Endpoint:        server.URL,
+		S3AccessKeyID:     "foo",
+		S3SecretAccessKey: "bar",
+		S3UsePathStyle:    true,
+	})
+
+	t.Run("partial file is resumed", func(t *testing.T) {
+		ranges = nil
+
+		dst := filepath.Join(t.TempDir(), "blob.bin")
+		require.Nil(t, os.WriteFile(dst, content[:100], 0o600))
+
+		require.Nil(t, FromURLToFile(context.Background(), "s3://firmware/dell/blob.bin", dst, creds))
+
+		got, err := os.ReadFile(dst)
+		require.Nil(t, err)
+		assert.Equal(t, content, got)
+		assert.Equal(t, []string{"bytes=100-"}, ranges)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "blob.bin")
+
+		err := FromURLToFile(context.Background(), "s3://firmware/dell/foo.bin", dst, creds)
+		assert.ErrorIs(t, err, ErrDownload)
+	})
+}
+
+func TestSignatureVerifyLocal(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	dir := t.TempDir()
+	message := []byte("BLOB")
+
+	file := filepath.Join(dir, "blob.bin")
+	require.Nil(t, os.WriteFile(file, message, 0o600))
+
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, message))
+	require.Nil(t, os.WriteFile(file+".sig", []byte(sig), 0o600))
+
+	trustStore := filepath.Join(dir, "trusted.pub")
+	require.Nil(t, os.WriteFile(trustStore, []byte(base64.StdEncoding.EncodeToString(pub)), 0o600))
+
+	verifier, err := NewSignatureVerifier(SignaturePolicyEnforce, trustStore, "", logrus.New())
+	require.Nil(t, err)
+
+	assert.Nil(t, verifier.Verify(context.Background(), "file://"+filepath.ToSlash(file), file))
+	assert.ErrorIs(t, verifier.Verify(context.Background(), "file://"+filepath.ToSlash(trustStore), file), ErrSignatureMissing)
+}
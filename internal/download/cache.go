@@ -0,0 +1,397 @@
+package download
+
+import (
+	"container/list"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/metal-automata/agent/internal/metrics"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+
+	// prefix for directories holding downloads in progress
+	cacheTmpPrefix = ".download-"
+
+	// partial downloads older than this are purged when the cache is initialized
+	cachePartialMaxAge = 24 * time.Hour
+)
+
+var (
+	ErrCache = errors.New("firmware cache error")
+)
+
+// Cache is a local firmware file cache, files are keyed by their checksum.
+//
+// Files in the cache are referenced by the tasks using them and are not evicted until released,
+// unreferenced files are evicted in least recently used order once the cache exceeds its size limit.
+type Cache struct {
+	dir     string
+	maxSize int64
+	logger  *logrus.Logger
+
+	mu   sync.Mutex
+	size int64
+	// entries indexed by cache key
+	entries map[string]*cacheEntry
+	// lru list of entries, the front being the most recently used.
+	lru *list.List
+	// downloads in progress indexed by cache key
+	inflight map[string]*inflightDownload
+}
+
+type cacheEntry struct {
+	key  string
+	file string
+	size int64
+	refs int
+	elem *list.Element
+}
+
+type inflightDownload struct {
+	done chan struct{}
+	err  error
+}
+
+// NewCache returns a firmware Cache rooted in the given directory.
+//
+// Files previously downloaded into the directory are indexed, a maxSize of 0 disables eviction.
+func NewCache(dir string, maxSize int64, logger *logrus.Logger) (*Cache, error) {
+	if dir == "" {
+		return nil, errors.Wrap(ErrCache, "expected a cache directory")
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, errors.Wrap(ErrCache, err.Error())
+	}
+
+	c := &Cache{
+		dir:      dir,
+		maxSize:  maxSize,
+		logger:   logger,
+		entries:  make(map[string]*cacheEntry),
+		lru:      list.New(),
+		inflight: make(map[string]*inflightDownload),
+	}
+
+	if err := c.index(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// index loads the files present in the cache directory.
+func (c *Cache) index() error {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return errors.Wrap(ErrCache, err.Error())
+	}
+
+	type found struct {
+		entry   *cacheEntry
+		modTime time.Time
+	}
+
+	files := []found{}
+
+	for _, d := range dirEntries {
+		if !d.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(c.dir, d.Name())
+
+		// partial downloads are retained to be resumed, unless they are stale
+		if strings.HasPrefix(d.Name(), cacheTmpPrefix) {
+			if info, err := d.Info(); err == nil && time.Since(info.ModTime()) > cachePartialMaxAge {
+				os.RemoveAll(path)
+			}
+
+			continue
+		}
+
+		contents, err := os.ReadDir(path)
+		if err != nil || len(contents) != 1 || contents[0].IsDir() {
+			c.logger.WithField("dir", path).Warn("unexpected firmware cache directory contents, ignored")
+			continue
+		}
+
+		info, err := contents[0].Info()
+		if err != nil {
+			continue
+		}
+
+		files = append(files, found{
+			entry: &cacheEntry{
+				key:  d.Name(),
+				file: filepath.Join(path, contents[0].Name()),
+				size: info.Size(),
+			},
+			modTime: info.ModTime(),
+		})
+	}
+
+	// most recently used first
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+
+	for _, f := range files {
+		f.entry.elem = c.lru.PushBack(f.entry)
+		c.entries[f.entry.key] = f.entry
+		c.size += f.entry.size
+	}
+
+	c.evict()
+
+	return nil
+}
+
+// cacheKey returns the key for the given checksum, checksums of the same digest kind and value
+// return the same key regardless of the prefix and case.
+func cacheKey(checksum string) (string, error) {
+	kind, digest, _, err := parseChecksum(checksum)
+	if err != nil {
+		return "", err
+	}
+
+	if digest == "" || strings.ContainsAny(digest, `/\.`) {
+		return "", errors.Wrap(ErrFormat, "invalid checksum: "+checksum)
+	}
+
+	return kind + "-" + strings.ToLower(digest), nil
+}
+
+// Fetch returns the path to the cached firmware file identified by the checksum,
+// downloading and validating the file from the fileURL if its not present in the cache.
+// Cached files are validated against the checksum on each fetch, an invalid file is evicted and downloaded again.
+//
+// Concurrent callers fetching the same file share a single download, the download options
+// are applied to the download initiated by the first caller.
+// The returned file is referenced until its passed to Release.
+func (c *Cache) Fetch(ctx context.Context, fileURL, checksum, filename string, options ...Option) (string, error) {
+	key, err := cacheKey(checksum)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		c.mu.Lock()
+
+		if entry, exists := c.entries[key]; exists {
+			entry.refs++
+			c.lru.MoveToFront(entry.elem)
+			c.mu.Unlock()
+
+			// the cached file is validated on each use, a file damaged on disk is downloaded again
+			if err := ChecksumValidate(ctx, entry.file, checksum); err != nil {
+				if ctx.Err() != nil {
+					c.Release(entry.file)
+					return "", ctx.Err()
+				}
+
+				c.logger.WithError(err).WithField("file", entry.file).Warn("cached firmware file invalid, evicted from cache")
+				c.drop(entry)
+
+				continue
+			}
+
+			// update the modification time to retain the usage order across restarts
+			now := time.Now()
+			_ = os.Chtimes(entry.file, now, now)
+
+			metrics.FirmwareCacheRequests.With(prometheus.Labels{"result": cacheHit}).Inc()
+
+			return entry.file, nil
+		}
+
+		if d, exists := c.inflight[key]; exists {
+			c.mu.Unlock()
+
+			select {
+			case <-d.done:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+
+			// retry when the download succeeded, or when the caller that initiated the download was canceled
+			if d.err != nil && !errors.Is(d.err, context.Canceled) && !errors.Is(d.err, context.DeadlineExceeded) {
+				return "", d.err
+			}
+
+			continue
+		}
+
+		d := &inflightDownload{done: make(chan struct{})}
+		c.inflight[key] = d
+		c.mu.Unlock()
+
+		metrics.FirmwareCacheRequests.With(prometheus.Labels{"result": cacheMiss}).Inc()
+
+		entry, err := c.download(ctx, key, fileURL, checksum, filename, options...)
+
+		c.mu.Lock()
+		delete(c.inflight, key)
+		d.err = err
+
+		if err == nil {
+			entry.refs = 1
+			entry.elem = c.lru.PushFront(entry)
+			c.entries[key] = entry
+			c.size += entry.size
+			c.evict()
+		}
+
+		c.mu.Unlock()
+		close(d.done)
+
+		if err != nil {
+			return "", err
+		}
+
+		return entry.file, nil
+	}
+}
+
+// download fetches the file into a partial download directory which is moved into the cache once validated,
+// the partial download directory is retained when the download fails so that it can be resumed.
+func (c *Cache) download(ctx context.Context, key, fileURL, checksum, filename string, options ...Option) (*cacheEntry, error) {
+	tmpDir := filepath.Join(c.dir, cacheTmpPrefix+key)
+	if err := os.MkdirAll(tmpDir, 0o750); err != nil {
+		return nil, errors.Wrap(ErrCache, err.Error())
+	}
+
+	filename = filepath.Base(filename)
+	if filename == "." || filename == string(filepath.Separator) {
+		filename = key
+	}
+
+	if err := FromURLToFile(ctx, fileURL, filepath.Join(tmpDir, filename), options...); err != nil {
+		return nil, err
+	}
+
+	if err := ChecksumValidate(ctx, filepath.Join(tmpDir, filename), checksum); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	info, err := os.Stat(filepath.Join(tmpDir, filename))
+	if err != nil {
+		return nil, errors.Wrap(ErrCache, err.Error())
+	}
+
+	dir := filepath.Join(c.dir, key)
+
+	// remove any leftover contents not indexed
+	os.RemoveAll(dir)
+
+	if err := os.Rename(tmpDir, dir); err != nil {
+		return nil, errors.Wrap(ErrCache, err.Error())
+	}
+
+	c.logger.WithFields(
+		logrus.Fields{
+			"url":  fileURL,
+			"file": filepath.Join(dir, filename),
+			"size": info.Size(),
+		}).Debug("firmware file added to cache")
+
+	return &cacheEntry{key: key, file: filepath.Join(dir, filename), size: info.Size()}, nil
+}
+
+// Contains returns true if the file is held in the cache.
+func (c *Cache) Contains(file string) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.entryByFile(file) != nil
+}
+
+// Release drops a reference to the cached file returned by Fetch,
+// files without references are eligible for eviction.
+func (c *Cache) Release(file string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entryByFile(file)
+	if entry == nil || entry.refs == 0 {
+		return
+	}
+
+	entry.refs--
+
+	c.evict()
+}
+
+// drop removes the entry from the cache index, its file is replaced when the firmware is downloaded again.
+func (c *Cache) drop(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries[entry.key] != entry {
+		return
+	}
+
+	c.lru.Remove(entry.elem)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+
+	metrics.FirmwareCacheBytes.Set(float64(c.size))
+}
+
+func (c *Cache) entryByFile(file string) *cacheEntry {
+	for _, entry := range c.entries {
+		if entry.file == file {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+// evict removes the least recently used files without references until the cache is within its size limit.
+//
+// The caller is expected to hold the lock.
+func (c *Cache) evict() {
+	defer metrics.FirmwareCacheBytes.Set(float64(c.size))
+
+	if c.maxSize <= 0 {
+		return
+	}
+
+	for elem := c.lru.Back(); elem != nil && c.size > c.maxSize; {
+		entry := elem.Value.(*cacheEntry)
+		prev := elem.Prev()
+
+		if entry.refs == 0 {
+			if err := os.RemoveAll(filepath.Dir(entry.file)); err != nil {
+				c.logger.WithError(err).WithField("file", entry.file).Warn("error removing firmware cache file")
+			}
+
+			c.lru.Remove(elem)
+			delete(c.entries, entry.key)
+			c.size -= entry.size
+
+			c.logger.WithField("file", entry.file).Debug("firmware file evicted from cache")
+		}
+
+		elem = prev
+	}
+}
@@ -0,0 +1,149 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// checksums of the file contents 'BLOB' and 'BLOB2'
+	testBlobSHA256  = "sha256:671a0d168d8e3d31819402ac7c3a3cc0abedebbf6a4cda26deacd89724bd6bdc"
+	testBlobMD5     = "1649cff06611a6025da3dd511a97fb43"
+	testBlob2MD5sum = "md5sum:ede317a5bcf31162bdaa550f79540c4b"
+)
+
+func newTestFileServer(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		switch r.URL.Path {
+		case "/blob":
+			_, _ = w.Write([]byte("BLOB"))
+		case "/blob2":
+			_, _ = w.Write([]byte("BLOB2"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestCacheFetch(t *testing.T) {
+	var requests atomic.Int32
+	server := newTestFileServer(t, &requests)
+
+	dir := t.TempDir()
+	cache, err := NewCache(dir, 0, logrus.New())
+	require.Nil(t, err)
+
+	// concurrent fetches share a single download
+	var wg sync.WaitGroup
+	files := make([]string, 5)
+
+	for i := range files {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			file, errFetch := cache.Fetch(context.Background(), server.URL+"/blob", testBlobSHA256, "blob.bin")
+			assert.Nil(t, errFetch)
+
+			files[i] = file
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), requests.Load())
+
+	for _, file := range files {
+		assert.Equal(t, files[0], file)
+	}
+
+	assert.Equal(t, "blob.bin", filepath.Base(files[0]))
+	assert.True(t, cache.Contains(files[0]))
+
+	// the same checksum in a different format is a cache hit
+	file, err := cache.Fetch(context.Background(), server.URL+"/blob", "sha256:671A0D168D8E3D31819402AC7C3A3CC0ABEDEBBF6A4CDA26DEACD89724BD6BDC", "blob.bin")
+	require.Nil(t, err)
+	assert.Equal(t, files[0], file)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// checksum mismatch
+	_, err = cache.Fetch(context.Background(), server.URL+"/blob", "md5sum:bee8af7a84cb640cff90cf31fbf56950", "blob.bin")
+	assert.ErrorIs(t, err, ErrChecksum)
+
+	// cached files are indexed on init
+	reloaded, err := NewCache(dir, 0, logrus.New())
+	require.Nil(t, err)
+	assert.True(t, reloaded.Contains(files[0]))
+
+	// failed downloads are not retained
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	assert.Len(t, entries, 1)
+
+	// a cached file damaged on disk is downloaded again
+	require.Nil(t, os.WriteFile(files[0], []byte("BLOB-damaged"), 0o600))
+
+	file, err = reloaded.Fetch(context.Background(), server.URL+"/blob", testBlobSHA256, "blob.bin")
+	require.Nil(t, err)
+	assert.Equal(t, files[0], file)
+	assert.Equal(t, int32(3), requests.Load())
+
+	contents, err := os.ReadFile(file)
+	require.Nil(t, err)
+	assert.Equal(t, "BLOB", string(contents))
+}
+
+func TestCacheEviction(t *testing.T) {
+	var requests atomic.Int32
+	server := newTestFileServer(t, &requests)
+
+	// size limit allows a single file
+	cache, err := NewCache(t.TempDir(), 5, logrus.New())
+	require.Nil(t, err)
+
+	blob, err := cache.Fetch(context.Background(), server.URL+"/blob", testBlobMD5, "blob.bin")
+	require.Nil(t, err)
+
+	// referenced files are not evicted
+	blob2, err := cache.Fetch(context.Background(), server.URL+"/blob2", testBlob2MD5sum, "blob2.bin")
+	require.Nil(t, err)
+
+	assert.True(t, cache.Contains(blob))
+	assert.True(t, cache.Contains(blob2))
+
+	// least recently used files are evicted once released
+	cache.Release(blob)
+	assert.False(t, cache.Contains(blob))
+	assert.True(t, cache.Contains(blob2))
+
+	_, err = os.Stat(blob)
+	assert.True(t, os.IsNotExist(err))
+
+	// released file is evicted on the next fetch
+	cache.Release(blob2)
+	assert.True(t, cache.Contains(blob2))
+
+	_, err = cache.Fetch(context.Background(), server.URL+"/blob", testBlobMD5, "blob.bin")
+	require.Nil(t, err)
+	assert.False(t, cache.Contains(blob2))
+	assert.Equal(t, int32(3), requests.Load())
+}
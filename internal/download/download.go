@@ -1,13 +1,18 @@
 package download
 
 import (
-	"bytes"
 	"context"
 	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,76 +25,434 @@ var (
 	// allow upto 5 minutes of timeout for downloading over slow connections
 	downloadClientTimeout = 300 * time.Second
 
+	// the number of consecutive resume attempts without any bytes transferred, after which the download fails.
+	maxResumeAttempts = 3
+
+	// the default interval at which download progress is reported
+	defaultProgressInterval = 30 * time.Second
+
 	ErrDownload = errors.New("error downloading file")
 	ErrChecksum = errors.New("error validating file checksum")
 	ErrFormat   = errors.New("bad checksum format")
+
+	// errResumable is returned when the download was interrupted and can be resumed.
+	errResumable = errors.New("download interrupted")
 )
 
+// Progress is the download progress reported periodically when a progress func is set.
+type Progress struct {
+	// Bytes is the number of bytes downloaded, including bytes downloaded by previous attempts.
+	Bytes int64
+	// Total is the size of the file, this is -1 when unknown.
+	Total int64
+	// Rate is the download rate in bytes per second for the current attempt.
+	Rate float64
+}
+
+func (p Progress) String() string {
+	if p.Total <= 0 {
+		return fmt.Sprintf("downloaded %s, %s/s", formatBytes(float64(p.Bytes)), formatBytes(p.Rate))
+	}
+
+	return fmt.Sprintf(
+		"downloaded %s of %s (%d%%), %s/s",
+		formatBytes(float64(p.Bytes)),
+		formatBytes(float64(p.Total)),
+		p.Bytes*100/p.Total,
+		formatBytes(p.Rate),
+	)
+}
+
+func formatBytes(b float64) string {
+	const unit = 1024
+
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+
+	idx := 0
+	for b >= unit && idx < len(units)-1 {
+		b /= unit
+		idx++
+	}
+
+	return fmt.Sprintf("%.1f %s", b, units[idx])
+}
+
+// Option sets parameters on a file download
+type Option func(*downloader)
+
+type downloader struct {
+	timeout          time.Duration
+	progressInterval time.Duration
+	progressFn       func(Progress)
+	// bucketCredentials is used to access files on object storage buckets
+	bucketCredentials *BucketCredentials
+}
+
+// WithTimeout sets the timeout for each download attempt, an interrupted download is resumed by the subsequent attempt.
+func WithTimeout(timeout time.Duration) Option {
+	return func(d *downloader) {
+		if timeout > 0 {
+			d.timeout = timeout
+		}
+	}
+}
+
+// WithProgress sets the func to which download progress is reported at the given interval.
+func WithProgress(interval time.Duration, fn func(Progress)) Option {
+	return func(d *downloader) {
+		if interval > 0 {
+			d.progressInterval = interval
+		}
+
+		d.progressFn = fn
+	}
+}
+
+func newDownloader(options ...Option) *downloader {
+	d := &downloader{
+		timeout:          downloadClientTimeout,
+		progressInterval: defaultProgressInterval,
+	}
+
+	for _, opt := range options {
+		opt(d)
+	}
+
+	return d
+}
+
 // FromURLToFile fetches the file into dst
-func FromURLToFile(ctx context.Context, fileURL, dst string) error {
-	// create file
-	fileHandle, err := os.Create(dst)
+//
+// The fileURL may be a http(s) URL, an object storage URL - s3://bucket/key, gs://bucket/key or a local file:// URL.
+//
+// When dst holds a partially downloaded file, the download is resumed using HTTP range requests,
+// downloads interrupted while transferring the file contents are resumed as long as progress is being made.
+//
+// ErrDiskSpace is returned when the file size is known and the dst filesystem does not have room for it.
+func FromURLToFile(ctx context.Context, fileURL, dst string, options ...Option) error {
+	d := newDownloader(options...)
+
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return errors.Wrap(ErrDownload, err.Error())
+	}
+
+	fetch := d.fetch
+
+	switch {
+	case u.Scheme == "http" || u.Scheme == "https":
+	case isBucketURL(u):
+		fetch = func(ctx context.Context, _ string, fileHandle *os.File, offset int64) error {
+			return d.fetchBucket(ctx, u, fileHandle, offset)
+		}
+	default:
+		return errors.Wrap(ErrDownload, "unsupported URL scheme: "+u.Scheme)
+	}
+
+	// open file, any existing contents are retained to resume the download
+	fileHandle, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, 0o600)
 	if err != nil {
 		return err
 	}
 
 	defer fileHandle.Close()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", fileURL, http.NoBody)
+	var attempts int
+
+	for {
+		offset, err := fileHandle.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+
+		err = fetch(ctx, fileURL, fileHandle, offset)
+		if err == nil || !errors.Is(err, errResumable) || ctx.Err() != nil {
+			return err
+		}
+
+		current, errSeek := fileHandle.Seek(0, io.SeekEnd)
+		if errSeek != nil {
+			return errSeek
+		}
+
+		// reset attempts when the previous attempt made progress
+		if current > offset {
+			attempts = 0
+		}
+
+		attempts++
+		if attempts > maxResumeAttempts {
+			return errors.Wrap(ErrDownload, err.Error())
+		}
+
+		select {
+		case <-time.After(downloadRetryDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// fetch downloads the fileURL contents from the offset into the fileHandle.
+func (d *downloader) fetch(ctx context.Context, fileURL string, fileHandle *os.File, offset int64) error {
+	headers := map[string]string{}
+	if offset > 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+	}
+
+	resp, err := request(ctx, fileURL, headers, d.timeout)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
-	requestRetryable, err := retryablehttp.FromRequest(req)
-	if err != nil {
+	total := resp.ContentLength
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// range not supported by the server, or a full download was requested
+		if offset > 0 {
+			if err := fileHandle.Truncate(0); err != nil {
+				return err
+			}
+
+			if _, err := fileHandle.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+
+			offset = 0
+		}
+
+	case http.StatusPartialContent:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			// restart the download
+			if err := fileHandle.Truncate(0); err != nil {
+				return err
+			}
+
+			return errors.Wrap(errResumable, "unexpected Content-Range: "+resp.Header.Get("Content-Range"))
+		}
+
+		total = size
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the file was previously downloaded completely
+		_, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if ok && size == offset {
+			return nil
+		}
+
+		if err := fileHandle.Truncate(0); err != nil {
+			return err
+		}
+
+		return errors.Wrap(errResumable, "requested range not satisfiable")
+
+	default:
+		return errors.Wrap(ErrDownload, fmt.Sprintf("URL: %s, status code %s", fileURL, resp.Status))
+	}
+
+	// preflight - the file system is expected to have room for the remaining bytes
+	if err := checkDiskSpace(fileHandle.Name(), total-offset); err != nil {
 		return err
 	}
 
-	client := retryablehttp.NewClient()
-	client.RetryWaitMin = downloadRetryDelay
-	client.Logger = nil
-	client.HTTPClient.Timeout = downloadClientTimeout
+	return d.copy(ctx, fileHandle, resp.Body, offset, total)
+}
+
+// copy writes the contents of the src into the fileHandle, reporting progress when a progress func is set.
+func (d *downloader) copy(ctx context.Context, fileHandle *os.File, src io.Reader, offset, total int64) error {
+	reader := src
+	if d.progressFn != nil {
+		reader = &progressReader{
+			r:        src,
+			fn:       d.progressFn,
+			interval: d.progressInterval,
+			offset:   offset,
+			total:    total,
+			start:    time.Now(),
+			last:     time.Now(),
+		}
+	}
+
+	if _, err := io.Copy(fileHandle, reader); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return errors.Wrap(errResumable, err.Error())
+	}
 
-	resp, err := client.Do(requestRetryable)
+	return nil
+}
+
+// parseContentRange returns the start offset and the total size from a Content-Range header value,
+// the start offset is -1 for unsatisfied ranges - bytes */<size>
+func parseContentRange(value string) (start, size int64, ok bool) {
+	value = strings.TrimPrefix(value, "bytes ")
+
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	size, err := strconv.ParseInt(parts[1], 10, 64)
 	if err != nil {
-		return err
+		return 0, 0, false
+	}
+
+	if parts[0] == "*" {
+		return -1, size, true
+	}
+
+	start, err = strconv.ParseInt(strings.Split(parts[0], "-")[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return start, size, true
+}
+
+// progressReader reports the download progress to the progress func at the configured interval.
+type progressReader struct {
+	r        io.Reader
+	fn       func(Progress)
+	interval time.Duration
+	// offset is the number of bytes downloaded by previous attempts
+	offset,
+	read,
+	// total is the size of the complete file
+	total int64
+	start,
+	last time.Time
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+
+	if time.Since(p.last) >= p.interval || errors.Is(err, io.EOF) {
+		p.last = time.Now()
+
+		var rate float64
+		if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+			rate = float64(p.read) / elapsed
+		}
+
+		p.fn(Progress{Bytes: p.offset + p.read, Total: p.total, Rate: rate})
+	}
+
+	return n, err
+}
+
+// read returns the contents of the fileURL, upto limit bytes are read.
+func (d *downloader) read(ctx context.Context, fileURL string, limit int64) ([]byte, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return nil, errors.Wrap(ErrDownload, err.Error())
+	}
+
+	if isBucketURL(u) {
+		return d.readBucket(ctx, u, limit)
+	}
+
+	resp, err := request(ctx, fileURL, nil, d.timeout)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	// Check server response
 	if resp.StatusCode != http.StatusOK {
-		return errors.Wrap(ErrDownload, fmt.Sprintf("URL: %s, status code %s", fileURL, resp.Status))
+		return nil, errors.Wrap(ErrDownload, fmt.Sprintf("URL: %s, status code %s", fileURL, resp.Status))
 	}
 
-	_, err = io.Copy(fileHandle, resp.Body)
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
 
-	return err
+// request returns the response for a GET request to the fileURL with the given headers.
+func request(ctx context.Context, fileURL string, headers map[string]string, timeout time.Duration) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fileURL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	requestRetryable, err := retryablehttp.FromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	client := retryablehttp.NewClient()
+	client.RetryWaitMin = downloadRetryDelay
+	client.Logger = nil
+	client.HTTPClient.Timeout = timeout
+
+	return client.Do(requestRetryable)
+}
+
+// ChecksumValidate validates the checksum of the given file.
+//
+// The checksum is expected to be prefixed with the digest kind - md5sum:, sha256:, sha512:,
+// when no prefix is present, the digest is identified by the length of the hex encoded checksum.
+func ChecksumValidate(ctx context.Context, filename, checksum string) error {
+	_, digest, newHash, err := parseChecksum(checksum)
+	if err != nil {
+		return err
+	}
+
+	return checksumValidate(ctx, filename, digest, newHash)
 }
 
-func ChecksumValidate(filename, checksum string) error {
-	// no checksum prefix, default to md5sum
+// parseChecksum returns the digest kind, the hex encoded digest and the hash func for the given checksum.
+func parseChecksum(checksum string) (kind, digest string, newHash func() hash.Hash, err error) {
+	// no checksum prefix, identify digest by its length
 	if !strings.Contains(checksum, ":") {
-		return checksumValidateMD5(filename, checksum)
+		switch len(checksum) {
+		case sha256.Size * 2:
+			return "sha256", checksum, sha256.New, nil
+		case sha512.Size * 2:
+			return "sha512", checksum, sha512.New, nil
+		default:
+			return "md5", checksum, md5.New, nil
+		}
 	}
 
 	parts := strings.Split(checksum, ":")
 	if len(parts) != 2 {
-		return errors.Wrap(ErrFormat, "invalid checksum: "+checksum)
+		return "", "", nil, errors.Wrap(ErrFormat, "invalid checksum: "+checksum)
 	}
 
 	switch parts[0] {
-	case "md5sum":
-		return checksumValidateMD5(filename, parts[1])
+	case "md5sum", "md5":
+		return "md5", parts[1], md5.New, nil
+	case "sha256sum", "sha256":
+		return "sha256", parts[1], sha256.New, nil
+	case "sha512sum", "sha512":
+		return "sha512", parts[1], sha512.New, nil
 	default:
-		return errors.Wrap(ErrFormat, "unsupported digest: "+parts[0])
+		return "", "", nil, errors.Wrap(ErrFormat, "unsupported digest: "+parts[0])
 	}
 }
 
-func checksumValidateMD5(filename, checksum string) error {
-	var err error
+// contextReader returns an error on Read once the context is canceled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
 
-	expectedChecksum := []byte(checksum)
+	return c.r.Read(p)
+}
 
+func checksumValidate(ctx context.Context, filename, checksum string, newHash func() hash.Hash) error {
 	if filename == "" {
 		return errors.Wrap(ErrChecksum, "expected a filename to validate checksum")
 	}
@@ -101,20 +464,19 @@ func checksumValidateMD5(filename, checksum string) error {
 	}
 	defer f.Close()
 
-	h := md5.New()
+	h := newHash()
 
-	// TODO(joel) - wrap this within a context
-	if _, err := io.Copy(h, f); err != nil {
+	if _, err := io.Copy(h, &contextReader{ctx: ctx, r: f}); err != nil {
 		return errors.Wrap(ErrChecksum, err.Error())
 	}
 
-	calculatedChecksum := fmt.Sprintf("%x", h.Sum(nil))
-	if !bytes.Equal(expectedChecksum, []byte(calculatedChecksum)) {
+	calculatedChecksum := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(checksum, calculatedChecksum) {
 		errMsg := fmt.Sprintf(
 			"filename: %s expected: %s, got: %s",
 			filename,
-			string(expectedChecksum),
-			string(calculatedChecksum),
+			checksum,
+			calculatedChecksum,
 		)
 
 		return errors.Wrap(ErrChecksum, errMsg)
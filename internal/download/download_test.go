@@ -1,11 +1,22 @@
 package download
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestChecksumValidate(t *testing.T) {
@@ -39,6 +50,36 @@ func TestChecksumValidate(t *testing.T) {
 			"md5sum:1649:cff06611a6025da3dd511a97fb43",
 			ErrFormat,
 		},
+		{
+			"sha256 prefix defined",
+			"foo.bin",
+			"sha256:671a0d168d8e3d31819402ac7c3a3cc0abedebbf6a4cda26deacd89724bd6bdc",
+			nil,
+		},
+		{
+			"sha256 checksum is wrong",
+			"foo.bin",
+			"sha256:4189d3cb123a781d09a4f568bb686b23c6d8e6b82038eba8222b91c380a25281",
+			ErrChecksum,
+		},
+		{
+			"sha512 prefix defined",
+			"foo.bin",
+			"sha512:477e8c21073d0066168326cafba3c840858f68bd8ccbfcd5676f892b6f23c622a2c82c5e71d9d045b05a7a20f40650316169b388ad8cb57abe4d086e1be1dfa6",
+			nil,
+		},
+		{
+			"no checksum prefix defined, sha256 identified by length",
+			"foo.bin",
+			"671A0D168D8E3D31819402AC7C3A3CC0ABEDEBBF6A4CDA26DEACD89724BD6BDC",
+			nil,
+		},
+		{
+			"no checksum prefix defined, sha512 identified by length",
+			"foo.bin",
+			"477e8c21073d0066168326cafba3c840858f68bd8ccbfcd5676f892b6f23c622a2c82c5e71d9d045b05a7a20f40650316169b388ad8cb57abe4d086e1be1dfa6",
+			nil,
+		},
 		{
 			"unsupported digest format",
 			"foo.bin",
@@ -57,7 +98,7 @@ func TestChecksumValidate(t *testing.T) {
 
 			defer os.Remove(binPath)
 
-			err = ChecksumValidate(binPath, tt.checksum)
+			err = ChecksumValidate(context.Background(), binPath, tt.checksum)
 			if tt.expectedError != nil {
 				assert.ErrorIs(t, err, tt.expectedError)
 				return
@@ -66,5 +107,117 @@ func TestChecksumValidate(t *testing.T) {
 			assert.Nil(t, err)
 		})
 	}
+}
+
+func TestChecksumValidateContextCanceled(t *testing.T) {
+	binPath := filepath.Join(t.TempDir(), "foo.bin")
+	if err := os.WriteFile(binPath, []byte(`BLOB`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := ChecksumValidate(ctx, binPath, "sha256:671a0d168d8e3d31819402ac7c3a3cc0abedebbf6a4cda26deacd89724bd6bdc")
+	assert.ErrorIs(t, err, ErrChecksum)
+	assert.Contains(t, err.Error(), context.Canceled.Error())
+}
+
+func TestFromURLToFileResume(t *testing.T) {
+	// reduce the delay between resume attempts
+	delay := downloadRetryDelay
+	downloadRetryDelay = 10 * time.Millisecond
+
+	defer func() { downloadRetryDelay = delay }()
+
+	content := []byte(strings.Repeat("BLOB", 1024))
+
+	var requests atomic.Int32
+	var ranges []string
+	var mu sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+
+		// the first request is interrupted after half the content is transferred
+		if requests.Add(1) == 1 && r.URL.Path == "/interrupted" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+
+			panic(http.ErrAbortHandler)
+		}
+
+		if r.URL.Path == "/foo" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		http.ServeContent(w, r, "blob.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	t.Run("partial file is resumed", func(t *testing.T) {
+		requests.Store(100)
+		ranges = nil
+
+		dst := filepath.Join(t.TempDir(), "blob.bin")
+		require.Nil(t, os.WriteFile(dst, content[:100], 0o600))
+
+		var progress []Progress
+		err := FromURLToFile(context.Background(), server.URL+"/blob", dst, WithProgress(time.Nanosecond, func(p Progress) {
+			progress = append(progress, p)
+		}))
+		require.Nil(t, err)
+
+		got, err := os.ReadFile(dst)
+		require.Nil(t, err)
+		assert.Equal(t, content, got)
+		assert.Equal(t, []string{"bytes=100-"}, ranges)
+
+		require.NotEmpty(t, progress)
+		assert.Equal(t, int64(len(content)), progress[len(progress)-1].Bytes)
+		assert.Equal(t, int64(len(content)), progress[len(progress)-1].Total)
+	})
+
+	t.Run("complete file is not downloaded again", func(t *testing.T) {
+		requests.Store(100)
+		ranges = nil
+
+		dst := filepath.Join(t.TempDir(), "blob.bin")
+		require.Nil(t, os.WriteFile(dst, content, 0o600))
+
+		require.Nil(t, FromURLToFile(context.Background(), server.URL+"/blob", dst))
+
+		got, err := os.ReadFile(dst)
+		require.Nil(t, err)
+		assert.Equal(t, content, got)
+	})
+
+	t.Run("interrupted download is resumed", func(t *testing.T) {
+		requests.Store(0)
+		ranges = nil
+
+		dst := filepath.Join(t.TempDir(), "blob.bin")
+
+		require.Nil(t, FromURLToFile(context.Background(), server.URL+"/interrupted", dst))
+
+		got, err := os.ReadFile(dst)
+		require.Nil(t, err)
+		assert.Equal(t, content, got)
+		assert.Equal(t, []string{"", fmt.Sprintf("bytes=%d-", len(content)/2)}, ranges)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "blob.bin")
+		err := FromURLToFile(context.Background(), server.URL+"/foo", dst, WithTimeout(time.Second))
+		assert.ErrorIs(t, err, ErrDownload)
+	})
+}
 
+func TestProgressString(t *testing.T) {
+	assert.Equal(t, "downloaded 1.0 MiB of 4.0 MiB (25%), 512.0 KiB/s", Progress{Bytes: 1 << 20, Total: 4 << 20, Rate: 512 << 10}.String())
+	assert.Equal(t, "downloaded 100.0 B, 10.0 B/s", Progress{Bytes: 100, Total: -1, Rate: 10}.String())
 }
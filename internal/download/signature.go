@@ -0,0 +1,346 @@
+package download
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/blake2b"
+)
+
+// SignaturePolicy defines the action taken when a firmware file signature cannot be verified.
+type SignaturePolicy string
+
+const (
+	// SignaturePolicyDisabled skips signature verification.
+	SignaturePolicyDisabled SignaturePolicy = "disabled"
+	// SignaturePolicyWarn logs a warning when the signature cannot be verified.
+	SignaturePolicyWarn SignaturePolicy = "warn"
+	// SignaturePolicyEnforce fails the install when the signature cannot be verified.
+	SignaturePolicyEnforce SignaturePolicy = "enforce"
+
+	// DefaultSignatureURLSuffix is appended to the firmware URL to fetch its detached signature.
+	DefaultSignatureURLSuffix = ".sig"
+
+	// signature files are not expected to be larger than this
+	maxSignatureSize = 4096
+
+	minisignCommentPrefix        = "untrusted comment:"
+	minisignTrustedCommentPrefix = "trusted comment: "
+	minisignKeyIDLen             = 8
+)
+
+var (
+	ErrSignature        = errors.New("firmware signature verification failed")
+	ErrSignatureMissing = errors.New("firmware signature not found")
+	ErrTrustStore       = errors.New("firmware signature trust store error")
+
+	// maxPureSignedFileSize limits the size of files verified with pure ed25519 signatures, which sign the file contents
+	// and so require the file to be read into memory, larger files are expected to be signed with prehashed minisign signatures.
+	maxPureSignedFileSize int64 = 64 << 20
+
+	// minisign algorithm identifiers, the latter signs the blake2b-512 hash of the file.
+	minisignAlgEd        = []byte("Ed")
+	minisignAlgPrehashed = []byte("ED")
+)
+
+// SignatureVerifier verifies detached ed25519 signatures of firmware files.
+//
+// The signature is fetched from the firmware URL with the signature suffix appended,
+// both minisign signatures and base64 encoded raw ed25519 signatures are supported.
+type SignatureVerifier struct {
+	policy    SignaturePolicy
+	urlSuffix string
+	keys      []trustedKey
+	logger    *logrus.Logger
+}
+
+type trustedKey struct {
+	// the minisign key identifier, this is not set for raw ed25519 keys.
+	id  []byte
+	key ed25519.PublicKey
+}
+
+// NewSignatureVerifier returns a SignatureVerifier with the public keys loaded from the trustStore file.
+//
+// The trust store lists one base64 encoded minisign or raw ed25519 public key per line,
+// empty lines, lines prefixed with # and minisign untrusted comments are ignored.
+func NewSignatureVerifier(policy SignaturePolicy, trustStore, urlSuffix string, logger *logrus.Logger) (*SignatureVerifier, error) {
+	switch policy {
+	case SignaturePolicyDisabled, "":
+		return &SignatureVerifier{policy: SignaturePolicyDisabled, logger: logger}, nil
+	case SignaturePolicyWarn, SignaturePolicyEnforce:
+	default:
+		return nil, errors.Wrap(ErrTrustStore, "unsupported signature policy: "+string(policy))
+	}
+
+	if urlSuffix == "" {
+		urlSuffix = DefaultSignatureURLSuffix
+	}
+
+	keys, err := loadTrustStore(trustStore)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignatureVerifier{
+		policy:    policy,
+		urlSuffix: urlSuffix,
+		keys:      keys,
+		logger:    logger,
+	}, nil
+}
+
+func loadTrustStore(trustStore string) ([]trustedKey, error) {
+	if trustStore == "" {
+		return nil, errors.Wrap(ErrTrustStore, "expected a trust store file")
+	}
+
+	b, err := os.ReadFile(trustStore)
+	if err != nil {
+		return nil, errors.Wrap(ErrTrustStore, err.Error())
+	}
+
+	keys := []trustedKey{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, minisignCommentPrefix) {
+			continue
+		}
+
+		key, err := parsePublicKey(line)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.Wrap(ErrTrustStore, "no public keys found in trust store: "+trustStore)
+	}
+
+	return keys, nil
+}
+
+func parsePublicKey(encoded string) (trustedKey, error) {
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return trustedKey{}, errors.Wrap(ErrTrustStore, "public key decode error: "+err.Error())
+	}
+
+	switch len(b) {
+	case ed25519.PublicKeySize:
+		return trustedKey{key: ed25519.PublicKey(b)}, nil
+	case len(minisignAlgEd) + minisignKeyIDLen + ed25519.PublicKeySize:
+		if !bytes.Equal(b[:2], minisignAlgEd) {
+			return trustedKey{}, errors.Wrap(ErrTrustStore, "unsupported minisign public key algorithm")
+		}
+
+		return trustedKey{id: b[2:10], key: ed25519.PublicKey(b[10:])}, nil
+	default:
+		return trustedKey{}, errors.Wrap(ErrTrustStore, "unexpected public key length")
+	}
+}
+
+// Verify fetches the detached signature for the firmware fileURL and verifies it against the downloaded file.
+//
+// The download options are applied when fetching the signature, progress is not reported.
+// When the signature policy is warn, verification errors are logged and nil is returned.
+func (v *SignatureVerifier) Verify(ctx context.Context, fileURL, file string, options ...Option) error {
+	if v == nil || v.policy == SignaturePolicyDisabled {
+		return nil
+	}
+
+	err := v.verify(ctx, fileURL, file, options...)
+	if err == nil {
+		return nil
+	}
+
+	if v.policy == SignaturePolicyWarn {
+		v.logger.WithFields(
+			logrus.Fields{
+				"url":  fileURL,
+				"file": file,
+				"err":  err.Error(),
+			}).Warn("firmware signature not verified, continuing as signature policy is warn")
+
+		return nil
+	}
+
+	return err
+}
+
+func (v *SignatureVerifier) verify(ctx context.Context, fileURL, file string, options ...Option) error {
+	signatureURL, err := v.signatureURL(fileURL)
+	if err != nil {
+		return errors.Wrap(ErrSignature, err.Error())
+	}
+
+	signature, err := newDownloader(options...).read(ctx, signatureURL, maxSignatureSize)
+	if err != nil {
+		if errors.Is(err, ErrDownload) {
+			return errors.Wrap(ErrSignatureMissing, err.Error())
+		}
+
+		return errors.Wrap(ErrSignature, err.Error())
+	}
+
+	if bytes.HasPrefix(signature, []byte(minisignCommentPrefix)) {
+		return v.verifyMinisign(ctx, signature, file)
+	}
+
+	return v.verifyRaw(signature, file)
+}
+
+// signatureURL returns the signature URL for the fileURL, the suffix is appended to the URL path to retain any query parameters.
+func (v *SignatureVerifier) signatureURL(fileURL string) (string, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return "", err
+	}
+
+	u.Path += v.urlSuffix
+	if u.RawPath != "" {
+		u.RawPath += v.urlSuffix
+	}
+
+	return u.String(), nil
+}
+
+// verifyRaw verifies a base64 encoded ed25519 signature of the file.
+func (v *SignatureVerifier) verifyRaw(signature []byte, file string) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return errors.Wrap(ErrSignature, "invalid signature format")
+	}
+
+	message, err := readPureSignedFile(file)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range v.keys {
+		if ed25519.Verify(k.key, message, sig) {
+			return nil
+		}
+	}
+
+	return errors.Wrap(ErrSignature, "signature not valid for any trusted key")
+}
+
+// verifyMinisign verifies a minisign signature of the file along with its trusted comment.
+//
+// https://jedisct1.github.io/minisign/#signature-format
+func (v *SignatureVerifier) verifyMinisign(ctx context.Context, signature []byte, file string) error {
+	lines := strings.Split(strings.TrimSpace(string(signature)), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], minisignTrustedCommentPrefix) {
+		return errors.Wrap(ErrSignature, "invalid minisign signature format")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != len(minisignAlgEd)+minisignKeyIDLen+ed25519.SignatureSize {
+		return errors.Wrap(ErrSignature, "invalid minisign signature format")
+	}
+
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.Wrap(ErrSignature, "invalid minisign trusted comment signature format")
+	}
+
+	alg, keyID, fileSig := sig[:2], sig[2:10], sig[10:]
+
+	var message []byte
+
+	switch {
+	case bytes.Equal(alg, minisignAlgEd):
+		message, err = readPureSignedFile(file)
+		if err != nil {
+			return err
+		}
+	case bytes.Equal(alg, minisignAlgPrehashed):
+		message, err = blake2bFile(ctx, file)
+		if err != nil {
+			return errors.Wrap(ErrSignature, err.Error())
+		}
+	default:
+		return errors.Wrap(ErrSignature, "unsupported minisign signature algorithm")
+	}
+
+	trustedComment := strings.TrimPrefix(strings.TrimRight(lines[2], "\r"), minisignTrustedCommentPrefix)
+
+	for _, k := range v.keys {
+		if k.id != nil && !bytes.Equal(k.id, keyID) {
+			continue
+		}
+
+		if !ed25519.Verify(k.key, message, fileSig) {
+			continue
+		}
+
+		if !ed25519.Verify(k.key, append(append([]byte{}, fileSig...), trustedComment...), globalSig) {
+			return errors.Wrap(ErrSignature, "minisign trusted comment signature not valid")
+		}
+
+		return nil
+	}
+
+	return errors.Wrap(ErrSignature, "signature not valid for any trusted key")
+}
+
+// readPureSignedFile returns the contents of a file signed with a pure ed25519 signature,
+// an error is returned when the file exceeds maxPureSignedFileSize.
+func readPureSignedFile(file string) ([]byte, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, errors.Wrap(ErrSignature, err.Error())
+	}
+
+	if info.Size() > maxPureSignedFileSize {
+		return nil, errors.Wrap(
+			ErrSignature,
+			fmt.Sprintf(
+				"file size %d bytes exceeds the %d bytes limit for pure ed25519 signatures, expected a prehashed minisign signature",
+				info.Size(),
+				maxPureSignedFileSize,
+			),
+		)
+	}
+
+	message, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(ErrSignature, err.Error())
+	}
+
+	return message, nil
+}
+
+func blake2bFile(ctx context.Context, file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h, err := blake2b.New512(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(h, &contextReader{ctx: ctx, r: f}); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,149 @@
+package download
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisignSignature returns a minisign formatted signature for the message.
+func minisignSignature(t *testing.T, key ed25519.PrivateKey, keyID []byte, prehashed bool, message []byte) string {
+	t.Helper()
+
+	alg := minisignAlgEd
+	if prehashed {
+		alg = minisignAlgPrehashed
+		h := blake2b.Sum512(message)
+		message = h[:]
+	}
+
+	sig := ed25519.Sign(key, message)
+	trustedComment := "timestamp:1700000000\tfile:blob.bin"
+	globalSig := ed25519.Sign(key, append(append([]byte{}, sig...), trustedComment...))
+
+	blob := append(append(append([]byte{}, alg...), keyID...), sig...)
+
+	return fmt.Sprintf(
+		"untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(blob),
+		trustedComment,
+		base64.StdEncoding.EncodeToString(globalSig),
+	)
+}
+
+func TestSignatureVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	_, untrusted, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	message := []byte("BLOB")
+
+	// signatures served by path
+	signatures := map[string]string{
+		"/raw.bin.sig":       base64.StdEncoding.EncodeToString(ed25519.Sign(priv, message)),
+		"/minisign.bin.sig":  minisignSignature(t, priv, keyID, false, message),
+		"/prehashed.bin.sig": minisignSignature(t, priv, keyID, true, message),
+		"/untrusted.bin.sig": base64.StdEncoding.EncodeToString(ed25519.Sign(untrusted, message)),
+		"/garbage.bin.sig":   "foobar",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sig, exists := signatures[r.URL.Path]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte(sig))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "blob.bin")
+	require.Nil(t, os.WriteFile(file, message, 0o600))
+
+	// the trust store lists a raw ed25519 key and the same key in minisign format
+	minisignPub := append(append(append([]byte{}, minisignAlgEd...), keyID...), pub...)
+	trustStore := filepath.Join(dir, "trusted.pub")
+	require.Nil(t, os.WriteFile(trustStore, []byte(fmt.Sprintf(
+		"# trusted firmware signing keys\nuntrusted comment: minisign public key\n%s\n\n%s\n",
+		base64.StdEncoding.EncodeToString(minisignPub),
+		base64.StdEncoding.EncodeToString(pub),
+	)), 0o600))
+
+	enforce, err := NewSignatureVerifier(SignaturePolicyEnforce, trustStore, "", logrus.New())
+	require.Nil(t, err)
+
+	warn, err := NewSignatureVerifier(SignaturePolicyWarn, trustStore, "", logrus.New())
+	require.Nil(t, err)
+
+	tests := []struct {
+		name        string
+		path        string
+		expectedErr error
+	}{
+		{"raw ed25519 signature", "/raw.bin", nil},
+		{"minisign signature", "/minisign.bin", nil},
+		{"minisign prehashed signature", "/prehashed.bin", nil},
+		{"signed by untrusted key", "/untrusted.bin", ErrSignature},
+		{"invalid signature format", "/garbage.bin", ErrSignature},
+		{"unsigned firmware", "/unsigned.bin", ErrSignatureMissing},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := enforce.Verify(context.Background(), server.URL+tc.path, file)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+			} else {
+				assert.Nil(t, err)
+			}
+
+			// verification errors are not returned with the warn policy
+			assert.Nil(t, warn.Verify(context.Background(), server.URL+tc.path, file))
+		})
+	}
+
+	// file contents modified after signing
+	modified := filepath.Join(dir, "modified.bin")
+	require.Nil(t, os.WriteFile(modified, []byte("BLOB2"), 0o600))
+	assert.ErrorIs(t, enforce.Verify(context.Background(), server.URL+"/minisign.bin", modified), ErrSignature)
+
+	// files larger than the limit are verified only with prehashed signatures
+	defaultMax := maxPureSignedFileSize
+	maxPureSignedFileSize = 2
+	assert.ErrorContains(t, enforce.Verify(context.Background(), server.URL+"/raw.bin", file), "expected a prehashed minisign signature")
+	assert.ErrorContains(t, enforce.Verify(context.Background(), server.URL+"/minisign.bin", file), "expected a prehashed minisign signature")
+	assert.Nil(t, enforce.Verify(context.Background(), server.URL+"/prehashed.bin", file))
+	maxPureSignedFileSize = defaultMax
+
+	// disabled, nil verifiers skip verification
+	disabled, err := NewSignatureVerifier(SignaturePolicyDisabled, "", "", logrus.New())
+	require.Nil(t, err)
+	assert.Nil(t, disabled.Verify(context.Background(), server.URL+"/unsigned.bin", file))
+
+	var nilVerifier *SignatureVerifier
+	assert.Nil(t, nilVerifier.Verify(context.Background(), server.URL+"/unsigned.bin", file))
+
+	_, err = NewSignatureVerifier("foo", trustStore, "", logrus.New())
+	assert.ErrorIs(t, err, ErrTrustStore)
+
+	_, err = NewSignatureVerifier(SignaturePolicyEnforce, "", "", logrus.New())
+	assert.ErrorIs(t, err, ErrTrustStore)
+}
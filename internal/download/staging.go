@@ -0,0 +1,164 @@
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// stagingDirPrefix identifies the directories created to stage firmware downloads.
+	stagingDirPrefix = "agent-firmware-"
+
+	// stagingOwnerFile holds the pid of the process the staging directory was last used by.
+	stagingOwnerFile = ".owner"
+)
+
+var (
+	ErrDiskSpace = errors.New("insufficient disk space to download file")
+)
+
+// StagingDir creates a directory in base to stage the firmware download identified by the key,
+// when base is not set the directory is created in the default temp directory.
+//
+// The same directory is returned for a key, so that a partial download left by an interrupted run is resumed.
+func StagingDir(base, key string) (string, error) {
+	if base == "" {
+		base = os.TempDir()
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	dir := filepath.Join(base, stagingDirPrefix+hex.EncodeToString(sum[:8]))
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+
+	// the directory is not purged by other agent processes sharing the base directory while this process is running
+	if err := os.WriteFile(filepath.Join(dir, stagingOwnerFile), []byte(strconv.Itoa(os.Getpid())), 0o600); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// PurgeStagingDirs removes the firmware staging directories in base that were left behind by previous runs,
+// the list of removed directories is returned.
+//
+// The base directory may be shared with other agent processes on the host, directories owned by another running process
+// or modified within maxAge are retained. The maxAge defaults to the download timeout when not set.
+//
+// This is to be invoked before any tasks are run.
+func PurgeStagingDirs(base string, maxAge time.Duration) ([]string, error) {
+	if base == "" {
+		base = os.TempDir()
+	}
+
+	if maxAge <= 0 {
+		maxAge = downloadClientTimeout
+	}
+
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	removed := []string{}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), stagingDirPrefix) {
+			continue
+		}
+
+		dir := filepath.Join(base, entry.Name())
+		if stagingDirInUse(dir, maxAge) {
+			continue
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, err
+		}
+
+		removed = append(removed, dir)
+	}
+
+	return removed, nil
+}
+
+// stagingDirInUse returns true when the staging directory is owned by another running process,
+// or when the directory or its files were modified within maxAge.
+func stagingDirInUse(dir string, maxAge time.Duration) bool {
+	if owner, err := os.ReadFile(filepath.Join(dir, stagingOwnerFile)); err == nil {
+		pid, errAtoi := strconv.Atoi(strings.TrimSpace(string(owner)))
+		// a previous run of this process may have had the same pid, as is the case when running as pid 1 in a container
+		if errAtoi == nil && pid > 0 && pid != os.Getpid() && processRunning(pid) {
+			return true
+		}
+	}
+
+	paths := []string{dir}
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, entry := range entries {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) < maxAge {
+			return true
+		}
+	}
+
+	return false
+}
+
+// processRunning returns true when a process with the pid is running.
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// freeSpace returns the bytes available to unprivileged users on the filesystem of the given path.
+func freeSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+
+	// nolint:gosec,unconvert // block size is positive, its type varies by platform
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// checkDiskSpace returns ErrDiskSpace when the filesystem of the file does not have the required bytes available,
+// the check is skipped when the required bytes are not known.
+func checkDiskSpace(file string, required int64) error {
+	if required <= 0 {
+		return nil
+	}
+
+	available, err := freeSpace(filepath.Dir(file))
+	if err != nil {
+		return errors.Wrap(ErrDownload, "disk space check error: "+err.Error())
+	}
+
+	if uint64(required) > available {
+		return errors.Wrap(
+			ErrDiskSpace,
+			fmt.Sprintf("%s required, %s available in %s", formatBytes(float64(required)), formatBytes(float64(available)), filepath.Dir(file)),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeStagingDirs(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "staging")
+
+	// the base directory is created when not present
+	dir1, err := StagingDir(base, "action1"+testBlobSHA256)
+	require.Nil(t, err)
+
+	dir2, err := StagingDir(base, "action2"+testBlobSHA256)
+	require.Nil(t, err)
+	assert.NotEqual(t, dir1, dir2)
+
+	// the directory is the same for the key
+	dir, err := StagingDir(base, "action1"+testBlobSHA256)
+	require.Nil(t, err)
+	assert.Equal(t, dir1, dir)
+
+	dir3, err := StagingDir(base, "action3"+testBlobSHA256)
+	require.Nil(t, err)
+
+	require.Nil(t, os.WriteFile(filepath.Join(dir1, "bios.bin"), []byte("BLOB"), 0o600))
+
+	// dir3 is owned by another running process
+	require.Nil(t, os.WriteFile(filepath.Join(dir3, stagingOwnerFile), []byte(strconv.Itoa(os.Getppid())), 0o600))
+
+	// dir1, dir3 were last modified before the max age, dir2 is recent
+	stale := time.Now().Add(-time.Hour)
+	for _, path := range []string{
+		dir1,
+		filepath.Join(dir1, "bios.bin"),
+		filepath.Join(dir1, stagingOwnerFile),
+		dir3,
+		filepath.Join(dir3, stagingOwnerFile),
+	} {
+		require.Nil(t, os.Chtimes(path, stale, stale))
+	}
+
+	// directories not created by the agent are retained
+	other := filepath.Join(base, "other")
+	require.Nil(t, os.Mkdir(other, 0o750))
+
+	removed, err := PurgeStagingDirs(base, time.Minute)
+	require.Nil(t, err)
+	assert.Equal(t, []string{dir1}, removed)
+
+	for _, retained := range []string{dir2, dir3, other} {
+		_, err = os.Stat(retained)
+		assert.Nil(t, err)
+	}
+
+	// base directory not present
+	removed, err = PurgeStagingDirs(filepath.Join(base, "foo"), 0)
+	assert.Nil(t, err)
+	assert.Empty(t, removed)
+}
+
+func TestFromURLToFileDiskSpace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// advertise a file larger than any test filesystem
+		w.Header().Set("Content-Length", strconv.FormatInt(1<<60, 10))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dst := filepath.Join(t.TempDir(), "blob.bin")
+
+	err := FromURLToFile(context.Background(), server.URL+"/blob", dst)
+	assert.ErrorIs(t, err, ErrDiskSpace)
+
+	// nothing was written to the file
+	info, err := os.Stat(dst)
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+
+	// unknown sizes are not checked
+	assert.Nil(t, checkDiskSpace(dst, -1))
+}
@@ -23,6 +23,7 @@ var (
 	ErrSaveTask           = errors.New("error in saveTask transition handler")
 	ErrTaskTypeAssertion  = errors.New("error asserting Task type")
 	errTaskQueryInventory = errors.New("error in task query inventory for installed firmware")
+	errRollback           = errors.New("firmware rollback not supported for firmware installed from a file")
 )
 
 // handler implements the Runner.Handler interface
@@ -102,6 +103,11 @@ func (t *handler) PlanActions(ctx context.Context) error {
 	return nil
 }
 
+// ComposeRollback returns an error, the previous firmware is not available to reinstall for firmware installed from a file.
+func (t *handler) ComposeRollback(_ context.Context, _ *model.Action) (*model.Action, error) {
+	return nil, errRollback
+}
+
 func (t *handler) Publish(context.Context) {}
 
 // query device components inventory from the device itself.
@@ -170,3 +176,13 @@ func (t *handler) OnFailure(ctx context.Context, _ *model.FirmwareTask) {
 		t.taskCtx.Logger.WithFields(logrus.Fields{"err": err.Error()}).Warn("device logout error")
 	}
 }
+
+func (t *handler) OnPause(ctx context.Context, _ *model.FirmwareTask) {
+	if t.taskCtx.DeviceQueryor == nil {
+		return
+	}
+
+	if err := t.taskCtx.DeviceQueryor.(device.OutofbandQueryor).Close(ctx); err != nil {
+		t.taskCtx.Logger.WithFields(logrus.Fields{"err": err.Error()}).Warn("device logout error")
+	}
+}
@@ -0,0 +1,332 @@
+package fwversion
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Scheme identifies a firmware version format.
+type Scheme string
+
+const (
+	// SchemeSemver versions are semantic versions - 1.2.3, v1.2.3-rc1, pre-releases order before their release.
+	SchemeSemver Scheme = "semver"
+
+	// SchemeDotted versions are dot separated numbers - 1.10.2, 01.10.02, missing trailing segments are treated as 0.
+	SchemeDotted Scheme = "dotted"
+
+	// SchemeDell versions are dot separated numbers with an optional letter suffix - 3.5a,
+	// or a letter prefixed revision - A07, a suffixed version orders after the version without the suffix.
+	SchemeDell Scheme = "dell"
+
+	// SchemeSupermicroDate versions are release dates - 20220208, 2022-02-08, 02/08/2022.
+	SchemeSupermicroDate Scheme = "supermicro-date"
+
+	// SchemeString versions are compared for equality only, the order is unknown.
+	SchemeString Scheme = "string"
+)
+
+var (
+	ErrCompare = errors.New("firmware version compare error")
+
+	// ErrOrderUnknown is returned when the versions are not equal and cannot be ordered.
+	ErrOrderUnknown = errors.New("firmware version order unknown")
+
+	reSemver = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+	reDotted = regexp.MustCompile(`^v?\d+(\.\d+)*$`)
+	reDell   = regexp.MustCompile(`^(\d+(?:\.\d+)*)([A-Za-z]{1,2})?$`)
+	// Dell revision versions - A00, A07
+	reDellRevision = regexp.MustCompile(`^([A-Za-z])(\d+)$`)
+)
+
+// vendorSchemes lists the version schemes tried in order, keyed by vendor or vendor/component,
+// versions are compared with the first scheme able to parse both versions.
+var vendorSchemes = map[string][]Scheme{
+	"dell":            {SchemeDell},
+	"supermicro":      {SchemeDotted, SchemeSupermicroDate},
+	"supermicro/bios": {SchemeDell, SchemeSupermicroDate},
+}
+
+// defaultSchemes are tried when no schemes are listed for the vendor component.
+var defaultSchemes = []Scheme{SchemeSemver, SchemeDotted, SchemeDell}
+
+// version is a parsed firmware version.
+type version struct {
+	segments []int64
+	// suffix is the Dell letter suffix
+	suffix string
+	// pre is the semver pre-release
+	pre string
+	// revision is set for Dell letter prefixed revisions, which are not ordered against dotted versions
+	revision bool
+}
+
+// Result is the outcome of a version comparison.
+type Result struct {
+	// Order is -1 when the installed version is older than the requested version,
+	// 0 when they are equal and 1 when the installed version is newer.
+	Order int
+	// Scheme is the version scheme the versions were compared with.
+	Scheme Scheme
+}
+
+// Schemes returns the version schemes tried for the vendor component.
+func Schemes(vendor, component string) []Scheme {
+	vendor = strings.ToLower(strings.TrimSpace(vendor))
+	component = strings.ToLower(strings.TrimSpace(component))
+
+	if schemes, exists := vendorSchemes[vendor+"/"+component]; exists {
+		return schemes
+	}
+
+	if schemes, exists := vendorSchemes[vendor]; exists {
+		return schemes
+	}
+
+	return defaultSchemes
+}
+
+// Compare compares the installed and requested firmware versions of the vendor component.
+//
+// When neither version scheme is able to parse both versions, the versions are compared for equality
+// and ErrOrderUnknown is returned when they differ.
+func Compare(vendor, component, installed, requested string) (Result, error) {
+	installed = strings.TrimSpace(installed)
+	requested = strings.TrimSpace(requested)
+
+	if installed == "" || requested == "" {
+		return Result{}, errors.Wrap(ErrCompare, "expected installed and requested versions")
+	}
+
+	for _, scheme := range Schemes(vendor, component) {
+		iv, err := parse(scheme, installed)
+		if err != nil {
+			continue
+		}
+
+		rv, err := parse(scheme, requested)
+		if err != nil || iv.revision != rv.revision {
+			continue
+		}
+
+		return Result{Order: compare(scheme, iv, rv), Scheme: scheme}, nil
+	}
+
+	if strings.EqualFold(installed, requested) {
+		return Result{Order: 0, Scheme: SchemeString}, nil
+	}
+
+	return Result{Scheme: SchemeString}, errors.Wrapf(ErrOrderUnknown, "installed: %s, requested: %s", installed, requested)
+}
+
+// Equal returns true when the installed and requested firmware versions of the vendor component are equal.
+func Equal(vendor, component, installed, requested string) bool {
+	result, err := Compare(vendor, component, installed, requested)
+	if err != nil {
+		return false
+	}
+
+	return result.Order == 0
+}
+
+func parse(scheme Scheme, v string) (*version, error) {
+	switch scheme {
+	case SchemeSemver:
+		return parseSemver(v)
+	case SchemeDotted:
+		return parseDotted(v)
+	case SchemeDell:
+		return parseDell(v)
+	case SchemeSupermicroDate:
+		return parseDate(v)
+	default:
+		return nil, errors.Wrap(ErrCompare, "unsupported version scheme: "+string(scheme))
+	}
+}
+
+func parseSemver(v string) (*version, error) {
+	m := reSemver.FindStringSubmatch(v)
+	if m == nil {
+		return nil, errors.Wrap(ErrCompare, "not a semantic version: "+v)
+	}
+
+	segments, err := parseSegments(strings.Join(m[1:4], "."))
+	if err != nil {
+		return nil, err
+	}
+
+	return &version{segments: segments, pre: m[4]}, nil
+}
+
+func parseDotted(v string) (*version, error) {
+	if !reDotted.MatchString(v) {
+		return nil, errors.Wrap(ErrCompare, "not a dotted numeric version: "+v)
+	}
+
+	segments, err := parseSegments(strings.TrimPrefix(v, "v"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &version{segments: segments}, nil
+}
+
+func parseDell(v string) (*version, error) {
+	if m := reDellRevision.FindStringSubmatch(v); m != nil {
+		segments, err := parseSegments(m[2])
+		if err != nil {
+			return nil, err
+		}
+
+		return &version{segments: segments, suffix: strings.ToLower(m[1]), revision: true}, nil
+	}
+
+	m := reDell.FindStringSubmatch(v)
+	if m == nil {
+		return nil, errors.Wrap(ErrCompare, "not a Dell version: "+v)
+	}
+
+	segments, err := parseSegments(m[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &version{segments: segments, suffix: strings.ToLower(m[2])}, nil
+}
+
+func parseDate(v string) (*version, error) {
+	for _, layout := range []string{"20060102", "2006-01-02", "01/02/2006", "2006/01/02"} {
+		ts, err := time.Parse(layout, v)
+		if err != nil {
+			continue
+		}
+
+		return &version{segments: []int64{int64(ts.Year()), int64(ts.Month()), int64(ts.Day())}}, nil
+	}
+
+	return nil, errors.Wrap(ErrCompare, "not a release date version: "+v)
+}
+
+func parseSegments(v string) ([]int64, error) {
+	parts := strings.Split(v, ".")
+	segments := make([]int64, 0, len(parts))
+
+	for _, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(ErrCompare, "invalid version segment: "+part)
+		}
+
+		segments = append(segments, n)
+	}
+
+	return segments, nil
+}
+
+// compare returns -1 when a orders before b, 1 when it orders after b and 0 when they are equal.
+func compare(scheme Scheme, a, b *version) int {
+	// revisions are ordered by their letter prefix first - A09 orders before B01
+	if a.revision {
+		if order := compareSuffix(a.suffix, b.suffix); order != 0 {
+			return order
+		}
+	}
+
+	if order := compareSegments(a.segments, b.segments); order != 0 {
+		return order
+	}
+
+	switch scheme {
+	case SchemeDell:
+		// a version without a suffix orders before its suffixed revisions
+		return compareSuffix(a.suffix, b.suffix)
+	case SchemeSemver:
+		return comparePreRelease(a.pre, b.pre)
+	default:
+		return 0
+	}
+}
+
+func compareSegments(a, b []int64) int {
+	for idx := 0; idx < len(a) || idx < len(b); idx++ {
+		var av, bv int64
+		if idx < len(a) {
+			av = a[idx]
+		}
+
+		if idx < len(b) {
+			bv = b[idx]
+		}
+
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func compareSuffix(a, b string) int {
+	if len(a) != len(b) {
+		return compareInt(len(a), len(b))
+	}
+
+	return strings.Compare(a, b)
+}
+
+// comparePreRelease orders semver pre-releases, a release orders after its pre-releases.
+func comparePreRelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	aIDs := strings.Split(a, ".")
+	bIDs := strings.Split(b, ".")
+
+	for idx := 0; idx < len(aIDs) && idx < len(bIDs); idx++ {
+		an, aErr := strconv.ParseInt(aIDs[idx], 10, 64)
+		bn, bErr := strconv.ParseInt(bIDs[idx], 10, 64)
+
+		var order int
+		switch {
+		case aErr == nil && bErr == nil:
+			order = compareInt(int(an), int(bn))
+		case aErr == nil:
+			// numeric identifiers order before alphanumeric identifiers
+			order = -1
+		case bErr == nil:
+			order = 1
+		default:
+			order = strings.Compare(aIDs[idx], bIDs[idx])
+		}
+
+		if order != 0 {
+			return order
+		}
+	}
+
+	return compareInt(len(aIDs), len(bIDs))
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,122 @@
+package fwversion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name           string
+		vendor         string
+		component      string
+		installed      string
+		requested      string
+		expectedOrder  int
+		expectedScheme Scheme
+		expectedErr    error
+	}{
+		{
+			name:           "dotted with leading zeros equal",
+			vendor:         "supermicro",
+			component:      "bmc",
+			installed:      "1.10.2",
+			requested:      "01.10.02",
+			expectedOrder:  0,
+			expectedScheme: SchemeDotted,
+		},
+		{
+			name:           "dotted numeric segments",
+			vendor:         "supermicro",
+			component:      "bmc",
+			installed:      "1.9.0",
+			requested:      "1.10",
+			expectedOrder:  -1,
+			expectedScheme: SchemeDotted,
+		},
+		{
+			name:           "letter suffixed upgrade",
+			vendor:         "supermicro",
+			component:      "bios",
+			installed:      "3.5a",
+			requested:      "3.6",
+			expectedOrder:  -1,
+			expectedScheme: SchemeDell,
+		},
+		{
+			name:           "letter suffixed revision orders after its release",
+			vendor:         "dell",
+			component:      "nic",
+			installed:      "3.5a",
+			requested:      "3.5",
+			expectedOrder:  1,
+			expectedScheme: SchemeDell,
+		},
+		{
+			name:           "Dell revisions",
+			vendor:         "Dell",
+			component:      "drive",
+			installed:      "A09",
+			requested:      "B01",
+			expectedOrder:  -1,
+			expectedScheme: SchemeDell,
+		},
+		{
+			name:           "release dates",
+			vendor:         "supermicro",
+			component:      "cpld",
+			installed:      "02/08/2022",
+			requested:      "2021-11-30",
+			expectedOrder:  1,
+			expectedScheme: SchemeSupermicroDate,
+		},
+		{
+			name:           "semver pre-release",
+			vendor:         "mellanox",
+			component:      "nic",
+			installed:      "v2.1.0-rc.2",
+			requested:      "2.1.0",
+			expectedOrder:  -1,
+			expectedScheme: SchemeSemver,
+		},
+		{
+			name:           "string equal",
+			vendor:         "intel",
+			component:      "nic",
+			installed:      "0x8000D2D1",
+			requested:      "0x8000d2d1",
+			expectedOrder:  0,
+			expectedScheme: SchemeString,
+		},
+		{
+			name:        "order unknown",
+			vendor:      "dell",
+			component:   "drive",
+			installed:   "A07",
+			requested:   "2.1",
+			expectedErr: ErrOrderUnknown,
+		},
+		{
+			name:        "empty version",
+			vendor:      "dell",
+			installed:   "",
+			requested:   "2.1",
+			expectedErr: ErrCompare,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Compare(tt.vendor, tt.component, tt.installed, tt.requested)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedOrder, got.Order)
+			assert.Equal(t, tt.expectedScheme, got.Scheme)
+		})
+	}
+}
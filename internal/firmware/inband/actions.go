@@ -7,6 +7,7 @@ import (
 
 	"github.com/metal-automata/agent/internal/device"
 	"github.com/metal-automata/agent/internal/device/inband"
+	"github.com/metal-automata/agent/internal/download"
 	"github.com/metal-automata/agent/internal/firmware/runner"
 	"github.com/metal-automata/agent/internal/model"
 	rctypes "github.com/metal-automata/rivets/condition"
@@ -27,6 +28,7 @@ const (
 	powerCycleServer       model.StepName = "powerCycleServer"
 	checkInstalledFirmware model.StepName = "checkInstalledFirmware"
 	downloadFirmware       model.StepName = "downloadFirmware"
+	extractFirmware        model.StepName = "extractFirmware"
 	installFirmware        model.StepName = "installFirmware"
 	pollInstallStatus      model.StepName = "pollInstallStatus"
 )
@@ -158,6 +160,16 @@ func (i *ActionHandler) composeSteps(required *imodel.UpdateRequirements) (model
 		return nil, err
 	}
 
+	// skip payload extraction when the firmware file is not an archive
+	payload, err := download.ParsePayload(i.handler.action.Firmware.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload == nil {
+		preinstall = preinstall.Remove(extractFirmware)
+	}
+
 	final = append(final, preinstall...)
 
 	// install steps
@@ -237,6 +249,13 @@ func (i *ActionHandler) definitions() model.Steps {
 			Description: "Download and verify firmware file checksum.",
 			State:       model.StatePending,
 		},
+		{
+			Name:        extractFirmware,
+			Group:       PreInstall,
+			Handler:     i.handler.extractFirmware,
+			Description: "Extract firmware payload from the vendor archive and verify its checksum.",
+			State:       model.StatePending,
+		},
 		{
 			Name:        installFirmware,
 			Group:       Install,
@@ -6,9 +6,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/metal-automata/agent/internal/device"
 	"github.com/metal-automata/agent/internal/download"
+	"github.com/metal-automata/agent/internal/firmware/fwversion"
 	"github.com/metal-automata/agent/internal/firmware/runner"
 	"github.com/metal-automata/agent/internal/metrics"
 	"github.com/metal-automata/agent/internal/model"
@@ -20,9 +22,8 @@ import (
 )
 
 const (
-	// firmware files are downloaded into this directory
-	downloadDir = "/tmp"
-	rebootFlag  = "/var/run/reboot"
+	// interval at which the firmware download progress is published
+	downloadProgressInterval = 30 * time.Second
 )
 
 var (
@@ -93,7 +94,7 @@ func (h *handler) installedEqualsExpected(ctx context.Context, component, expect
 		return ErrInstalledVersionUnknown
 	}
 
-	if !strings.EqualFold(expectedFirmware, installedVersion) {
+	if !fwversion.Equal(vendor, component, installedVersion, expectedFirmware) {
 		return errors.Wrap(
 			ErrInstalledFirmwareNotEqual,
 			fmt.Sprintf("expected: %s, current: %s", expectedFirmware, installedVersion),
@@ -134,6 +135,25 @@ func (h *handler) checkCurrentFirmware(ctx context.Context) error {
 	return ErrInstalledFirmwareEqual
 }
 
+// downloadOptions returns the firmware download parameters, the download progress is published in the task status.
+func (h *handler) downloadOptions(ctx context.Context) []download.Option {
+	task := h.actionCtx.Task
+	statusPrefix := task.Status.Last()
+
+	return []download.Option{
+		download.WithTimeout(h.actionCtx.DownloadTimeout),
+		download.WithBucketCredentials(h.actionCtx.BucketCredentials),
+		download.WithProgress(downloadProgressInterval, func(p download.Progress) {
+			task.WithLock(func() {
+				task.Status.Update(task.Status.Last(), statusPrefix+" -- "+p.String())
+			})
+
+			//nolint:errcheck // method called logs errors if any
+			_ = h.actionCtx.Publisher.Publish(ctx, task)
+		}),
+	}
+}
+
 func (h *handler) downloadFirmware(ctx context.Context) error {
 	if h.action.FirmwareTempFile != "" {
 		h.logger.WithFields(
@@ -145,17 +165,21 @@ func (h *handler) downloadFirmware(ctx context.Context) error {
 		return nil
 	}
 
-	// create a temp download directory
-	dir, err := os.MkdirTemp(downloadDir, "")
+	// the download directory is the same for the action firmware, a partial download left by an interrupted run is resumed
+	dir, err := download.StagingDir(h.actionCtx.DownloadDir, h.action.ID+h.actionCtx.Firmware.Checksum)
 	if err != nil {
 		return errors.Wrap(err, "error creating tmp directory to download firmware")
 	}
 
 	file := filepath.Join(dir, h.actionCtx.Firmware.FileName)
 
-	// download firmware file
-	err = download.FromURLToFile(ctx, h.actionCtx.Firmware.URL, file)
+	// download firmware file, the partial download is retained when the run is interrupted
+	err = download.FromURLToFile(ctx, h.actionCtx.Firmware.URL, file, h.downloadOptions(ctx)...)
 	if err != nil {
+		if ctx.Err() == nil {
+			os.RemoveAll(dir)
+		}
+
 		return err
 	}
 
@@ -171,7 +195,13 @@ func (h *handler) downloadFirmware(ctx context.Context) error {
 	}
 
 	// validate checksum
-	if err := download.ChecksumValidate(file, h.actionCtx.Firmware.Checksum); err != nil {
+	if err := download.ChecksumValidate(ctx, file, h.actionCtx.Firmware.Checksum); err != nil {
+		os.RemoveAll(filepath.Dir(file))
+		return err
+	}
+
+	// verify signature
+	if err := h.actionCtx.SignatureVerifier.Verify(ctx, h.actionCtx.Firmware.URL, file, h.downloadOptions(ctx)...); err != nil {
 		os.RemoveAll(filepath.Dir(file))
 		return err
 	}
@@ -191,6 +221,60 @@ func (h *handler) downloadFirmware(ctx context.Context) error {
 	return nil
 }
 
+// extractFirmware extracts the firmware payload declared in the firmware URL from the downloaded archive,
+// the archive is purged once the payload has been extracted and its checksum validated.
+func (h *handler) extractFirmware(ctx context.Context) error {
+	payload, err := download.ParsePayload(h.actionCtx.Firmware.URL)
+	if err != nil {
+		return err
+	}
+
+	if payload == nil {
+		return nil
+	}
+
+	if h.action.FirmwareTempFile == "" {
+		return errors.New("expected FirmwareTempFile to be declared")
+	}
+
+	archive := h.action.FirmwareTempFile
+
+	isArchive, err := download.IsArchive(archive)
+	if err != nil {
+		return err
+	}
+
+	// the payload was extracted by a previous run of this step
+	if !isArchive {
+		return download.ChecksumValidate(ctx, archive, payload.Checksum)
+	}
+
+	dir, err := download.StagingDir(h.actionCtx.DownloadDir, h.action.ID+payload.Checksum)
+	if err != nil {
+		return errors.Wrap(err, "error creating tmp directory to extract firmware")
+	}
+
+	file, err := download.ExtractPayload(ctx, archive, dir, payload)
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	os.RemoveAll(filepath.Dir(archive))
+
+	h.action.FirmwareTempFile = file
+
+	h.logger.WithFields(
+		logrus.Fields{
+			"component": h.actionCtx.Firmware.Component,
+			"archive":   archive,
+			"file":      file,
+			"checksum":  payload.Checksum,
+		}).Info("extracted firmware payload and verified checksum")
+
+	return nil
+}
+
 func (h *handler) installFirmware(ctx context.Context) error {
 	if !h.actionCtx.Task.Parameters.DryRun {
 		// initiate firmware install
@@ -266,17 +350,10 @@ func (h *handler) powerCycleServer(ctx context.Context) error {
 			"version":   h.actionCtx.Firmware.Version,
 		}).Info("power cycling server")
 
-	f, err := os.OpenFile(rebootFlag, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	h.logger.Infof("%s reboot flag created, waiting for host power cycle..", rebootFlag)
-
+	// the host reboot is handed off to the reboot coordinator once the task runner returns,
 	// we must be able to publish a status at this point
 	h.action.HostPowerCycleInitiated = true
-	h.actionCtx.Task.Status.Append("server powercycle flag set, waiting for powercycle")
+	h.actionCtx.Task.Status.Append("server powercycle required, waiting for powercycle")
 	if errPub := h.actionCtx.Publisher.Publish(ctx, h.actionCtx.Task); errPub != nil {
 		h.logger.WithError(errPub).Info("publish failure")
 		return errPub
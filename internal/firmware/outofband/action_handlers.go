@@ -13,6 +13,7 @@ import (
 	"github.com/metal-automata/agent/internal/device"
 	"github.com/metal-automata/agent/internal/device/outofband"
 	"github.com/metal-automata/agent/internal/download"
+	"github.com/metal-automata/agent/internal/firmware/fwversion"
 	"github.com/metal-automata/agent/internal/firmware/runner"
 	"github.com/metal-automata/agent/internal/metrics"
 	"github.com/metal-automata/agent/internal/model"
@@ -38,6 +39,9 @@ const (
 	// delay between polling the firmware install status
 	delayPollStatus = 10 * time.Second
 
+	// interval at which the firmware download progress is published
+	downloadProgressInterval = 30 * time.Second
+
 	// maxPollStatusAttempts is set based on how long the loop below should keep polling
 	// for a finalized state before giving up
 	//
@@ -56,9 +60,6 @@ const (
 
 	// this value indicates the device was powered on by agent
 	devicePoweredOn = "devicePoweredOn"
-
-	// firmware files are downloaded into this directory
-	downloadDir = "/tmp"
 )
 
 var (
@@ -89,6 +90,16 @@ type handler struct {
 	deviceQueryor device.OutofbandQueryor
 	publisher     runner.Publisher
 	logger        *logrus.Entry
+	// cache is the local firmware file cache, this is nil when the cache is not enabled.
+	cache *download.Cache
+	// verifier verifies the firmware file signature, this is nil when verification is not configured.
+	verifier *download.SignatureVerifier
+	// downloadTimeout is the timeout for each firmware download attempt.
+	downloadTimeout time.Duration
+	// downloadDir is the directory firmware files are staged in before install.
+	downloadDir string
+	// bucketCreds are the credentials to download firmware from object storage URLs.
+	bucketCreds *download.BucketCredentials
 }
 
 func (h *handler) serverPoweredOff(ctx context.Context) (bool, error) {
@@ -116,13 +127,29 @@ func (h *handler) serverPoweredOff(ctx context.Context) (bool, error) {
 
 // initialize initializes the bmc connection and powers on server if required.
 func (h *handler) powerOnServer(ctx context.Context) error {
+	// the power state is checked and changed holding the task power lock,
+	// so actions running concurrently see the power state changed by the other actions.
+	var err error
+	h.task.WithPowerLock(func() {
+		err = h.powerOnServerLocked(ctx)
+	})
+
+	return err
+}
+
+func (h *handler) powerOnServerLocked(ctx context.Context) error {
 	serverIsPoweredOff, err := h.serverPoweredOff(ctx)
 	if err != nil {
 		return err
 	}
 
+	var poweredOnByAgent bool
+	h.task.WithLock(func() {
+		poweredOnByAgent = h.task.Data.Scratch[devicePoweredOn] == "true"
+	})
+
 	// server is currently powered on and it wasn't powered on by agent
-	if !serverIsPoweredOff && h.task.Data.Scratch[devicePoweredOn] != "true" {
+	if !serverIsPoweredOff && !poweredOnByAgent {
 		if h.task.Parameters.RequireHostPoweredOff {
 			return ErrRequireHostPoweredOff
 		}
@@ -146,7 +173,9 @@ func (h *handler) powerOnServer(ctx context.Context) error {
 		}
 	}
 
-	h.task.Data.Scratch[devicePoweredOn] = "true"
+	h.task.WithLock(func() {
+		h.task.Data.Scratch[devicePoweredOn] = "true"
+	})
 
 	return nil
 }
@@ -208,7 +237,7 @@ func (h *handler) installedEqualsExpected(ctx context.Context, component, expect
 		return ErrInstalledVersionUnknown
 	}
 
-	if !strings.EqualFold(expectedFirmware, installedVersion) {
+	if !fwversion.Equal(vendor, component, installedVersion, expectedFirmware) {
 		return errors.Wrap(
 			ErrInstalledFirmwareNotEqual,
 			fmt.Sprintf("expected: %s, current: %s", expectedFirmware, installedVersion),
@@ -259,6 +288,51 @@ func (h *handler) checkCurrentFirmware(ctx context.Context) error {
 	return model.ErrInstalledFirmwareEqual
 }
 
+// downloadOptions returns the firmware download parameters, the download progress is published in the task status.
+func (h *handler) downloadOptions(ctx context.Context) []download.Option {
+	return []download.Option{
+		download.WithTimeout(h.downloadTimeout),
+		download.WithBucketCredentials(h.bucketCreds),
+		download.WithProgress(downloadProgressInterval, func(p download.Progress) {
+			h.publishStepProgress(ctx, p.String())
+		}),
+	}
+}
+
+// publishStepProgress updates the task status message published for the running step with the step progress.
+//
+// The message is looked up by the action step status since the actions of a task may run concurrently.
+func (h *handler) publishStepProgress(ctx context.Context, progress string) {
+	if h.publisher == nil {
+		return
+	}
+
+	h.task.WithLock(func() {
+		// the step status published by the runner is suffixed with the latest progress
+		status, _, _ := strings.Cut(h.action.StepStatus, " -- ")
+		status += " -- " + progress
+
+		h.task.Status.Update(h.action.StepStatus, status)
+		h.action.StepStatus = status
+	})
+
+	//nolint:errcheck // method called logs errors if any
+	_ = h.publisher.Publish(ctx, h.task)
+}
+
+func (h *handler) setFirmwareTempFile(file string) {
+	h.task.WithLock(func() {
+		h.action.FirmwareTempFile = file
+	})
+}
+
+func (h *handler) setBMCTask(step bconsts.FirmwareInstallStep, taskID string) {
+	h.task.WithLock(func() {
+		h.action.FirmwareInstallStep = string(step)
+		h.action.BMCTaskID = taskID
+	})
+}
+
 func (h *handler) downloadFirmware(ctx context.Context) error {
 	if h.action.FirmwareTempFile != "" {
 		h.logger.WithFields(
@@ -270,17 +344,46 @@ func (h *handler) downloadFirmware(ctx context.Context) error {
 		return nil
 	}
 
-	// create a temp download directory
-	dir, err := os.MkdirTemp(downloadDir, "")
+	// fetch firmware file through the cache when its enabled
+	if h.cache != nil && h.firmware.Checksum != "" {
+		file, err := h.cache.Fetch(ctx, h.firmware.URL, h.firmware.Checksum, h.firmware.FileName, h.downloadOptions(ctx)...)
+		if err != nil {
+			return err
+		}
+
+		if err := h.verifier.Verify(ctx, h.firmware.URL, file, h.downloadOptions(ctx)...); err != nil {
+			h.cache.Release(file)
+			return err
+		}
+
+		h.setFirmwareTempFile(file)
+
+		h.logger.WithFields(
+			logrus.Fields{
+				"component": h.firmware.Component,
+				"version":   h.firmware.Version,
+				"url":       h.firmware.URL,
+				"file":      file,
+			}).Info("firmware file fetched from cache")
+
+		return nil
+	}
+
+	// the download directory is the same for the action firmware, a partial download left by an interrupted run is resumed
+	dir, err := download.StagingDir(h.downloadDir, h.action.ID+h.firmware.Checksum)
 	if err != nil {
 		return errors.Wrap(err, "error creating tmp directory to download firmware")
 	}
 
 	file := filepath.Join(dir, h.firmware.FileName)
 
-	// download firmware file
-	err = download.FromURLToFile(ctx, h.firmware.URL, file)
+	// download firmware file, the partial download is retained when the run is interrupted
+	err = download.FromURLToFile(ctx, h.firmware.URL, file, h.downloadOptions(ctx)...)
 	if err != nil {
+		if ctx.Err() == nil {
+			os.RemoveAll(dir)
+		}
+
 		return err
 	}
 
@@ -296,13 +399,19 @@ func (h *handler) downloadFirmware(ctx context.Context) error {
 	}
 
 	// validate checksum
-	if err := download.ChecksumValidate(file, h.firmware.Checksum); err != nil {
+	if err := download.ChecksumValidate(ctx, file, h.firmware.Checksum); err != nil {
+		os.RemoveAll(filepath.Dir(file))
+		return err
+	}
+
+	// verify signature
+	if err := h.verifier.Verify(ctx, h.firmware.URL, file, h.downloadOptions(ctx)...); err != nil {
 		os.RemoveAll(filepath.Dir(file))
 		return err
 	}
 
 	// store the firmware temp file location
-	h.action.FirmwareTempFile = file
+	h.setFirmwareTempFile(file)
 
 	h.logger.WithFields(
 		logrus.Fields{
@@ -316,6 +425,77 @@ func (h *handler) downloadFirmware(ctx context.Context) error {
 	return nil
 }
 
+// extractFirmware extracts the firmware payload declared in the firmware URL from the downloaded archive,
+// the archive is purged once the payload has been extracted and its checksum validated.
+func (h *handler) extractFirmware(ctx context.Context) error {
+	payload, err := download.ParsePayload(h.firmware.URL)
+	if err != nil {
+		return err
+	}
+
+	if payload == nil {
+		return nil
+	}
+
+	if h.action.FirmwareTempFile == "" {
+		return errors.Wrap(ErrFirmwareTempFile, "expected FirmwareTempFile to be declared")
+	}
+
+	archive := h.action.FirmwareTempFile
+
+	isArchive, err := download.IsArchive(archive)
+	if err != nil {
+		return errors.Wrap(ErrFirmwareTempFile, err.Error())
+	}
+
+	// the payload was extracted by a previous run of this step
+	if !isArchive {
+		if err := download.ChecksumValidate(ctx, archive, payload.Checksum); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	dir, err := download.StagingDir(h.downloadDir, h.action.ID+payload.Checksum)
+	if err != nil {
+		return errors.Wrap(err, "error creating tmp directory to extract firmware")
+	}
+
+	file, err := download.ExtractPayload(ctx, archive, dir, payload)
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	h.removeFirmwareTempFile()
+	if h.cache.Contains(archive) {
+		h.cache.Release(archive)
+	}
+
+	h.setFirmwareTempFile(file)
+
+	h.logger.WithFields(
+		logrus.Fields{
+			"component": h.firmware.Component,
+			"archive":   archive,
+			"file":      file,
+			"checksum":  payload.Checksum,
+		}).Info("extracted firmware payload and verified checksum")
+
+	return nil
+}
+
+// removeFirmwareTempFile purges the downloaded firmware file,
+// files held in the firmware cache are retained for subsequent installs.
+func (h *handler) removeFirmwareTempFile() {
+	if h.cache.Contains(h.action.FirmwareTempFile) {
+		return
+	}
+
+	os.RemoveAll(filepath.Dir(h.action.FirmwareTempFile))
+}
+
 func (h *handler) uploadFirmware(ctx context.Context) error {
 	// open firmware file handle
 	fileHandle, err := os.Open(h.action.FirmwareTempFile)
@@ -324,7 +504,7 @@ func (h *handler) uploadFirmware(ctx context.Context) error {
 	}
 
 	defer fileHandle.Close()
-	defer os.RemoveAll(filepath.Dir(h.action.FirmwareTempFile))
+	defer h.removeFirmwareTempFile()
 
 	if !h.task.Parameters.DryRun {
 		// initiate firmware upload
@@ -341,8 +521,7 @@ func (h *handler) uploadFirmware(ctx context.Context) error {
 			firmwareUploadTaskID = h.action.ID
 		}
 
-		h.action.FirmwareInstallStep = string(bconsts.FirmwareInstallStepUpload)
-		h.action.BMCTaskID = firmwareUploadTaskID
+		h.setBMCTask(bconsts.FirmwareInstallStepUpload, firmwareUploadTaskID)
 
 		// collect upload metrics
 		fileInfo, err := os.Stat(h.action.FirmwareTempFile)
@@ -379,7 +558,7 @@ func (h *handler) uploadFirmwareInitiateInstall(ctx context.Context) error {
 	}
 
 	defer fileHandle.Close()
-	defer os.RemoveAll(filepath.Dir(h.action.FirmwareTempFile))
+	defer h.removeFirmwareTempFile()
 
 	if !h.task.Parameters.DryRun {
 		// initiate firmware install
@@ -409,8 +588,7 @@ func (h *handler) uploadFirmwareInitiateInstall(ctx context.Context) error {
 			bmcFirmwareInstallTaskID = h.action.ID
 		}
 
-		h.action.FirmwareInstallStep = string(bconsts.FirmwareInstallStepUploadInitiateInstall)
-		h.action.BMCTaskID = bmcFirmwareInstallTaskID
+		h.setBMCTask(bconsts.FirmwareInstallStepUploadInitiateInstall, bmcFirmwareInstallTaskID)
 	}
 
 	h.logger.WithFields(
@@ -442,8 +620,7 @@ func (h *handler) installUploadedFirmware(ctx context.Context) error {
 			bmcFirmwareInstallTaskID = h.action.ID
 		}
 
-		h.action.FirmwareInstallStep = string(bconsts.FirmwareInstallStepInstallUploaded)
-		h.action.BMCTaskID = bmcFirmwareInstallTaskID
+		h.setBMCTask(bconsts.FirmwareInstallStepInstallUploaded, bmcFirmwareInstallTaskID)
 	}
 
 	h.logger.WithFields(
@@ -500,9 +677,6 @@ func (h *handler) pollFirmwareTaskStatus(ctx context.Context) error {
 			"installTask": installTask,
 		}).Info("polling BMC for firmware task status")
 
-	// the prefix we'll be using for all the poll status updates
-	statusPrefix := h.task.Status.Last()
-
 	for {
 		// increment attempts
 		attempts++
@@ -523,6 +697,11 @@ func (h *handler) pollFirmwareTaskStatus(ctx context.Context) error {
 				time.Since(startTS).String(),
 			))
 
+			// the installed BMC firmware could not be verified to equal the expected firmware
+			if inventory {
+				return errors.Wrap(model.ErrInstallVerification, attemptErrors.Error())
+			}
+
 			return attemptErrors
 		}
 
@@ -553,8 +732,7 @@ func (h *handler) pollFirmwareTaskStatus(ctx context.Context) error {
 				// if the BMC came online and is still running the previous version
 				// the install failed
 				if componentIsBMC(h.action.Firmware.Component) && verifyAttempts >= maxVerifyAttempts {
-					errInstall := errors.New("BMC failed to install expected firmware")
-					return errInstall
+					return errors.Wrap(model.ErrInstallVerification, "BMC failed to install expected firmware")
 				}
 
 			default:
@@ -595,10 +773,8 @@ func (h *handler) pollFirmwareTaskStatus(ctx context.Context) error {
 				"status":    status,
 			}).Debug("firmware task status query attempt")
 
-		if h.publisher != nil && status != "" {
-			h.task.Status.Update(h.task.Status.Last(), statusPrefix+" -- "+status)
-			//nolint:errcheck // method called logs errors if any
-			_ = h.publisher.Publish(ctx, h.task)
+		if status != "" {
+			h.publishStepProgress(ctx, status)
 		}
 
 		// error check returns when maxPollStatusAttempts have been reached
@@ -659,7 +835,9 @@ func (h *handler) pollFirmwareTaskStatus(ctx context.Context) error {
 				return err
 			}
 
-			h.action.HostPowerCycled = true
+			h.task.WithLock(func() {
+				h.action.HostPowerCycled = true
+			})
 
 			// reset attempts
 			attempts = 0
@@ -791,7 +969,12 @@ func (h *handler) conditionalPowerOffDevice(_ context.Context) (bool, error) {
 		return false, nil
 	}
 
-	wasPoweredOn, keyExists := h.task.Data.Scratch[devicePoweredOn]
+	var wasPoweredOn string
+	var keyExists bool
+	h.task.WithLock(func() {
+		wasPoweredOn, keyExists = h.task.Data.Scratch[devicePoweredOn]
+	})
+
 	if !keyExists {
 		return false, nil
 	}
@@ -805,6 +988,15 @@ func (h *handler) conditionalPowerOffDevice(_ context.Context) (bool, error) {
 
 // initialize initializes the bmc connection and powers on the host if required.
 func (h *handler) powerOffServer(ctx context.Context) error {
+	var err error
+	h.task.WithPowerLock(func() {
+		err = h.powerOffServerLocked(ctx)
+	})
+
+	return err
+}
+
+func (h *handler) powerOffServerLocked(ctx context.Context) error {
 	powerOffDeviceRequired, err := h.conditionalPowerOffDevice(ctx)
 	if err != nil {
 		return err
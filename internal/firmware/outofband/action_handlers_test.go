@@ -1,15 +1,23 @@
 package outofband
 
 import (
+	"bytes"
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	bconsts "github.com/bmc-toolbox/bmclib/v2/constants"
 	"github.com/bmc-toolbox/common"
 	"github.com/google/uuid"
 	"github.com/metal-automata/agent/internal/device"
 	"github.com/metal-automata/agent/internal/device/outofband"
+	"github.com/metal-automata/agent/internal/download"
 	"github.com/metal-automata/agent/internal/firmware/runner"
 	"github.com/metal-automata/agent/internal/model"
 	"github.com/metal-automata/agent/internal/store"
@@ -310,3 +318,117 @@ func TestPollFirmwareInstallStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestPowerOnServerConcurrentActions(t *testing.T) {
+	t.Setenv(model.EnvTesting, "1")
+
+	actionCtx := newTestActionCtx()
+	actionCtx.Task.Data = &model.FirmwareTaskData{Scratch: map[string]string{}}
+
+	m := new(device.MockOutofbandQueryor)
+	m.EXPECT().Open(mock.Anything).Return(nil)
+
+	var mu sync.Mutex
+	powerState := "Off"
+	var calls []string
+
+	// the power status query is slow enough for the actions to overlap when the power changes are not serialized
+	m.EXPECT().PowerStatus(mock.Anything).RunAndReturn(func(context.Context) (string, error) {
+		mu.Lock()
+		state := powerState
+		calls = append(calls, "status: "+state)
+		mu.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		return state, nil
+	})
+
+	m.EXPECT().SetPowerState(mock.Anything, "on").RunAndReturn(func(context.Context, string) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		powerState = "On"
+		calls = append(calls, "power on")
+
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			assert.Nil(t, initHandler(actionCtx, m).powerOnServer(context.Background()))
+		}()
+	}
+
+	wg.Wait()
+
+	// the second action checks the power state once the first has powered on the server
+	expected := []string{"status: Off", "power on", "status: On", "power on"}
+	assert.Equal(t, expected, calls)
+	assert.Equal(t, "true", actionCtx.Task.Data.Scratch[devicePoweredOn])
+}
+
+func TestDownloadFirmware(t *testing.T) {
+	var rangeRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bios.bin" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if r.Header.Get("Range") != "" {
+			rangeRequests.Add(1)
+		}
+
+		http.ServeContent(w, r, "bios.bin", time.Time{}, bytes.NewReader([]byte("BLOB")))
+	}))
+	defer server.Close()
+
+	newHandler := func(url string) *handler {
+		return &handler{
+			firmware: &rctypes.Firmware{
+				Component: "bios",
+				FileName:  "bios.bin",
+				URL:       url,
+				// sha256 of the contents 'BLOB'
+				Checksum: "sha256:671a0d168d8e3d31819402ac7c3a3cc0abedebbf6a4cda26deacd89724bd6bdc",
+			},
+			task:        &model.FirmwareTask{},
+			action:      &model.Action{ID: "task1-bios-0"},
+			logger:      logrus.NewEntry(logrus.New()),
+			downloadDir: t.TempDir(),
+		}
+	}
+
+	t.Run("partial download is resumed", func(t *testing.T) {
+		h := newHandler(server.URL + "/bios.bin")
+
+		// the partial download left behind by an interrupted run
+		dir, err := download.StagingDir(h.downloadDir, h.action.ID+h.firmware.Checksum)
+		require.Nil(t, err)
+		require.Nil(t, os.WriteFile(filepath.Join(dir, "bios.bin"), []byte("BL"), 0o600))
+
+		require.Nil(t, h.downloadFirmware(context.Background()))
+		assert.Equal(t, filepath.Join(dir, "bios.bin"), h.action.FirmwareTempFile)
+		assert.Equal(t, int32(1), rangeRequests.Load())
+
+		contents, err := os.ReadFile(h.action.FirmwareTempFile)
+		require.Nil(t, err)
+		assert.Equal(t, "BLOB", string(contents))
+	})
+
+	t.Run("failed download is purged", func(t *testing.T) {
+		h := newHandler(server.URL + "/notfound.bin")
+
+		assert.NotNil(t, h.downloadFirmware(context.Background()))
+
+		entries, err := os.ReadDir(h.downloadDir)
+		require.Nil(t, err)
+		assert.Empty(t, entries)
+	})
+}
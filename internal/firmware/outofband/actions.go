@@ -2,12 +2,17 @@ package outofband
 
 import (
 	"context"
+	"os"
 
 	"github.com/metal-automata/agent/internal/device"
 	"github.com/metal-automata/agent/internal/device/outofband"
+	"github.com/metal-automata/agent/internal/download"
 	"github.com/metal-automata/agent/internal/firmware/runner"
 	"github.com/metal-automata/agent/internal/model"
+	rctypes "github.com/metal-automata/rivets/condition"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
 
 	bconsts "github.com/bmc-toolbox/bmclib/v2/constants"
 )
@@ -18,6 +23,7 @@ const (
 	powerOffServer                model.StepName = "powerOffServer"
 	checkInstalledFirmware        model.StepName = "checkInstalledFirmware"
 	downloadFirmware              model.StepName = "downloadFirmware"
+	extractFirmware               model.StepName = "extractFirmware"
 	preInstallResetBMC            model.StepName = "preInstallResetBMC"
 	uploadFirmware                model.StepName = "uploadFirmware"
 	pollUploadStatus              model.StepName = "pollUploadStatus"
@@ -44,12 +50,17 @@ type ActionHandler struct {
 
 func initHandler(actionCtx *runner.ActionHandlerContext, queryor device.OutofbandQueryor) *handler {
 	return &handler{
-		store:         actionCtx.Store,
-		task:          actionCtx.Task,
-		firmware:      actionCtx.Firmware,
-		publisher:     actionCtx.Publisher,
-		logger:        actionCtx.Logger,
-		deviceQueryor: queryor,
+		store:           actionCtx.Store,
+		task:            actionCtx.Task,
+		firmware:        actionCtx.Firmware,
+		publisher:       actionCtx.Publisher,
+		logger:          actionCtx.Logger,
+		deviceQueryor:   queryor,
+		cache:           actionCtx.FirmwareCache,
+		verifier:        actionCtx.SignatureVerifier,
+		downloadTimeout: actionCtx.DownloadTimeout,
+		downloadDir:     actionCtx.DownloadDir,
+		bucketCreds:     actionCtx.BucketCredentials,
 	}
 }
 
@@ -77,7 +88,12 @@ func (o *ActionHandler) ComposeAction(ctx context.Context, actionCtx *runner.Act
 
 	bmcResetOnInstallFailure, bmcResetPostInstall := outofband.BmcResetParams(required)
 
-	steps, err := o.composeSteps(required, bmcResetBeforeInstall)
+	payload, err := download.ParsePayload(actionCtx.Firmware.URL)
+	if err != nil {
+		return nil, errors.Wrap(errCompose, err.Error())
+	}
+
+	steps, err := o.composeSteps(required, bmcResetBeforeInstall, payload != nil)
 	if err != nil {
 		return nil, errors.Wrap(errCompose, err.Error())
 	}
@@ -100,7 +116,7 @@ func (o *ActionHandler) ComposeAction(ctx context.Context, actionCtx *runner.Act
 	return action, nil
 }
 
-func (o *ActionHandler) composeSteps(required []bconsts.FirmwareInstallStep, preInstallBMCReset bool) (model.Steps, error) {
+func (o *ActionHandler) composeSteps(required []bconsts.FirmwareInstallStep, preInstallBMCReset, extractPayload bool) (model.Steps, error) {
 	var final model.Steps
 
 	// pre-install steps
@@ -120,6 +136,11 @@ func (o *ActionHandler) composeSteps(required []bconsts.FirmwareInstallStep, pre
 		preInstallSteps = preInstallSteps.Remove(preInstallResetBMC)
 	}
 
+	// skip payload extraction when the firmware file is not an archive
+	if !extractPayload {
+		preInstallSteps = preInstallSteps.Remove(extractFirmware)
+	}
+
 	// populate steps in order of execution
 	//
 	// Power on server unless it explicitly requires a power off as the first step
@@ -181,6 +202,106 @@ func (o *ActionHandler) convFirmwareInstallSteps(required []bconsts.FirmwareInst
 	return final, nil
 }
 
+// Assign action step handlers to a previously initialized action
+//
+// This is mainly for resumed actions which were loaded from active Task object the store (KV)
+// since the actions were previously composed, now they just have to be assigned the step handler methods.
+//
+// Before the handlers are assigned the step states are reconciled with the BMC task attributes
+// recorded on the action, this ensures a firmware that was uploaded to the BMC is not uploaded again,
+// and that the subsequent poll step picks up the BMC task that was previously initiated.
+func AssignStepHandlers(action *model.Action, actionCtx *runner.ActionHandlerContext) error {
+	var deviceQueryor device.OutofbandQueryor
+	if actionCtx.DeviceQueryor == nil {
+		deviceQueryor = outofband.NewDeviceQueryor(actionCtx.Task.Server, actionCtx.Logger)
+		actionCtx.DeviceQueryor = deviceQueryor
+	} else {
+		deviceQueryor = actionCtx.DeviceQueryor.(device.OutofbandQueryor)
+	}
+
+	ah := &ActionHandler{handler: initHandler(actionCtx, deviceQueryor)}
+	ah.handler.action = action
+
+	reconcileResumedSteps(action, actionCtx.Logger)
+
+	for _, step := range action.Steps {
+		if rctypes.StateIsComplete(step.State) {
+			continue
+		}
+
+		h, err := ah.definitions().ByName(step.Name)
+		if err != nil {
+			return err
+		}
+
+		step.Handler = h.Handler
+	}
+
+	return nil
+}
+
+// reconcileResumedSteps updates the state of the steps in a resumed action based on the BMC task attributes
+// that were recorded on the action when it was last run.
+func reconcileResumedSteps(action *model.Action, logger *logrus.Entry) {
+	// steps that initiate a BMC task and the corresponding firmware install step recorded on the action
+	bmcTaskSteps := map[model.StepName]bconsts.FirmwareInstallStep{
+		uploadFirmware:                bconsts.FirmwareInstallStepUpload,
+		uploadFirmwareInitiateInstall: bconsts.FirmwareInstallStepUploadInitiateInstall,
+		installUploadedFirmware:       bconsts.FirmwareInstallStepInstallUploaded,
+	}
+
+	// steps that require the downloaded firmware file
+	fileSteps := []model.StepName{uploadFirmware, uploadFirmwareInitiateInstall}
+
+	var fileRequired bool
+
+	for _, step := range action.Steps {
+		if rctypes.StateIsComplete(step.State) {
+			continue
+		}
+
+		// The step handler returned and the BMC task was recorded on the action,
+		// the agent was interrupted before the step state was updated.
+		installStep, exists := bmcTaskSteps[step.Name]
+		if exists && step.State == model.StateActive &&
+			action.BMCTaskID != "" && action.FirmwareInstallStep == string(installStep) {
+			logger.WithFields(
+				logrus.Fields{
+					"step":      step.Name,
+					"bmcTaskID": action.BMCTaskID,
+				}).Info("BMC task previously initiated by step, marking step successful")
+
+			step.SetState(model.StateSucceeded)
+
+			continue
+		}
+
+		if slices.Contains(fileSteps, step.Name) {
+			fileRequired = true
+		}
+	}
+
+	if !fileRequired || action.FirmwareTempFile == "" {
+		return
+	}
+
+	// The firmware file was downloaded by the agent that previously ran this action,
+	// if its not present locally it has to be downloaded again.
+	if _, err := os.Stat(action.FirmwareTempFile); err == nil {
+		return
+	}
+
+	logger.WithField("file", action.FirmwareTempFile).Info("firmware file not present, it will be downloaded again")
+
+	action.FirmwareTempFile = ""
+
+	for _, step := range action.Steps {
+		if step.Name == downloadFirmware || step.Name == extractFirmware {
+			step.SetState(model.StatePending)
+		}
+	}
+}
+
 func (o *ActionHandler) definitions() model.Steps {
 	return model.Steps{
 		{
@@ -211,6 +332,13 @@ func (o *ActionHandler) definitions() model.Steps {
 			Description: "Download and verify firmware file checksum.",
 			State:       model.StatePending,
 		},
+		{
+			Name:        extractFirmware,
+			Group:       PreInstall,
+			Handler:     o.handler.extractFirmware,
+			Description: "Extract firmware payload from the vendor archive and verify its checksum.",
+			State:       model.StatePending,
+		},
 		{
 			Name:        preInstallResetBMC,
 			Group:       PreInstall,
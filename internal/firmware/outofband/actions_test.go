@@ -2,6 +2,8 @@ package outofband
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	bconsts "github.com/bmc-toolbox/bmclib/v2/constants"
@@ -216,6 +218,7 @@ func TestComposeSteps(t *testing.T) {
 		name              string
 		required          []bconsts.FirmwareInstallStep
 		powerCycleBMC     bool
+		extractPayload    bool
 		expect            []model.StepName
 		expectErrContains string
 	}{
@@ -287,6 +290,22 @@ func TestComposeSteps(t *testing.T) {
 				pollInstallStatus,
 			},
 		},
+		{
+			name:           "with firmware payload extracted from archive",
+			extractPayload: true,
+			required: []bconsts.FirmwareInstallStep{
+				bconsts.FirmwareInstallStepUploadInitiateInstall,
+				bconsts.FirmwareInstallStepInstallStatus,
+			},
+			expect: []model.StepName{
+				powerOnServer,
+				checkInstalledFirmware,
+				downloadFirmware,
+				extractFirmware,
+				uploadFirmwareInitiateInstall,
+				pollInstallStatus,
+			},
+		},
 		{
 			name:          "with power off, firmware upload and install steps",
 			powerCycleBMC: true,
@@ -322,7 +341,7 @@ func TestComposeSteps(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			o := ActionHandler{}
-			got, err := o.composeSteps(tc.required, tc.powerCycleBMC)
+			got, err := o.composeSteps(tc.required, tc.powerCycleBMC, tc.extractPayload)
 			if tc.expectErrContains != "" {
 				assert.ErrorContains(t, err, tc.expectErrContains)
 				return
@@ -393,3 +412,165 @@ func TestConvFirmwareInstallSteps(t *testing.T) {
 		})
 	}
 }
+
+func TestAssignStepHandlers(t *testing.T) {
+	newTestActionCtx := func() *runner.ActionHandlerContext {
+		return &runner.ActionHandlerContext{
+			TaskHandlerContext: &runner.TaskHandlerContext{
+				Task: &model.FirmwareTask{
+					Parameters: &rctypes.FirmwareInstallTaskParameters{},
+					Server:     &rctypes.Server{},
+				},
+				Logger:        logrus.NewEntry(logrus.New()),
+				DeviceQueryor: new(device.MockOutofbandQueryor),
+			},
+			Firmware: &rctypes.Firmware{Component: "bios", Version: "2.6.6"},
+		}
+	}
+
+	newTestAction := func(states map[model.StepName]rctypes.State) *model.Action {
+		action := &model.Action{Firmware: rctypes.Firmware{Component: "bios", Version: "2.6.6"}}
+		for _, name := range []model.StepName{
+			powerOnServer,
+			checkInstalledFirmware,
+			downloadFirmware,
+			uploadFirmwareInitiateInstall,
+			pollInstallStatus,
+		} {
+			state, exists := states[name]
+			if !exists {
+				state = model.StatePending
+			}
+
+			action.Steps = append(action.Steps, &model.Step{Name: name, State: state})
+		}
+
+		return action
+	}
+
+	stepState := func(action *model.Action, name model.StepName) rctypes.State {
+		for _, step := range action.Steps {
+			if step.Name == name {
+				return step.State
+			}
+		}
+
+		return ""
+	}
+
+	existingFile := filepath.Join(t.TempDir(), "bios.bin")
+	if err := os.WriteFile(existingFile, []byte("BLOB"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                  string
+		action                *model.Action
+		expectStates          map[model.StepName]rctypes.State
+		expectFirmwareTmpFile string
+	}{
+		{
+			name: "in flight install poll is resumed with existing BMC task",
+			action: func() *model.Action {
+				a := newTestAction(map[model.StepName]rctypes.State{
+					powerOnServer:                 model.StateSucceeded,
+					checkInstalledFirmware:        model.StateSucceeded,
+					downloadFirmware:              model.StateSucceeded,
+					uploadFirmwareInitiateInstall: model.StateSucceeded,
+					pollInstallStatus:             model.StateActive,
+				})
+				a.BMCTaskID = "JID_1234"
+				a.FirmwareInstallStep = string(bconsts.FirmwareInstallStepUploadInitiateInstall)
+				a.FirmwareTempFile = "/tmp/does-not-exist/bios.bin"
+
+				return a
+			}(),
+			expectStates: map[model.StepName]rctypes.State{
+				downloadFirmware:              model.StateSucceeded,
+				uploadFirmwareInitiateInstall: model.StateSucceeded,
+				pollInstallStatus:             model.StateActive,
+			},
+			expectFirmwareTmpFile: "/tmp/does-not-exist/bios.bin",
+		},
+		{
+			name: "active upload step with BMC task recorded is not repeated",
+			action: func() *model.Action {
+				a := newTestAction(map[model.StepName]rctypes.State{
+					powerOnServer:                 model.StateSucceeded,
+					checkInstalledFirmware:        model.StateSucceeded,
+					downloadFirmware:              model.StateSucceeded,
+					uploadFirmwareInitiateInstall: model.StateActive,
+				})
+				a.BMCTaskID = "JID_1234"
+				a.FirmwareInstallStep = string(bconsts.FirmwareInstallStepUploadInitiateInstall)
+
+				return a
+			}(),
+			expectStates: map[model.StepName]rctypes.State{
+				downloadFirmware:              model.StateSucceeded,
+				uploadFirmwareInitiateInstall: model.StateSucceeded,
+				pollInstallStatus:             model.StatePending,
+			},
+		},
+		{
+			name: "active upload step without firmware file is downloaded again",
+			action: func() *model.Action {
+				a := newTestAction(map[model.StepName]rctypes.State{
+					powerOnServer:                 model.StateSucceeded,
+					checkInstalledFirmware:        model.StateSucceeded,
+					downloadFirmware:              model.StateSucceeded,
+					uploadFirmwareInitiateInstall: model.StateActive,
+				})
+				a.FirmwareTempFile = "/tmp/does-not-exist/bios.bin"
+
+				return a
+			}(),
+			expectStates: map[model.StepName]rctypes.State{
+				downloadFirmware:              model.StatePending,
+				uploadFirmwareInitiateInstall: model.StateActive,
+			},
+			expectFirmwareTmpFile: "",
+		},
+		{
+			name: "active upload step with firmware file present is retried",
+			action: func() *model.Action {
+				a := newTestAction(map[model.StepName]rctypes.State{
+					powerOnServer:                 model.StateSucceeded,
+					checkInstalledFirmware:        model.StateSucceeded,
+					downloadFirmware:              model.StateSucceeded,
+					uploadFirmwareInitiateInstall: model.StateActive,
+				})
+				a.FirmwareTempFile = existingFile
+
+				return a
+			}(),
+			expectStates: map[model.StepName]rctypes.State{
+				downloadFirmware:              model.StateSucceeded,
+				uploadFirmwareInitiateInstall: model.StateActive,
+			},
+			expectFirmwareTmpFile: existingFile,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := AssignStepHandlers(tc.action, newTestActionCtx())
+			assert.Nil(t, err)
+
+			for name, state := range tc.expectStates {
+				assert.Equal(t, state, stepState(tc.action, name), name)
+			}
+
+			assert.Equal(t, tc.expectFirmwareTmpFile, tc.action.FirmwareTempFile)
+
+			for _, step := range tc.action.Steps {
+				if rctypes.StateIsComplete(step.State) {
+					assert.Nil(t, step.Handler, step.Name)
+					continue
+				}
+
+				assert.NotNil(t, step.Handler, step.Name)
+			}
+		})
+	}
+}
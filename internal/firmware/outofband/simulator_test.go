@@ -0,0 +1,172 @@
+package outofband
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/metal-automata/agent/internal/device/outofband"
+	"github.com/metal-automata/agent/internal/device/outofband/simulator"
+	"github.com/metal-automata/agent/internal/firmware/runner"
+	"github.com/metal-automata/agent/internal/model"
+	rctypes "github.com/metal-automata/rivets/condition"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSimulatorActionCtx returns an action handler context to install the firmware on the simulated BMC,
+// the firmware file is served from a local file URL.
+func newSimulatorActionCtx(t *testing.T, sim *simulator.Simulator, component, version string) *runner.ActionHandlerContext {
+	t.Helper()
+
+	content := []byte("simulated " + component + " firmware " + version)
+	file := filepath.Join(t.TempDir(), component+".bin")
+	require.Nil(t, os.WriteFile(file, content, 0o600))
+
+	sum := sha256.Sum256(content)
+
+	server := &rctypes.Server{
+		Vendor: simulator.Vendor,
+		BMC: &rctypes.BMC{
+			Username:  "foo",
+			Password:  "bar",
+			IPAddress: "127.0.0.1",
+		},
+	}
+
+	logger := logrus.NewEntry(logrus.New())
+
+	return &runner.ActionHandlerContext{
+		TaskHandlerContext: &runner.TaskHandlerContext{
+			Task: &model.FirmwareTask{
+				Parameters: &rctypes.FirmwareInstallTaskParameters{AssetID: uuid.New()},
+				Data:       &model.FirmwareTaskData{Scratch: map[string]string{}},
+				Server:     server,
+				State:      model.StateActive,
+			},
+			Logger:        logger,
+			DeviceQueryor: outofband.NewDeviceQueryor(server, logger, outofband.WithDialContext(sim.DialContext)),
+			DownloadDir:   t.TempDir(),
+		},
+		Firmware: &rctypes.Firmware{
+			Vendor:    "simulated",
+			Version:   version,
+			URL:       "file://" + filepath.ToSlash(file),
+			FileName:  component + ".bin",
+			Checksum:  "sha256:" + hex.EncodeToString(sum[:]),
+			Component: component,
+		},
+		First: true,
+		Last:  true,
+	}
+}
+
+// runSimulatorAction composes the firmware install action and runs its steps against the simulated BMC.
+func runSimulatorAction(t *testing.T, actionCtx *runner.ActionHandlerContext) (*model.Action, error) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	ah := &ActionHandler{}
+	action, err := ah.ComposeAction(ctx, actionCtx)
+	require.Nil(t, err)
+
+	for _, step := range action.Steps {
+		if err := step.Handler(ctx); err != nil {
+			return action, err
+		}
+	}
+
+	return action, nil
+}
+
+func TestFirmwareInstallSimulator(t *testing.T) {
+	// skip the poll and power state change delays
+	t.Setenv(model.EnvTesting, "1")
+
+	t.Run("bios firmware installed", func(t *testing.T) {
+		sim := simulator.New(
+			simulator.WithInstalledFirmware("bios", "1.0.0"),
+			simulator.WithFirmwareUpdate("bios", "2.0.0"),
+		)
+		defer sim.Close()
+
+		action, err := runSimulatorAction(t, newSimulatorActionCtx(t, sim, "bios", "2.0.0"))
+		require.Nil(t, err)
+
+		assert.Equal(t, "2.0.0", sim.InstalledFirmware("bios"))
+		assert.Equal(t, 1, sim.Uploads())
+
+		// the host was powered off before the install
+		assert.Equal(t, simulator.PowerStateOff, sim.PowerState())
+		assert.True(t, action.HostPowerOffPreInstall)
+
+		// the downloaded firmware file was purged
+		assert.NoFileExists(t, action.FirmwareTempFile)
+	})
+
+	t.Run("bmc firmware installed and verified", func(t *testing.T) {
+		sim := simulator.New(
+			simulator.WithInstalledFirmware("bmc", "1.0.0"),
+			simulator.WithFirmwareUpdate("bmc", "2.0.0"),
+		)
+		defer sim.Close()
+
+		_, err := runSimulatorAction(t, newSimulatorActionCtx(t, sim, "bmc", "2.0.0"))
+		require.Nil(t, err)
+
+		assert.Equal(t, "2.0.0", sim.InstalledFirmware("bmc"))
+
+		// the BMC restart to apply its firmware invalidated the session, a new session was established to verify the install
+		assert.Greater(t, sim.Logins(), 1)
+	})
+
+	t.Run("installed firmware equals expected", func(t *testing.T) {
+		sim := simulator.New(simulator.WithInstalledFirmware("bios", "2.0.0"))
+		defer sim.Close()
+
+		_, err := runSimulatorAction(t, newSimulatorActionCtx(t, sim, "bios", "2.0.0"))
+		assert.ErrorIs(t, err, model.ErrInstalledFirmwareEqual)
+		assert.Equal(t, 0, sim.Uploads())
+	})
+
+	t.Run("install task failed", func(t *testing.T) {
+		sim := simulator.New(
+			simulator.WithFirmwareUpdate("bios", "2.0.0"),
+			simulator.WithTaskFailed(),
+		)
+		defer sim.Close()
+
+		_, err := runSimulatorAction(t, newSimulatorActionCtx(t, sim, "bios", "2.0.0"))
+		assert.ErrorIs(t, err, outofband.ErrFirmwareInstallFailed)
+		assert.Equal(t, "1.0.0", sim.InstalledFirmware("bios"))
+	})
+
+	t.Run("install task stuck in running", func(t *testing.T) {
+		sim := simulator.New(
+			simulator.WithFirmwareUpdate("bios", "2.0.0"),
+			simulator.WithTaskStuck(),
+		)
+		defer sim.Close()
+
+		_, err := runSimulatorAction(t, newSimulatorActionCtx(t, sim, "bios", "2.0.0"))
+		assert.ErrorContains(t, err, outofband.ErrMaxBMCQueryAttempts.Error())
+	})
+
+	t.Run("flaky sessions", func(t *testing.T) {
+		sim := simulator.New(
+			simulator.WithFirmwareUpdate("bios", "2.0.0"),
+			simulator.WithLoginFailures(2),
+		)
+		defer sim.Close()
+
+		_, err := runSimulatorAction(t, newSimulatorActionCtx(t, sim, "bios", "2.0.0"))
+		require.Nil(t, err)
+		assert.Equal(t, "2.0.0", sim.InstalledFirmware("bios"))
+	})
+}
@@ -2,8 +2,12 @@ package firmware
 
 import (
 	"context"
+	"time"
 
+	"github.com/metal-automata/agent/internal/audit"
 	"github.com/metal-automata/agent/internal/ctrl"
+	"github.com/metal-automata/agent/internal/device/outofband"
+	"github.com/metal-automata/agent/internal/download"
 	"github.com/metal-automata/agent/internal/firmware/runner"
 	"github.com/metal-automata/agent/internal/model"
 	"github.com/metal-automata/agent/internal/store"
@@ -15,17 +19,98 @@ import (
 type Handler struct {
 	facilityCode,
 	controllerID string
-	repository store.Repository
-	publisher  ctrl.Publisher
+	repository        store.Repository
+	publisher         ctrl.Publisher
+	firmwareCache     *download.Cache
+	signatureVerifier *download.SignatureVerifier
+	downloadTimeout   time.Duration
+	downloadDir       string
+	bucketCredentials *download.BucketCredentials
+	uploadLimiter     *outofband.UploadLimiter
+	auditLog          *audit.Log
+	actionConcurrency int
+	installRules      []*model.InstallRules
 }
 
-func NewHandler(facilityCode, controllerID string, repository store.Repository, publisher ctrl.Publisher) *Handler {
-	return &Handler{
+// Option sets parameters on the firmware install Handler
+type Option func(*Handler)
+
+func NewHandler(facilityCode, controllerID string, repository store.Repository, publisher ctrl.Publisher, options ...Option) *Handler {
+	h := &Handler{
 		facilityCode: facilityCode,
 		controllerID: controllerID,
 		repository:   repository,
 		publisher:    publisher,
 	}
+
+	for _, opt := range options {
+		opt(h)
+	}
+
+	return h
+}
+
+// WithFirmwareCache sets the firmware cache, firmware files are fetched through the cache when set.
+func WithFirmwareCache(c *download.Cache) Option {
+	return func(h *Handler) {
+		h.firmwareCache = c
+	}
+}
+
+// WithDownloadTimeout sets the timeout for each firmware download attempt.
+func WithDownloadTimeout(timeout time.Duration) Option {
+	return func(h *Handler) {
+		h.downloadTimeout = timeout
+	}
+}
+
+// WithDownloadDir sets the directory firmware files are staged in before install.
+func WithDownloadDir(dir string) Option {
+	return func(h *Handler) {
+		h.downloadDir = dir
+	}
+}
+
+// WithBucketCredentials sets the credentials to download firmware from object storage URLs.
+func WithBucketCredentials(c *download.BucketCredentials) Option {
+	return func(h *Handler) {
+		h.bucketCredentials = c
+	}
+}
+
+// WithUploadLimiter sets the limiter for concurrent out-of-band firmware uploads.
+func WithUploadLimiter(l *outofband.UploadLimiter) Option {
+	return func(h *Handler) {
+		h.uploadLimiter = l
+	}
+}
+
+// WithSignatureVerifier sets the verifier for firmware file signatures.
+func WithSignatureVerifier(v *download.SignatureVerifier) Option {
+	return func(h *Handler) {
+		h.signatureVerifier = v
+	}
+}
+
+// WithAuditLog sets the audit log the firmware install transitions are recorded to.
+func WithAuditLog(l *audit.Log) Option {
+	return func(h *Handler) {
+		h.auditLog = l
+	}
+}
+
+// WithActionConcurrency sets the number of independent firmware install actions of a task run concurrently.
+func WithActionConcurrency(n int) Option {
+	return func(h *Handler) {
+		h.actionConcurrency = n
+	}
+}
+
+// WithInstallRules sets the firmware install ordering and dependency rules.
+func WithInstallRules(rules []*model.InstallRules) Option {
+	return func(h *Handler) {
+		h.installRules = rules
+	}
 }
 
 func (h *Handler) Run(ctx context.Context, genericTask *rctypes.Task[any, any], l *logrus.Logger) error {
@@ -50,11 +135,25 @@ func (h *Handler) Run(ctx context.Context, genericTask *rctypes.Task[any, any],
 		ctxLogger,
 	)
 
+	handler.FirmwareCache = h.firmwareCache
+	handler.SignatureVerifier = h.signatureVerifier
+	handler.DownloadTimeout = h.downloadTimeout
+	handler.DownloadDir = h.downloadDir
+	handler.BucketCredentials = h.bucketCredentials
+	handler.UploadLimiter = h.uploadLimiter
+	handler.ActionConcurrency = h.actionConcurrency
+	handler.InstallRules = h.installRules
+
 	// init runner
-	r := runner.New(ctxLogger)
+	r := runner.New(ctxLogger, runner.WithAuditLog(h.auditLog))
 
 	ctxLogger.WithField("mode", runMode).Info("running task for device")
 	if err := r.RunTask(ctx, task, handler); err != nil {
+		if errors.Is(err, model.ErrHostPowerCycleRequired) {
+			ctxLogger.Info("task for device paused, waiting for host power cycle")
+			return err
+		}
+
 		ctxLogger.WithError(err).Error("task for device failed")
 		return err
 	}
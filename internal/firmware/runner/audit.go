@@ -0,0 +1,155 @@
+package runner
+
+import (
+	"context"
+	"time"
+
+	"github.com/metal-automata/agent/internal/audit"
+	"github.com/metal-automata/agent/internal/model"
+	"github.com/sirupsen/logrus"
+
+	rctypes "github.com/metal-automata/rivets/condition"
+)
+
+// auditHandler records the task, action and step state transitions to the audit log
+// each time the task is published.
+type auditHandler struct {
+	TaskHandler
+	task     *model.FirmwareTask
+	auditLog *audit.Log
+	logger   *logrus.Entry
+	// the last recorded states, indexed by the task, action and step keys
+	states map[string]rctypes.State
+}
+
+func newAuditHandler(task *model.FirmwareTask, handler TaskHandler, auditLog *audit.Log, logger *logrus.Entry) *auditHandler {
+	h := &auditHandler{
+		TaskHandler: handler,
+		task:        task,
+		auditLog:    auditLog,
+		logger:      logger,
+		states:      map[string]rctypes.State{},
+	}
+
+	// states of a resumed task were recorded by the previous run
+	h.states[h.taskKey()] = task.State
+	if task.Data != nil {
+		for _, action := range task.Data.ActionsPlanned {
+			h.states[actionKey(action)] = action.State
+			for _, step := range action.Steps {
+				h.states[stepKey(action, step)] = step.State
+			}
+		}
+	}
+
+	return h
+}
+
+func (h *auditHandler) Publish(ctx context.Context) {
+	var records []audit.Record
+	h.task.WithLock(func() {
+		records = h.transitions()
+	})
+
+	if err := h.auditLog.Write(records...); err != nil {
+		h.logger.WithError(err).Warn("audit log write error")
+	}
+
+	h.TaskHandler.Publish(ctx)
+}
+
+// transitions returns the records for the task, action and step states changed since the last publish.
+func (h *auditHandler) transitions() []audit.Record {
+	now := time.Now()
+
+	var records []audit.Record
+	if h.changed(h.taskKey(), h.task.State) {
+		records = append(records, h.record(now, audit.KindTask, nil, nil))
+	}
+
+	if h.task.Data == nil {
+		return records
+	}
+
+	for _, action := range h.task.Data.ActionsPlanned {
+		for _, step := range action.Steps {
+			if h.changed(stepKey(action, step), step.State) {
+				records = append(records, h.record(now, audit.KindStep, action, step))
+			}
+		}
+
+		if h.changed(actionKey(action), action.State) {
+			records = append(records, h.record(now, audit.KindAction, action, nil))
+		}
+	}
+
+	return records
+}
+
+// changed records the state and returns true when it differs from the previous state,
+// actions and steps planned are not recorded until they transition out of the pending state.
+func (h *auditHandler) changed(key string, state rctypes.State) bool {
+	prev, exists := h.states[key]
+	h.states[key] = state
+
+	if !exists {
+		return state != model.StatePending
+	}
+
+	return prev != state
+}
+
+func (h *auditHandler) record(ts time.Time, kind audit.RecordKind, action *model.Action, step *model.Step) audit.Record {
+	record := audit.Record{
+		Timestamp:     ts,
+		Kind:          kind,
+		ConditionID:   h.task.ID.String(),
+		ConditionKind: string(h.task.Kind),
+		State:         string(h.task.State),
+		Status:        h.task.Status.Last(),
+		TaskCreatedAt: h.task.CreatedAt,
+		TaskUpdatedAt: h.task.UpdatedAt,
+	}
+
+	if h.task.Parameters != nil {
+		record.ServerID = h.task.Parameters.AssetID.String()
+	}
+
+	if h.task.Server != nil {
+		record.ServerVendor = h.task.Server.Vendor
+		record.ServerModel = h.task.Server.Model
+	}
+
+	if action == nil {
+		return record
+	}
+
+	record.ActionID = action.ID
+	record.Component = action.Firmware.Component
+	record.FirmwareID = action.Firmware.ID
+	record.FirmwareVendor = action.Firmware.Vendor
+	record.FirmwareVersion = action.Firmware.Version
+	record.BMCTaskID = action.BMCTaskID
+	record.State = string(action.State)
+	record.Status = ""
+
+	if step != nil {
+		record.Step = string(step.Name)
+		record.State = string(step.State)
+		record.Status = step.Status
+	}
+
+	return record
+}
+
+func (h *auditHandler) taskKey() string {
+	return h.task.ID.String()
+}
+
+func actionKey(action *model.Action) string {
+	return action.ID
+}
+
+func stepKey(action *model.Action, step *model.Step) string {
+	return action.ID + "/" + string(step.Name)
+}
@@ -22,6 +22,65 @@ func (_m *MockTaskHandler) EXPECT() *MockTaskHandler_Expecter {
 	return &MockTaskHandler_Expecter{mock: &_m.Mock}
 }
 
+// ComposeRollback provides a mock function with given fields: ctx, failed
+func (_m *MockTaskHandler) ComposeRollback(ctx context.Context, failed *model.Action) (*model.Action, error) {
+	ret := _m.Called(ctx, failed)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ComposeRollback")
+	}
+
+	var r0 *model.Action
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Action) (*model.Action, error)); ok {
+		return rf(ctx, failed)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Action) *model.Action); ok {
+		r0 = rf(ctx, failed)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Action)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *model.Action) error); ok {
+		r1 = rf(ctx, failed)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockTaskHandler_ComposeRollback_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ComposeRollback'
+type MockTaskHandler_ComposeRollback_Call struct {
+	*mock.Call
+}
+
+// ComposeRollback is a helper method to define mock.On call
+//   - ctx context.Context
+//   - failed *model.Action
+func (_e *MockTaskHandler_Expecter) ComposeRollback(ctx interface{}, failed interface{}) *MockTaskHandler_ComposeRollback_Call {
+	return &MockTaskHandler_ComposeRollback_Call{Call: _e.mock.On("ComposeRollback", ctx, failed)}
+}
+
+func (_c *MockTaskHandler_ComposeRollback_Call) Run(run func(ctx context.Context, failed *model.Action)) *MockTaskHandler_ComposeRollback_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*model.Action))
+	})
+	return _c
+}
+
+func (_c *MockTaskHandler_ComposeRollback_Call) Return(_a0 *model.Action, _a1 error) *MockTaskHandler_ComposeRollback_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockTaskHandler_ComposeRollback_Call) RunAndReturn(run func(context.Context, *model.Action) (*model.Action, error)) *MockTaskHandler_ComposeRollback_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Initialize provides a mock function with given fields: ctx
 func (_m *MockTaskHandler) Initialize(ctx context.Context) error {
 	ret := _m.Called(ctx)
@@ -102,6 +161,40 @@ func (_c *MockTaskHandler_OnFailure_Call) RunAndReturn(run func(context.Context,
 	return _c
 }
 
+// OnPause provides a mock function with given fields: ctx, task
+func (_m *MockTaskHandler) OnPause(ctx context.Context, task *model.FirmwareTask) {
+	_m.Called(ctx, task)
+}
+
+// MockTaskHandler_OnPause_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'OnPause'
+type MockTaskHandler_OnPause_Call struct {
+	*mock.Call
+}
+
+// OnPause is a helper method to define mock.On call
+//   - ctx context.Context
+//   - task *model.FirmwareTask
+func (_e *MockTaskHandler_Expecter) OnPause(ctx interface{}, task interface{}) *MockTaskHandler_OnPause_Call {
+	return &MockTaskHandler_OnPause_Call{Call: _e.mock.On("OnPause", ctx, task)}
+}
+
+func (_c *MockTaskHandler_OnPause_Call) Run(run func(ctx context.Context, task *model.FirmwareTask)) *MockTaskHandler_OnPause_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*model.FirmwareTask))
+	})
+	return _c
+}
+
+func (_c *MockTaskHandler_OnPause_Call) Return() *MockTaskHandler_OnPause_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockTaskHandler_OnPause_Call) RunAndReturn(run func(context.Context, *model.FirmwareTask)) *MockTaskHandler_OnPause_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // OnSuccess provides a mock function with given fields: ctx, task
 func (_m *MockTaskHandler) OnSuccess(ctx context.Context, task *model.FirmwareTask) {
 	_m.Called(ctx, task)
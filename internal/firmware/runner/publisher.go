@@ -2,11 +2,14 @@ package runner
 
 import (
 	"context"
+	"sync"
 
 	"github.com/metal-automata/agent/internal/ctrl"
 	"github.com/metal-automata/agent/internal/model"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+
+	rctypes "github.com/metal-automata/rivets/condition"
 )
 
 var (
@@ -24,17 +27,29 @@ type Publisher interface {
 type StatusPublisher struct {
 	logger *logrus.Entry
 	cp     ctrl.Publisher
+	// mu serializes publishes by concurrently running actions,
+	// so a task copy is never published after a later copy of the task.
+	mu sync.Mutex
 }
 
 func NewTaskStatusPublisher(logger *logrus.Entry, cp ctrl.Publisher) Publisher {
 	return &StatusPublisher{
-		logger,
-		cp,
+		logger: logger,
+		cp:     cp,
 	}
 }
 
 func (s *StatusPublisher) Publish(ctx context.Context, task *model.FirmwareTask) error {
-	genericTask, err := task.CopyAsGenericTask()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var genericTask *rctypes.Task[any, any]
+	var err error
+
+	task.WithLock(func() {
+		genericTask, err = task.CopyAsGenericTask()
+	})
+
 	if err != nil {
 		err = errors.Wrap(ErrPublishTask, err.Error())
 		s.logger.WithError(err).Warn("Task publish error")
@@ -3,10 +3,13 @@ package runner
 import (
 	"context"
 	"fmt"
-	"os"
 	"runtime/debug"
+	"strings"
 	"time"
 
+	"github.com/metal-automata/agent/internal/audit"
+	"github.com/metal-automata/agent/internal/device/outofband"
+	"github.com/metal-automata/agent/internal/download"
 	"github.com/metal-automata/agent/internal/metrics"
 	"github.com/metal-automata/agent/internal/model"
 	"github.com/metal-automata/agent/internal/store"
@@ -17,17 +20,36 @@ import (
 	rctypes "github.com/metal-automata/rivets/condition"
 )
 
+var (
+	errActionDependency = errors.New("error in action dependencies")
+)
+
 // A Runner instance runs a single task, to install firmware on one or more server components.
 type Runner struct {
-	logger *logrus.Entry
+	logger   *logrus.Entry
+	auditLog *audit.Log
+}
+
+// Option sets parameters on the Runner
+type Option func(*Runner)
+
+// WithAuditLog sets the audit log the task, action and step state transitions are recorded to.
+func WithAuditLog(l *audit.Log) Option {
+	return func(r *Runner) {
+		r.auditLog = l
+	}
 }
 
 type TaskHandler interface {
 	Initialize(ctx context.Context) error
 	Query(ctx context.Context) error
 	PlanActions(ctx context.Context) error
+	// ComposeRollback returns an action to reinstall the firmware installed before the failed action.
+	ComposeRollback(ctx context.Context, failed *model.Action) (*model.Action, error)
 	OnSuccess(ctx context.Context, task *model.FirmwareTask)
 	OnFailure(ctx context.Context, task *model.FirmwareTask)
+	// OnPause is invoked when the task is paused for a host power cycle, the task remains active to be resumed.
+	OnPause(ctx context.Context, task *model.FirmwareTask)
 	Publish(ctx context.Context)
 }
 
@@ -49,6 +71,31 @@ type TaskHandlerContext struct {
 
 	// Data store repository
 	Store store.Repository
+
+	// FirmwareCache is the local firmware file cache, this is nil when the cache is not enabled.
+	FirmwareCache *download.Cache
+
+	// SignatureVerifier verifies firmware file signatures, this is nil when verification is not configured.
+	SignatureVerifier *download.SignatureVerifier
+
+	// DownloadTimeout is the timeout for each firmware download attempt, the download package default applies when not set.
+	DownloadTimeout time.Duration
+
+	// DownloadDir is the directory firmware files are staged in, the default temp directory is used when not set.
+	DownloadDir string
+
+	// BucketCredentials are used to download firmware from object storage URLs, the cloud provider defaults apply when not set.
+	BucketCredentials *download.BucketCredentials
+
+	// UploadLimiter limits the concurrent out-of-band firmware uploads, this is nil when uploads are not limited.
+	UploadLimiter *outofband.UploadLimiter
+
+	// ActionConcurrency is the number of independent out-of-band actions of the task run concurrently,
+	// actions are run one after another when this is 0 or 1.
+	ActionConcurrency int
+
+	// InstallRules are the configured firmware install ordering and dependency rules.
+	InstallRules []*model.InstallRules
 }
 
 type ActionHandler interface {
@@ -69,13 +116,23 @@ type ActionHandlerContext struct {
 	Firmware *rctypes.Firmware
 }
 
-func New(logger *logrus.Entry) *Runner {
-	return &Runner{
+func New(logger *logrus.Entry, options ...Option) *Runner {
+	r := &Runner{
 		logger: logger,
 	}
+
+	for _, opt := range options {
+		opt(r)
+	}
+
+	return r
 }
 
 func (r *Runner) RunTask(ctx context.Context, task *model.FirmwareTask, handler TaskHandler) error {
+	if r.auditLog != nil {
+		handler = newAuditHandler(task, handler, r.auditLog, r.logger)
+	}
+
 	// nolint:govet // struct field optimization not required
 	funcs := []struct {
 		name   string
@@ -145,6 +202,17 @@ func (r *Runner) RunTask(ctx context.Context, task *model.FirmwareTask, handler
 	r.logger.WithField("planned.actions", len(task.Data.ActionsPlanned)).Debug("start running planned actions")
 
 	if err := r.runActions(ctx, task, handler); err != nil {
+		// the task remains active until its resumed after the host power cycle,
+		// the status is published here since the host reboot is handed off once the runner returns.
+		if errors.Is(err, model.ErrHostPowerCycleRequired) {
+			task.Status.Append("task paused for host power cycle")
+			handler.Publish(ctx)
+
+			handler.OnPause(ctx, task)
+
+			return err
+		}
+
 		return taskFailed(err)
 	}
 
@@ -154,77 +222,287 @@ func (r *Runner) RunTask(ctx context.Context, task *model.FirmwareTask, handler
 }
 
 func (r *Runner) runActions(ctx context.Context, task *model.FirmwareTask, handler TaskHandler) error {
-	registerMetric := func(startTS time.Time, action *model.Action, state rctypes.State) {
-		registerActionMetric(startTS, action, string(state))
+	if task.Data.ActionConcurrency > 1 {
+		return r.runActionsConcurrently(ctx, task, handler, task.Data.ActionConcurrency)
 	}
 
-	finalize := func(state rctypes.State, startTS time.Time, action *model.Action, err error) error {
-		action.SetState(state)
-		handler.Publish(ctx)
-		registerMetric(startTS, action, state)
+	// each action corresponds to a firmware to be installed
+	for _, action := range task.Data.ActionsPlanned {
+		runNext, err := r.runAction(ctx, task, action, handler)
+		if err != nil {
+			return err
+		}
 
-		return err
+		if !runNext {
+			return nil
+		}
 	}
 
-	// each action corresponds to a firmware to be installed
-	for _, action := range task.Data.ActionsPlanned {
-		startTS := time.Now()
+	return nil
+}
 
-		// return on context cancellation
-		if ctx.Err() != nil {
-			return finalize(rctypes.Failed, startTS, action, ctx.Err())
+// runActionsConcurrently runs the planned actions once the actions they depend on are completed,
+// upto limit actions are run concurrently.
+//
+// When an action fails no more actions are started and the actions running are left to complete - an action could be mid-flash.
+// When an action indicates no further actions are required, the actions planned after it are not started,
+// as when the actions are run one after another, the actions planned before it are still run.
+func (r *Runner) runActionsConcurrently(ctx context.Context, task *model.FirmwareTask, handler TaskHandler, limit int) error {
+	type result struct {
+		action  *model.Action
+		runNext bool
+		err     error
+	}
+
+	results := make(chan result)
+	completed := map[string]bool{}
+	started := map[string]bool{}
+
+	var running int
+	var stop bool
+	var firstErr error
+
+	// rollback actions appended to the task while actions are running are run by the action they roll back
+	var actions model.Actions
+	task.WithLock(func() {
+		actions = task.Data.ActionsPlanned
+	})
+
+	// the actions planned from this index are not started, once an action indicates no further actions are required
+	stopAt := len(actions)
+	index := make(map[string]int, len(actions))
+	for idx, action := range actions {
+		index[action.ID] = idx
+	}
+
+	dependenciesCompleted := func(action *model.Action) bool {
+		for _, id := range action.DependsOn {
+			if !completed[id] {
+				return false
+			}
 		}
 
-		actionLogger := r.logger.WithFields(logrus.Fields{
-			"action":    action.ID,
-			"component": action.Firmware.Component,
-			"fwversion": action.Firmware.Version,
-		})
+		return true
+	}
 
-		resumeAction, err := r.resumeAction(ctx, action, handler)
-		if err != nil {
-			return finalize(rctypes.Failed, startTS, action, err)
+	run := func(action *model.Action) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				r.logger.Printf("!!panic %s: %s", rec, debug.Stack())
+				results <- result{action: action, err: errors.New("Action fatal error, check logs for details")}
+			}
+		}()
+
+		runNext, err := r.runAction(ctx, task, action, handler)
+		results <- result{action: action, runNext: runNext, err: err}
+	}
+
+	for {
+		for idx, action := range actions {
+			if stop || running >= limit || idx >= stopAt {
+				break
+			}
+
+			if started[action.ID] || !dependenciesCompleted(action) {
+				continue
+			}
+
+			started[action.ID] = true
+			running++
+
+			go run(action)
 		}
 
-		if !resumeAction {
-			continue
+		if running == 0 {
+			break
 		}
 
-		// fetch action attributes from task
-		action.SetState(model.StateActive)
-		handler.Publish(ctx)
+		res := <-results
+		running--
 
-		// return
-		runNext, err := r.runActionSteps(ctx, task, action, handler, actionLogger)
-		if err != nil {
-			if errors.Is(err, model.ErrHostPowerCycleRequired) {
-				actionLogger.Info("host powercycle required to proceed, exiting")
-				os.Exit(0)
+		switch {
+		case res.err != nil:
+			if firstErr == nil {
+				firstErr = res.err
 			}
 
-			return finalize(rctypes.Failed, startTS, action, err)
+			stop = true
+		case !res.runNext:
+			// the actions planned after this action are not started
+			completed[res.action.ID] = true
+			stopAt = min(stopAt, index[res.action.ID]+1)
+		default:
+			completed[res.action.ID] = true
 		}
+	}
 
-		if !runNext {
-			info := "no further actions required"
-			actionLogger.Info(info)
-			task.Status.Append(info)
+	if firstErr != nil {
+		return firstErr
+	}
 
-			return finalize(rctypes.Succeeded, startTS, action, nil)
+	var notStarted []string
+	for _, action := range actions[:stopAt] {
+		if !started[action.ID] {
+			notStarted = append(notStarted, action.ID)
 		}
+	}
 
-		// log and publish status
-		action.SetState(rctypes.Succeeded)
-		handler.Publish(ctx)
-		registerMetric(startTS, action, rctypes.Succeeded)
-		actionLogger.Info("action steps for component completed successfully")
+	if len(notStarted) > 0 {
+		return errors.Wrap(errActionDependency, "dependencies not completed for actions: "+strings.Join(notStarted, ", "))
 	}
 
 	return nil
 }
 
+// runAction runs the action steps, when a false is returned with no error, no further actions are to be run.
+func (r *Runner) runAction(ctx context.Context, task *model.FirmwareTask, action *model.Action, handler TaskHandler) (runNext bool, err error) {
+	startTS := time.Now()
+
+	finalize := func(state rctypes.State, err error) error {
+		task.WithLock(func() {
+			action.SetState(state)
+		})
+
+		handler.Publish(ctx)
+		registerActionMetric(startTS, action, string(state))
+
+		return err
+	}
+
+	// return on context cancellation
+	if ctx.Err() != nil {
+		return false, finalize(rctypes.Failed, context.Cause(ctx))
+	}
+
+	actionLogger := r.logger.WithFields(logrus.Fields{
+		"action":    action.ID,
+		"component": action.Firmware.Component,
+		"fwversion": action.Firmware.Version,
+	})
+
+	resumeAction, err := r.resumeAction(ctx, task, action, handler)
+	if err != nil {
+		return false, finalize(rctypes.Failed, err)
+	}
+
+	if !resumeAction {
+		return true, nil
+	}
+
+	// fetch action attributes from task
+	task.WithLock(func() {
+		action.SetState(model.StateActive)
+	})
+
+	handler.Publish(ctx)
+
+	// return
+	runNext, err = r.runActionSteps(ctx, task, action, handler, actionLogger)
+	if err != nil {
+		// the task is resumed once the host is power cycled
+		if errors.Is(err, model.ErrHostPowerCycleRequired) {
+			actionLogger.Info("host powercycle required to proceed")
+			return false, err
+		}
+
+		err = finalize(rctypes.Failed, err)
+		if rollbackRequired(action, err) {
+			return false, r.rollback(ctx, task, action, handler, err)
+		}
+
+		return false, err
+	}
+
+	if !runNext {
+		info := "no further actions required"
+		actionLogger.Info(info)
+		task.WithLock(func() {
+			task.Status.Append(info)
+		})
+
+		return false, finalize(rctypes.Succeeded, nil)
+	}
+
+	// log and publish status
+	actionLogger.Info("action steps for component completed successfully")
+
+	return true, finalize(rctypes.Succeeded, nil)
+}
+
+// rollbackRequired returns true when the action install verification failed and the firmware installed before the action was recorded,
+// rollback actions are not rolled back.
+func rollbackRequired(action *model.Action, err error) bool {
+	return action.Rollback != nil && action.RollbackOf == "" && errors.Is(err, model.ErrInstallVerification)
+}
+
+// rollback runs an action to reinstall the firmware installed before the failed action,
+// the rollback action is recorded in the task data alongside the failed action.
+//
+// The task fails either way, the returned error includes the install failure and the rollback outcome.
+func (r *Runner) rollback(ctx context.Context, task *model.FirmwareTask, failed *model.Action, handler TaskHandler, cause error) error {
+	le := r.logger.WithFields(logrus.Fields{
+		"action":           failed.ID,
+		"component":        failed.Firmware.Component,
+		"fwversion":        failed.Firmware.Version,
+		"rollback.version": failed.Rollback.Version,
+	})
+
+	notAttempted := func(err error) error {
+		le.WithError(err).Warn("firmware rollback not attempted")
+		task.WithLock(func() {
+			task.Status.Append(fmt.Sprintf("[%s] rollback not attempted: %s", failed.Firmware.Component, err.Error()))
+		})
+
+		handler.Publish(ctx)
+
+		return errors.Wrap(cause, "rollback not attempted: "+err.Error())
+	}
+
+	if ctx.Err() != nil {
+		return notAttempted(context.Cause(ctx))
+	}
+
+	action, err := handler.ComposeRollback(ctx, failed)
+	if err != nil {
+		return notAttempted(err)
+	}
+
+	task.WithLock(func() {
+		action.SetID(task.ID.String(), action.Firmware.Component, len(task.Data.ActionsPlanned))
+		action.SetState(model.StatePending)
+		action.RollbackOf = failed.ID
+		failed.Rollback.ActionID = action.ID
+		task.Data.ActionsPlanned = append(task.Data.ActionsPlanned, action)
+		task.Status.Append(
+			fmt.Sprintf(
+				"[%s] install verification failed, rolling back to version: %s",
+				failed.Firmware.Component,
+				failed.Rollback.Version,
+			),
+		)
+	})
+
+	handler.Publish(ctx)
+	le.WithField("rollback.action", action.ID).Warn("install verification failed, rolling back firmware")
+
+	if _, err := r.runAction(ctx, task, action, handler); err != nil {
+		le.WithError(err).Error("firmware rollback failed")
+
+		return errors.Wrap(cause, fmt.Sprintf("rollback to version %s failed: %s", failed.Rollback.Version, err.Error()))
+	}
+
+	task.WithLock(func() {
+		task.Status.Append(fmt.Sprintf("[%s] rolled back to version: %s", failed.Firmware.Component, failed.Rollback.Version))
+	})
+
+	handler.Publish(ctx)
+	le.Info("firmware rolled back")
+
+	return errors.Wrap(cause, "rolled back to version "+failed.Rollback.Version)
+}
+
 // resumeAction returns true when the action can be resumed, when a false is returned with no error, the action is to be skipped.
-func (r *Runner) resumeAction(ctx context.Context, action *model.Action, handler TaskHandler) (resume bool, err error) {
+func (r *Runner) resumeAction(ctx context.Context, task *model.FirmwareTask, action *model.Action, handler TaskHandler) (resume bool, err error) {
 	errResumeAction := errors.New("error in resuming action")
 
 	actionLogger := r.logger.WithFields(logrus.Fields{
@@ -249,7 +527,10 @@ func (r *Runner) resumeAction(ctx context.Context, action *model.Action, handler
 				logrus.Fields{"state": action.State, "attempts": action.Attempts},
 			).Warn(info)
 
-			action.SetState(model.StateFailed)
+			task.WithLock(func() {
+				action.SetState(model.StateFailed)
+			})
+
 			handler.Publish(ctx)
 
 			return false, errors.Wrap(errResumeAction, fmt.Sprintf("%s: %d", info, action.Attempts))
@@ -259,7 +540,10 @@ func (r *Runner) resumeAction(ctx context.Context, action *model.Action, handler
 			logrus.Fields{"state": action.State, "attempts": action.Attempts},
 		).Info("resuming active action..")
 
-		action.Attempts++
+		task.WithLock(func() {
+			action.Attempts++
+		})
+
 		return true, nil
 
 	case model.StateFailed:
@@ -276,30 +560,40 @@ func (r *Runner) runActionSteps(ctx context.Context, task *model.FirmwareTask, a
 	// helper func to log and publish step status
 	publish := func(state rctypes.State, action *model.Action, step *model.Step, logger *logrus.Entry) {
 		logger.WithField("step", step.Name).Debug("running step")
-		step.SetState(state)
 		method := string(model.RunOutofband)
 		if action.Firmware.InstallInband {
 			method = string(model.RunInband)
 		}
 
-		task.Status.Append(fmt.Sprintf(
+		status := fmt.Sprintf(
 			"[%s] install %s version: %s, state: %s, step %s",
 			action.Firmware.Component,
 			method,
 			action.Firmware.Version,
 			state,
 			step.Name,
-		))
+		)
+
+		task.WithLock(func() {
+			step.SetState(state)
+			action.StepStatus = status
+			task.Status.Append(status)
+		})
 
 		handler.Publish(ctx)
 	}
 
 	for _, step := range action.Steps {
+		// a canceled condition stops here, at the step boundary
 		if ctx.Err() != nil {
-			return false, ctx.Err()
+			return false, context.Cause(ctx)
 		}
 
-		resume, err := r.resumeStep(step, logger)
+		var resume bool
+		task.WithLock(func() {
+			resume, err = r.resumeStep(step, logger)
+		})
+
 		if err != nil {
 			publish(model.StateFailed, action, step, logger)
 			return false, err
@@ -322,18 +616,26 @@ func (r *Runner) runActionSteps(ctx context.Context, task *model.FirmwareTask, a
 		}
 
 		// run step
-		if err := step.Handler(ctx); err != nil {
+		stepStartTS := time.Now()
+		stepCtx, cancelStep := stepContext(ctx)
+		err = step.Handler(stepCtx)
+		cancelStep()
+
+		if err != nil {
 			// installed firmware equals expected
 			if errors.Is(err, model.ErrInstalledFirmwareEqual) {
-				task.Status.Append(
-					fmt.Sprintf(
-						"[%s] %s",
-						action.Firmware.Component,
-						"Installed and expected firmware are equal",
-					),
-				)
+				task.WithLock(func() {
+					task.Status.Append(
+						fmt.Sprintf(
+							"[%s] %s",
+							action.Firmware.Component,
+							"Installed and expected firmware are equal",
+						),
+					)
+				})
 
 				publish(model.StateSucceeded, action, step, logger)
+				registerStepMetric(stepStartTS, task, action, step, model.StateSucceeded)
 
 				// no further actions
 				return false, nil
@@ -345,6 +647,8 @@ func (r *Runner) runActionSteps(ctx context.Context, task *model.FirmwareTask, a
 			}
 
 			publish(model.StateFailed, action, step, logger)
+			registerStepMetric(stepStartTS, task, action, step, model.StateFailed)
+
 			return false, errors.Wrap(
 				err,
 				fmt.Sprintf(
@@ -357,11 +661,43 @@ func (r *Runner) runActionSteps(ctx context.Context, task *model.FirmwareTask, a
 
 		// publish step status
 		publish(model.StateSucceeded, action, step, logger)
+		registerStepMetric(stepStartTS, task, action, step, model.StateSucceeded)
 	}
 
 	return true, nil
 }
 
+// stepContext returns the context a step is run with.
+//
+// A cancel request for the condition must never interrupt a running step - which could be mid-flash,
+// the step context is not canceled on the ErrConditionCancelled cause and the runner stops at the next step boundary.
+// Other cancellations, like the handler timeout or the service shutting down are passed through.
+func stepContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	stepCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+
+	stop := context.AfterFunc(ctx, func() {
+		if !errors.Is(context.Cause(ctx), model.ErrConditionCancelled) {
+			cancel(context.Cause(ctx))
+		}
+	})
+
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancelDeadline context.CancelFunc
+		stepCtx, cancelDeadline = context.WithDeadline(stepCtx, deadline)
+
+		return stepCtx, func() {
+			stop()
+			cancelDeadline()
+			cancel(nil)
+		}
+	}
+
+	return stepCtx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
 // resumeStep returns true when the step can be resumed, when a false is returned with no error, the step is to be skipped.
 func (r *Runner) resumeStep(step *model.Step, logger *logrus.Entry) (resume bool, err error) {
 	errResumeStep := errors.New("error in resuming step")
@@ -441,6 +777,23 @@ func (r *Runner) conditionalFault(ctx context.Context, fname string, task *model
 	return nil
 }
 
+func registerStepMetric(startTS time.Time, task *model.FirmwareTask, action *model.Action, step *model.Step, state rctypes.State) {
+	var serverModel string
+	if task.Server != nil {
+		serverModel = task.Server.Model
+	}
+
+	metrics.StepRunTimeHistogram.With(
+		prometheus.Labels{
+			"step":      string(step.Name),
+			"vendor":    action.Firmware.Vendor,
+			"model":     serverModel,
+			"component": action.Firmware.Component,
+			"state":     string(state),
+		},
+	).Observe(time.Since(startTS).Seconds())
+}
+
 func registerActionMetric(startTS time.Time, action *model.Action, state string) {
 	metrics.ActionRuntimeSummary.With(
 		prometheus.Labels{
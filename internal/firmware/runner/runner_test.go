@@ -2,8 +2,14 @@ package runner
 
 import (
 	"context"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/metal-automata/agent/internal/audit"
+	"github.com/metal-automata/agent/internal/metrics"
 	"github.com/metal-automata/agent/internal/model"
 	rctypes "github.com/metal-automata/rivets/condition"
 	"github.com/pkg/errors"
@@ -109,6 +115,36 @@ func TestRunTask(t *testing.T) {
 			expectedState: model.StateFailed,
 			expectedError: errors.New("error while running step=step1 to install firmware on component=: Step failed"),
 		},
+		{
+			name: "Task paused for host power cycle",
+			task: &model.FirmwareTask{
+				State: model.StatePending,
+				Data: &model.FirmwareTaskData{
+					ActionsPlanned: []*model.Action{
+						{
+							ID:    "action1",
+							State: model.StatePending,
+							Steps: []*model.Step{
+								{
+									Name:    "step1",
+									State:   model.StatePending,
+									Handler: func(context.Context) error { return model.ErrHostPowerCycleRequired },
+								},
+							},
+						},
+					},
+				},
+			},
+			mockSetup: func(m *MockTaskHandler) {
+				m.On("Initialize", mock.Anything).Return(nil)
+				m.On("Query", mock.Anything).Return(nil)
+				m.On("PlanActions", mock.Anything).Return(nil)
+				m.On("Publish", mock.Anything).Return(nil)
+				m.On("OnPause", mock.Anything, mock.Anything).Once()
+			},
+			expectedState: model.StateActive,
+			expectedError: model.ErrHostPowerCycleRequired,
+		},
 	}
 
 	for _, tt := range tests {
@@ -284,7 +320,7 @@ func TestResumeAction(t *testing.T) {
 			tt.mockSetup(mockHandler)
 
 			r := New(logrus.NewEntry(logrus.New()))
-			resume, err := r.resumeAction(context.Background(), tt.action, mockHandler)
+			resume, err := r.resumeAction(context.Background(), &model.FirmwareTask{Data: &model.FirmwareTaskData{}}, tt.action, mockHandler)
 
 			assert.Equal(t, tt.expectedResume, resume)
 			if tt.expectedError != nil {
@@ -426,6 +462,72 @@ func TestRunActionSteps(t *testing.T) {
 	}
 }
 
+func TestRunActionStepsCanceled(t *testing.T) {
+	tests := []struct {
+		name string
+		// the cause the context is canceled with while step1 runs
+		cause             error
+		expectStepCtxDone bool
+	}{
+		{
+			name:              "cancel request stops at the step boundary",
+			cause:             model.ErrConditionCancelled,
+			expectStepCtxDone: false,
+		},
+		{
+			name:              "other cancellations interrupt the step",
+			cause:             context.Canceled,
+			expectStepCtxDone: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+
+			var stepCtxDone, step2Ran bool
+			action := &model.Action{
+				Firmware: rctypes.Firmware{Component: "test", Version: "1.0"},
+				Steps: []*model.Step{
+					{
+						Name:  "step1",
+						State: model.StatePending,
+						Handler: func(stepCtx context.Context) error {
+							cancel(tt.cause)
+
+							select {
+							case <-stepCtx.Done():
+								stepCtxDone = true
+							case <-time.After(100 * time.Millisecond):
+							}
+
+							return nil
+						},
+					},
+					{
+						Name:    "step2",
+						State:   model.StatePending,
+						Handler: func(context.Context) error { step2Ran = true; return nil },
+					},
+				},
+			}
+
+			mockHandler := new(MockTaskHandler)
+			mockHandler.On("Publish", mock.Anything).Return(nil)
+
+			r := New(logrus.NewEntry(logrus.New()))
+			proceed, err := r.runActionSteps(ctx, &model.FirmwareTask{Data: &model.FirmwareTaskData{}}, action, mockHandler, r.logger)
+
+			assert.False(t, proceed)
+			assert.ErrorIs(t, err, tt.cause)
+			assert.Equal(t, tt.expectStepCtxDone, stepCtxDone)
+			assert.Equal(t, model.StateSucceeded, action.Steps[0].State)
+			assert.False(t, step2Ran)
+		})
+	}
+}
+
 func TestResumeStep(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -487,3 +589,425 @@ func TestResumeStep(t *testing.T) {
 		})
 	}
 }
+
+func TestRunActionStepsMetrics(t *testing.T) {
+	// stepCount returns the count of step duration observations for the labels
+	stepCount := func(labels map[string]string) uint64 {
+		families, err := metrics.Registry.Gather()
+		assert.Nil(t, err)
+
+		for _, family := range families {
+			if family.GetName() != "agent_install_step_duration_seconds" {
+				continue
+			}
+
+		Metrics:
+			for _, m := range family.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if labels[l.GetName()] != l.GetValue() {
+						continue Metrics
+					}
+				}
+
+				return m.GetHistogram().GetSampleCount()
+			}
+		}
+
+		return 0
+	}
+
+	task := &model.FirmwareTask{
+		Data:   &model.FirmwareTaskData{},
+		Server: &rctypes.Server{Model: "x11dph-t"},
+	}
+
+	action := &model.Action{
+		Firmware: rctypes.Firmware{Component: "metrics-test", Vendor: "supermicro", Version: "1.0"},
+		Steps: []*model.Step{
+			{
+				Name:    "step1",
+				State:   model.StatePending,
+				Handler: func(context.Context) error { return nil },
+			},
+			{
+				Name:    "step2",
+				State:   model.StatePending,
+				Handler: func(context.Context) error { return errors.New("step failed") },
+			},
+		},
+	}
+
+	mockHandler := new(MockTaskHandler)
+	mockHandler.On("Publish", mock.Anything).Return(nil)
+
+	r := New(logrus.NewEntry(logrus.New()))
+	_, err := r.runActionSteps(context.Background(), task, action, mockHandler, r.logger)
+	assert.NotNil(t, err)
+
+	labels := func(step string, state rctypes.State) map[string]string {
+		return map[string]string{
+			"step":      step,
+			"vendor":    "supermicro",
+			"model":     "x11dph-t",
+			"component": "metrics-test",
+			"state":     string(state),
+		}
+	}
+
+	assert.Equal(t, uint64(1), stepCount(labels("step1", model.StateSucceeded)))
+	assert.Equal(t, uint64(1), stepCount(labels("step2", model.StateFailed)))
+	assert.Equal(t, uint64(0), stepCount(labels("step2", model.StateSucceeded)))
+}
+
+func TestRunTaskAuditLog(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := audit.New(auditPath, 0, 0)
+	assert.Nil(t, err)
+
+	serverID := uuid.New()
+	task := &model.FirmwareTask{
+		ID:         uuid.New(),
+		Kind:       rctypes.FirmwareInstall,
+		State:      model.StatePending,
+		Parameters: &rctypes.FirmwareInstallTaskParameters{AssetID: serverID},
+		Data: &model.FirmwareTaskData{
+			ActionsPlanned: []*model.Action{
+				{
+					ID:        "action1",
+					BMCTaskID: "JID_001",
+					Firmware:  rctypes.Firmware{Component: "bios", Vendor: "dell", Version: "2.1"},
+					State:     model.StatePending,
+					Steps: []*model.Step{
+						{
+							Name:    "step1",
+							State:   model.StatePending,
+							Handler: func(context.Context) error { return nil },
+						},
+					},
+				},
+			},
+		},
+	}
+
+	mockHandler := new(MockTaskHandler)
+	mockHandler.On("Initialize", mock.Anything).Return(nil)
+	mockHandler.On("Query", mock.Anything).Return(nil)
+	mockHandler.On("PlanActions", mock.Anything).Return(nil)
+	mockHandler.On("Publish", mock.Anything).Return(nil)
+	mockHandler.On("OnSuccess", mock.Anything, mock.Anything).Once()
+
+	r := New(logrus.NewEntry(logrus.New()), WithAuditLog(auditLog))
+	assert.Nil(t, r.RunTask(context.Background(), task, mockHandler))
+	assert.Nil(t, auditLog.Close())
+
+	records, err := audit.Query(auditPath, audit.Filter{ServerID: serverID.String()})
+	assert.Nil(t, err)
+
+	// each transition is recorded once
+	got := make([]string, 0, len(records))
+	for _, record := range records {
+		assert.Equal(t, task.ID.String(), record.ConditionID)
+		got = append(got, string(record.Kind)+":"+record.Step+":"+record.State)
+	}
+
+	expected := []string{
+		"task::active",
+		"action::active",
+		"step:step1:active",
+		"step:step1:succeeded",
+		"action::succeeded",
+		"task::succeeded",
+	}
+	assert.Equal(t, expected, got)
+
+	assert.Equal(t, "bios", records[2].Component)
+	assert.Equal(t, "2.1", records[2].FirmwareVersion)
+	assert.Equal(t, "JID_001", records[2].BMCTaskID)
+}
+
+func TestRunActionsConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	var running, maxRunning int
+	events := []string{}
+
+	// step handler recording the action start, end events and the concurrently running actions
+	stepHandler := func(id string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			events = append(events, "start:"+id)
+			mu.Unlock()
+
+			if err == nil {
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			mu.Lock()
+			running--
+			events = append(events, "end:"+id)
+			mu.Unlock()
+
+			return err
+		}
+	}
+
+	newAction := func(id, component string, err error, dependsOn ...string) *model.Action {
+		return &model.Action{
+			ID:        id,
+			Firmware:  rctypes.Firmware{Component: component},
+			State:     model.StatePending,
+			DependsOn: dependsOn,
+			Steps: []*model.Step{
+				{Name: "step1", State: model.StatePending, Handler: stepHandler(id, err)},
+			},
+		}
+	}
+
+	indexOf := func(event string) int {
+		for idx, e := range events {
+			if e == event {
+				return idx
+			}
+		}
+
+		return -1
+	}
+
+	tests := []struct {
+		name           string
+		actions        model.Actions
+		expectedErr    string
+		expectedStates map[string]rctypes.State
+		expectedOrder  [][2]string
+		// the actions run concurrently are limited to the task action concurrency
+		expectedMaxRunning int
+	}{
+		{
+			name: "independent actions run concurrently",
+			actions: model.Actions{
+				newAction("bmc", "bmc", nil),
+				newAction("drive1", "drive", nil, "bmc"),
+				newAction("drive2", "drive", nil, "bmc"),
+				newAction("drive3", "drive", nil, "bmc"),
+				newAction("nic", "nic", nil, "bmc", "drive1", "drive2", "drive3"),
+			},
+			expectedStates: map[string]rctypes.State{
+				"bmc":    model.StateSucceeded,
+				"drive1": model.StateSucceeded,
+				"drive2": model.StateSucceeded,
+				"drive3": model.StateSucceeded,
+				"nic":    model.StateSucceeded,
+			},
+			expectedOrder: [][2]string{
+				{"end:bmc", "start:drive1"},
+				{"end:bmc", "start:drive2"},
+				{"end:drive1", "start:nic"},
+				{"end:drive3", "start:nic"},
+			},
+			expectedMaxRunning: 2,
+		},
+		{
+			name: "failed action stops new actions",
+			actions: model.Actions{
+				newAction("drive1", "drive", errors.New("install failed")),
+				newAction("drive2", "drive", nil),
+				newAction("drive3", "drive", nil),
+				newAction("nic", "nic", nil, "drive1", "drive2", "drive3"),
+			},
+			expectedErr: "install failed",
+			expectedStates: map[string]rctypes.State{
+				"drive1": model.StateFailed,
+				"drive2": model.StateSucceeded,
+				"drive3": model.StatePending,
+				"nic":    model.StatePending,
+			},
+		},
+		{
+			name: "no further actions stops the actions planned after",
+			actions: model.Actions{
+				newAction("drive1", "drive", model.ErrInstalledFirmwareEqual),
+				newAction("drive2", "drive", nil),
+				newAction("drive3", "drive", nil),
+			},
+			expectedStates: map[string]rctypes.State{
+				"drive1": model.StateSucceeded,
+				"drive2": model.StateSucceeded,
+				"drive3": model.StatePending,
+			},
+		},
+		{
+			name: "no further actions runs the actions planned before",
+			actions: model.Actions{
+				newAction("drive1", "drive", nil),
+				newAction("nic", "nic", nil, "drive1"),
+				newAction("drive2", "drive", model.ErrInstalledFirmwareEqual),
+			},
+			expectedStates: map[string]rctypes.State{
+				"drive1": model.StateSucceeded,
+				"nic":    model.StateSucceeded,
+				"drive2": model.StateSucceeded,
+			},
+			expectedOrder: [][2]string{
+				{"end:drive2", "start:nic"},
+			},
+		},
+		{
+			name: "no further actions with actions planned before not started",
+			actions: model.Actions{
+				newAction("drive1", "drive", nil),
+				newAction("nic", "nic", nil, "drive1", "cpld"),
+				newAction("drive2", "drive", model.ErrInstalledFirmwareEqual),
+			},
+			expectedErr: "dependencies not completed for actions: nic",
+			expectedStates: map[string]rctypes.State{
+				"drive1": model.StateSucceeded,
+				"nic":    model.StatePending,
+				"drive2": model.StateSucceeded,
+			},
+		},
+		{
+			name: "action dependency not planned",
+			actions: model.Actions{
+				newAction("drive1", "drive", nil),
+				newAction("nic", "nic", nil, "drive1", "cpld"),
+			},
+			expectedErr: "dependencies not completed for actions: nic",
+			expectedStates: map[string]rctypes.State{
+				"drive1": model.StateSucceeded,
+				"nic":    model.StatePending,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			running, maxRunning, events = 0, 0, []string{}
+
+			task := &model.FirmwareTask{
+				Data: &model.FirmwareTaskData{ActionsPlanned: tt.actions, ActionConcurrency: 2},
+			}
+
+			mockHandler := new(MockTaskHandler)
+			mockHandler.On("Publish", mock.Anything).Return(nil)
+
+			r := New(logrus.NewEntry(logrus.New()))
+			err := r.runActions(context.Background(), task, mockHandler)
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+			} else {
+				assert.Nil(t, err)
+			}
+
+			if tt.expectedMaxRunning > 0 {
+				assert.Equal(t, tt.expectedMaxRunning, maxRunning)
+			}
+
+			for _, action := range tt.actions {
+				assert.Equal(t, tt.expectedStates[action.ID], action.State, action.ID)
+			}
+
+			for _, order := range tt.expectedOrder {
+				assert.Less(t, indexOf(order[0]), indexOf(order[1]), order)
+			}
+		})
+	}
+}
+
+func TestRunActionRollback(t *testing.T) {
+	newAction := func(id string, err error) *model.Action {
+		return &model.Action{
+			ID:       id,
+			Firmware: rctypes.Firmware{Component: "bmc", Version: "2.0"},
+			State:    model.StatePending,
+			Steps: []*model.Step{
+				{Name: "step1", State: model.StatePending, Handler: func(context.Context) error { return err }},
+			},
+		}
+	}
+
+	errVerify := errors.Wrap(model.ErrInstallVerification, "BMC failed to install expected firmware")
+
+	tests := []struct {
+		name               string
+		installErr         error
+		rollbackErr        error
+		composeErr         error
+		expectedErr        string
+		expectedRollback   bool
+		expectedRollbackOK bool
+	}{
+		{
+			name:               "verification failure rolled back",
+			installErr:         errVerify,
+			expectedErr:        "rolled back to version 1.0",
+			expectedRollback:   true,
+			expectedRollbackOK: true,
+		},
+		{
+			name:             "rollback action fails",
+			installErr:       errVerify,
+			rollbackErr:      errors.New("upload failed"),
+			expectedErr:      "rollback to version 1.0 failed",
+			expectedRollback: true,
+		},
+		{
+			name:        "rollback action not composed",
+			installErr:  errVerify,
+			composeErr:  errors.New("no firmware recorded for the previously installed version"),
+			expectedErr: "rollback not attempted: no firmware recorded for the previously installed version",
+		},
+		{
+			name:        "install failure not rolled back",
+			installErr:  errors.New("install failed"),
+			expectedErr: "install failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := newAction("action1", tt.installErr)
+			action.Rollback = &model.Rollback{
+				Version:  "1.0",
+				Firmware: &rctypes.Firmware{Component: "bmc", Version: "1.0"},
+			}
+
+			task := &model.FirmwareTask{
+				ID:     uuid.New(),
+				Status: rctypes.NewTaskStatusRecord("initialized task"),
+				Data:   &model.FirmwareTaskData{ActionsPlanned: model.Actions{action}},
+			}
+
+			rollbackAction := newAction("", tt.rollbackErr)
+			rollbackAction.Firmware.Version = "1.0"
+
+			mockHandler := new(MockTaskHandler)
+			mockHandler.On("Publish", mock.Anything).Return(nil)
+			mockHandler.On("ComposeRollback", mock.Anything, action).Return(rollbackAction, tt.composeErr)
+
+			r := New(logrus.NewEntry(logrus.New()))
+			err := r.runActions(context.Background(), task, mockHandler)
+
+			assert.ErrorContains(t, err, tt.expectedErr)
+			assert.Equal(t, model.StateFailed, action.State)
+
+			if !tt.expectedRollback {
+				assert.Len(t, task.Data.ActionsPlanned, 1)
+				assert.Empty(t, action.Rollback.ActionID)
+
+				return
+			}
+
+			assert.ErrorIs(t, err, model.ErrInstallVerification)
+			assert.Len(t, task.Data.ActionsPlanned, 2)
+			assert.Equal(t, rollbackAction.ID, action.Rollback.ActionID)
+			assert.Equal(t, action.ID, rollbackAction.RollbackOf)
+
+			if tt.expectedRollbackOK {
+				assert.Equal(t, model.StateSucceeded, rollbackAction.State)
+			} else {
+				assert.Equal(t, model.StateFailed, rollbackAction.State)
+			}
+		})
+	}
+}
@@ -3,11 +3,13 @@ package firmware
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 
 	"github.com/bmc-toolbox/common"
 	"github.com/metal-automata/agent/internal/device"
+	"github.com/metal-automata/agent/internal/firmware/fwversion"
 	"github.com/metal-automata/agent/internal/firmware/runner"
 	"github.com/metal-automata/agent/internal/model"
 	"github.com/metal-automata/agent/internal/store"
@@ -30,6 +32,8 @@ var (
 	ErrTaskTypeAssertion  = errors.New("error asserting Task type")
 	errTaskQueryInventory = errors.New("error in task query inventory for installed firmware")
 	errTaskPlanActions    = errors.New("error in task action planning")
+	errInstallRequirement = errors.New("firmware install requirements not met")
+	errRollback           = errors.New("firmware rollback error")
 )
 
 // taskHandler implements the task.taskHandler interface to install firmware
@@ -38,6 +42,8 @@ var (
 type taskHandler struct {
 	mode    model.RunMode
 	resumed bool
+	// setInstallRules are the install rules listed for the firmware set the task installs
+	setInstallRules *model.InstallRules
 	*runner.TaskHandlerContext
 }
 
@@ -47,7 +53,7 @@ func newTaskHandler(
 	storage store.Repository,
 	publisher runner.Publisher,
 	logger *logrus.Entry,
-) runner.TaskHandler {
+) *taskHandler {
 	return &taskHandler{
 		mode:    mode,
 		resumed: task.State == model.StateActive,
@@ -66,16 +72,38 @@ func (t *taskHandler) Initialize(_ context.Context) error {
 		case model.RunInband:
 			t.DeviceQueryor = devinb.NewDeviceQueryor(t.Logger)
 		case model.RunOutofband:
-			t.DeviceQueryor = devoob.NewDeviceQueryor(t.Task.Server, t.Logger)
+			t.DeviceQueryor = devoob.NewDeviceQueryor(
+				t.Task.Server,
+				t.Logger,
+				devoob.WithUploadLimiter(t.UploadLimiter, t.uploadWaiting),
+			)
 		}
 	}
 
 	return nil
 }
 
+// uploadWaiting publishes the task status when the firmware upload is waiting for an upload slot.
+func (t *taskHandler) uploadWaiting(ctx context.Context) {
+	t.Task.WithLock(func() {
+		t.Task.Status.Append("waiting for upload slot")
+	})
+
+	t.Publish(ctx)
+}
+
 func (t *taskHandler) Query(ctx context.Context) error {
 	t.Logger.Debug("run query step")
 
+	// A resumed out-of-band task may have a firmware install in progress on the BMC,
+	// skip collecting inventory when the component inventory was already collected by the previous run.
+	if t.mode == model.RunOutofband && t.resumed &&
+		len(t.Task.Data.ActionsPlanned) > 0 && len(t.Task.Server.Components) > 0 {
+		t.Logger.Debug("resumed task, skipped inventory query")
+
+		return nil
+	}
+
 	var err error
 	var deviceCommon *common.Device
 	switch t.mode {
@@ -153,6 +181,12 @@ func (t *taskHandler) PlanActions(ctx context.Context) error {
 		return t.planResumedTask()
 	}
 
+	// out-of-band actions independent of each other may be run concurrently,
+	// the limit is retained in the task data for when the task is resumed.
+	if t.mode == model.RunOutofband {
+		t.Task.Data.ActionConcurrency = t.ActionConcurrency
+	}
+
 	switch t.Task.Data.FirmwarePlanMethod {
 	case model.FromFirmwareSet:
 		return t.planFromFirmwareSet(ctx)
@@ -197,6 +231,17 @@ func (t *taskHandler) planFromFirmwareSet(ctx context.Context) error {
 		return errors.Wrap(errTaskPlanActions, "planFromFirmwareSet(): firmware set lacks any members")
 	}
 
+	rules, err := t.Store.FirmwareSetInstallRules(ctx, t.Task.Parameters.FirmwareSetID)
+	if err != nil {
+		return errors.Wrap(errTaskPlanActions, err.Error())
+	}
+
+	if err := rules.Validate(); err != nil {
+		return errors.Wrap(errTaskPlanActions, "firmware set: "+err.Error())
+	}
+
+	t.setInstallRules = rules
+
 	actions, err := t.planInstallActions(ctx, applicable)
 	if err != nil {
 		return err
@@ -208,10 +253,6 @@ func (t *taskHandler) planFromFirmwareSet(ctx context.Context) error {
 }
 
 func (t *taskHandler) planResumedTask() error {
-	if t.mode == model.RunOutofband {
-		return errors.Wrap(errTaskPlanActions, "resume task not (yet) supported on out-of-band firmware installs")
-	}
-
 	for _, action := range t.Task.Data.ActionsPlanned {
 		if rctypes.StateIsComplete(action.State) {
 			continue
@@ -224,7 +265,15 @@ func (t *taskHandler) planResumedTask() error {
 			Last:               action.Last,
 		}
 
-		if err := ahinb.AssignStepHandlers(action, actionCtx); err != nil {
+		var err error
+		switch t.mode {
+		case model.RunOutofband:
+			err = ahoob.AssignStepHandlers(action, actionCtx)
+		case model.RunInband:
+			err = ahinb.AssignStepHandlers(action, actionCtx)
+		}
+
+		if err != nil {
 			return errors.Wrap(errTaskPlanActions, "failed to assign action step taskHandler: "+err.Error())
 		}
 	}
@@ -267,7 +316,13 @@ func (t *taskHandler) planInstallActions(ctx context.Context, firmwares []*rctyp
 	}
 
 	// sort firmware in order of install
-	t.sortFirmwareByInstallOrder(toInstall)
+	rules := t.installRules()
+	t.sortFirmwareByInstallOrder(toInstall, rules)
+
+	// reject plans that would install firmware before the firmware it requires
+	if err := t.checkInstallRequirements(toInstall, rules); err != nil {
+		return nil, errors.Wrap(errTaskPlanActions, err.Error())
+	}
 
 	actions := model.Actions{}
 	// each firmware applicable results in an ActionPlan and an Action
@@ -304,9 +359,18 @@ func (t *taskHandler) planInstallActions(ctx context.Context, firmwares []*rctyp
 
 		action.SetID(t.Task.ID.String(), firmware.Component, idx)
 		action.SetState(model.StatePending)
+
+		if t.mode == model.RunOutofband && t.Task.Data != nil && t.Task.Data.RollbackOnFailure {
+			action.Rollback = t.planRollback(ctx, firmware)
+		}
+
 		actions = append(actions, action)
 	}
 
+	if t.mode == model.RunOutofband {
+		planActionDependencies(actions, rules)
+	}
+
 	var info string
 	if len(actions) > 0 {
 		info = fmt.Sprintf("planned firmware installs, method: %s, count: %d", t.mode, len(actions))
@@ -321,32 +385,242 @@ func (t *taskHandler) planInstallActions(ctx context.Context, firmwares []*rctyp
 	return actions, nil
 }
 
-func (t *taskHandler) sortFirmwareByInstallOrder(firmwares []*rctypes.Firmware) {
-	sort.Slice(firmwares, func(i, j int) bool {
-		slugi := strings.ToLower(firmwares[i].Component)
-		slugj := strings.ToLower(firmwares[j].Component)
-		return model.FirmwareInstallOrder[slugi] < model.FirmwareInstallOrder[slugj]
+// planRollback returns the firmware installed on the components the firmware is to be installed on,
+// along with the firmware artifact for the installed version from the store.
+//
+// Nil is returned when the installed version is not known or differs between the components,
+// since a single reinstall cannot restore the components.
+func (t *taskHandler) planRollback(ctx context.Context, fw *rctypes.Firmware) *model.Rollback {
+	le := t.Logger.WithFields(logrus.Fields{
+		"component": fw.Component,
+		"vendor":    fw.Vendor,
+		"models":    fw.Models,
+	})
+
+	var version string
+	for _, component := range model.FindFirmwareComponents(t.Task.Server, fw) {
+		var installed string
+		if component.InstalledFirmware != nil {
+			installed = component.InstalledFirmware.Version
+		}
+
+		var cause string
+		switch {
+		case installed == "":
+			cause = "installed firmware version unknown, rollback not available"
+		case version != "" && !fwversion.Equal(fw.Vendor, fw.Component, version, installed):
+			cause = "installed firmware versions differ, rollback not available"
+		}
+
+		if cause != "" {
+			le.Warn(cause)
+			t.Task.Status.Append(fmt.Sprintf("[%s] %s", fw.Component, cause))
+
+			return nil
+		}
+
+		version = installed
+	}
+
+	if version == "" {
+		return nil
+	}
+
+	rollback := &model.Rollback{Version: version}
+
+	previous, err := t.Store.FirmwareByComponentVersion(ctx, fw.Vendor, fw.Component, version, fw.Models)
+	if err != nil {
+		le.WithError(err).WithField("installed.version", version).Warn("firmware for installed version not found, rollback not available")
+		t.Task.Status.Append(fmt.Sprintf("[%s] firmware for installed version %s not found, rollback not available", fw.Component, version))
+
+		return rollback
+	}
+
+	rollback.Firmware = previous
+	le.WithField("installed.version", version).Debug("firmware for installed version recorded for rollback")
+
+	return rollback
+}
+
+// ComposeRollback returns an out-of-band action to reinstall the firmware recorded for rollback in the failed action,
+// the rollback action is the last action when the failed action was the last action.
+func (t *taskHandler) ComposeRollback(ctx context.Context, failed *model.Action) (*model.Action, error) {
+	if t.mode != model.RunOutofband {
+		return nil, errors.Wrap(errRollback, "rollback not supported for install method: "+string(t.mode))
+	}
+
+	if failed.Rollback == nil || failed.Rollback.Firmware == nil {
+		return nil, errors.Wrap(errRollback, "no firmware recorded for the previously installed version")
+	}
+
+	// limit the reinstall to the component models the failed action installed on
+	firmware := *failed.Rollback.Firmware
+	if len(failed.Firmware.Models) > 0 {
+		firmware.Models = failed.Firmware.Models
+	}
+
+	actionCtx := &runner.ActionHandlerContext{
+		TaskHandlerContext: t.TaskHandlerContext,
+		Firmware:           &firmware,
+		Last:               failed.Last,
+	}
+
+	action, err := (&ahoob.ActionHandler{}).ComposeAction(ctx, actionCtx)
+	if err != nil {
+		return nil, errors.Wrap(errRollback, err.Error())
+	}
+
+	return action, nil
+}
+
+// planActionDependencies sets the actions each action depends on, the actions are expected in the order of install.
+//
+// An action depends on the actions installing components earlier in the install order,
+// actions for components of the same install order are independent unless either action is exclusive.
+func planActionDependencies(actions model.Actions, rules *model.InstallRules) {
+	for idx, action := range actions {
+		action.DependsOn = nil
+
+		for _, prev := range actions[:idx] {
+			if actionExclusive(prev, rules) || actionExclusive(action, rules) ||
+				rules.Rank(prev.Firmware.Component) < rules.Rank(action.Firmware.Component) {
+				action.DependsOn = append(action.DependsOn, prev.ID)
+			}
+		}
+	}
+}
+
+// actionExclusive returns true for an action that is not to be run alongside other actions.
+//
+// BMC, BIOS and CPLD installs along with installs that reset the BMC or require the host powered off
+// interrupt other installs, a BMC reset also re-initializes the BMC client shared by the task actions.
+// The first action powers on the host and the last action powers it off,
+// components missing from the install rules and default install order are not known to be independent.
+func actionExclusive(action *model.Action, rules *model.InstallRules) bool {
+	switch strings.ToLower(action.Firmware.Component) {
+	case strings.ToLower(common.SlugBMC), strings.ToLower(common.SlugBIOS), strings.ToLower(common.SlugCPLD):
+		return true
+	}
+
+	if !rules.Ordered(action.Firmware.Component) {
+		return true
+	}
+
+	return action.First || action.Last ||
+		action.BMCResetPreInstall || action.BMCResetPostInstall || action.BMCResetOnInstallFailure ||
+		action.HostPowerOffPreInstall
+}
+
+// installRules returns the configured and firmware set install rules applicable to the task server.
+func (t *taskHandler) installRules() *model.InstallRules {
+	var vendor, serverModel string
+	if t.Task.Server != nil {
+		vendor, serverModel = t.Task.Server.Vendor, t.Task.Server.Model
+	}
+
+	// the firmware set rules are merged last and so its install order takes precedence
+	rules := append(slices.Clone(t.InstallRules), t.setInstallRules)
+
+	return model.MergeInstallRules(vendor, serverModel, rules...)
+}
+
+func (t *taskHandler) sortFirmwareByInstallOrder(firmwares []*rctypes.Firmware, rules *model.InstallRules) {
+	sort.SliceStable(firmwares, func(i, j int) bool {
+		return rules.Rank(firmwares[i].Component) < rules.Rank(firmwares[j].Component)
 	})
 }
 
-// returns a list of firmware applicable and a list of causes for firmwares that were removed from the install list.
-func (t *taskHandler) removeFirmwareAlreadyAtDesiredVersion(fws []*rctypes.Firmware) []*rctypes.Firmware {
-	var toInstall []*rctypes.Firmware
+// checkInstallRequirements returns an error listing the install requirements not met by the firmware to be installed,
+// the firmware is expected in the order of install.
+func (t *taskHandler) checkInstallRequirements(firmwares []*rctypes.Firmware, rules *model.InstallRules) error {
+	var unmet []string
+
+	for _, fw := range firmwares {
+		for _, req := range rules.RequirementsFor(fw.Component) {
+			cause := t.installRequirementUnmet(fw, req, firmwares, rules)
+			if cause == "" {
+				continue
+			}
+
+			info := fmt.Sprintf(
+				"[%s] firmware %s requires %s version >= %s: %s",
+				fw.Component,
+				fw.Version,
+				req.RequiredComponent,
+				req.MinVersion,
+				cause,
+			)
+
+			t.Logger.Warn(info)
+			unmet = append(unmet, info)
+		}
+	}
+
+	if len(unmet) == 0 {
+		return nil
+	}
 
-	// TODO: The current invMap key is set to the component name,
-	// This means if theres multiple Drives of different vendors only the last one in the
-	// component list will be included. Consider a different approach where the key consists
-	// of the name, model.
-	//
-	//	key := func(cmpName, cmpModel string) string {
-	//		return fmt.Sprintf("%s.%s", strings.ToLower(cmpName), strings.ToLower(cmpModel))
-	//	}
+	return errors.Wrap(errInstallRequirement, strings.Join(unmet, "; "))
+}
+
+// installRequirementUnmet returns the cause when the firmware install requirement is not met,
+// the requirement is met by the required component firmware planned to be installed before it or the firmware installed.
+func (t *taskHandler) installRequirementUnmet(fw *rctypes.Firmware, req *model.InstallRequirement, planned []*rctypes.Firmware, rules *model.InstallRules) string {
+	required := strings.ToLower(req.RequiredComponent)
+
+	for _, p := range planned {
+		if !strings.EqualFold(p.Component, required) {
+			continue
+		}
+
+		if rules.Rank(p.Component) >= rules.Rank(fw.Component) {
+			return fmt.Sprintf("%s install is ordered after %s", required, fw.Component)
+		}
 
-	invMap := make(map[string]string)
-	for _, cmp := range t.Task.Server.Components {
-		invMap[strings.ToLower(cmp.Name)] = cmp.InstalledFirmware.Version
+		if versionBelow(p.Vendor, required, p.Version, req.MinVersion) {
+			return fmt.Sprintf("planned %s version %s", required, p.Version)
+		}
+
+		return ""
+	}
+
+	components := model.FindFirmwareComponents(t.Task.Server, &rctypes.Firmware{Component: required})
+	if len(components) == 0 {
+		return fmt.Sprintf("%s not found in inventory", required)
 	}
 
+	for _, component := range components {
+		var installed string
+		if component.InstalledFirmware != nil {
+			installed = component.InstalledFirmware.Version
+		}
+
+		if installed == "" || versionBelow(t.Task.Server.Vendor, required, installed, req.MinVersion) {
+			return fmt.Sprintf("installed %s version %q, no %s install planned", required, installed, required)
+		}
+	}
+
+	return ""
+}
+
+// versionBelow returns true when the version is older than the minimum version or the versions cannot be ordered.
+func versionBelow(vendor, component, version, minVersion string) bool {
+	result, err := fwversion.Compare(vendor, component, version, minVersion)
+	if err != nil {
+		return true
+	}
+
+	return result.Order < 0
+}
+
+// removeFirmwareAlreadyAtDesiredVersion returns the firmware to be installed, the causes for the install decisions
+// are listed in the task status for each component instance.
+//
+// Components of the firmware slug are grouped by model, each group with components to be updated
+// results in a firmware install limited to the group model.
+func (t *taskHandler) removeFirmwareAlreadyAtDesiredVersion(fws []*rctypes.Firmware) []*rctypes.Firmware {
+	var toInstall []*rctypes.Firmware
+
 	fmtCause := func(component, cause, currentV, requestedV string) string {
 		if currentV != "" && requestedV != "" {
 			return fmt.Sprintf("[%s] %s, current=%s, requested=%s", component, cause, currentV, requestedV)
@@ -360,64 +634,181 @@ func (t *taskHandler) removeFirmwareAlreadyAtDesiredVersion(fws []*rctypes.Firmw
 	// desire of users to not require a force or a re-run to accomplish an
 	// attainable goal.
 	for _, fw := range fws {
-		currentVersion, ok := invMap[strings.ToLower(fw.Component)]
-
-		// skip install if current firmware version was not identified
-		if currentVersion == "" && !t.Task.Parameters.ForceInstall {
-			info := "Current firmware version returned empty, skipped install, use force to override"
-			t.Task.Status.Append(
-				fmtCause(
-					fw.Component,
-					info,
-					currentVersion,
-					fw.Version,
-				),
-			)
-
+		components := model.FindFirmwareComponents(t.Task.Server, fw)
+		if len(components) == 0 {
+			cause := "component not found in inventory"
 			t.Logger.WithFields(logrus.Fields{
 				"component": fw.Component,
-			}).Warn()
+				"models":    fw.Models,
+			}).Warn(cause)
+
+			t.Task.Status.Append(fmtCause(fw.Component, cause, "", ""))
 
 			continue
 		}
 
-		switch {
-		case !ok:
-			cause := "component not found in inventory"
-			t.Logger.WithFields(logrus.Fields{
-				"component": fw.Component,
-			}).Warn(cause)
+		groups := groupComponentsByModel(components)
+		for _, group := range groups {
+			var install bool
 
-			t.Task.Status.Append(fmtCause(fw.Component, cause, "", ""))
+			for _, component := range group.components {
+				label := fw.Component
+				if len(components) > 1 {
+					label = fmt.Sprintf("%s model=%s serial=%s", fw.Component, component.Model, component.Serial)
+				}
 
-		case strings.EqualFold(currentVersion, fw.Version):
-			cause := "component firmware version equal"
-			t.Logger.WithFields(logrus.Fields{
-				"component": fw.Component,
-				"version":   fw.Version,
-			}).Debug(cause)
+				var currentVersion string
+				if component.InstalledFirmware != nil {
+					currentVersion = component.InstalledFirmware.Version
+				}
 
-			t.Task.Status.Append(fmtCause(fw.Component, cause, currentVersion, fw.Version))
+				// skip install if current firmware version was not identified
+				if currentVersion == "" {
+					info := "Current firmware version returned empty, skipped install, use force to override"
+					t.Task.Status.Append(fmtCause(label, info, currentVersion, fw.Version))
 
-		default:
-			t.Logger.WithFields(logrus.Fields{
-				"component":         fw.Component,
-				"installed.version": currentVersion,
-				"mandated.version":  fw.Version,
-			}).Debug("firmware queued for install")
+					t.Logger.WithFields(logrus.Fields{
+						"component": fw.Component,
+						"model":     component.Model,
+						"serial":    component.Serial,
+					}).Warn(info)
 
-			toInstall = append(toInstall, fw)
+					continue
+				}
 
-			t.Task.Status.Append(
-				fmtCause(fw.Component, "firmware queued for install", currentVersion, fw.Version),
-			)
+				componentInstall, cause := t.versionInstallDecision(fw, currentVersion)
+				install = install || componentInstall
+
+				t.Task.Status.Append(fmtCause(label, cause, currentVersion, fw.Version))
+			}
+
+			if !install {
+				continue
+			}
+
+			// limit the install to the group model, the action identifies the component to install on by the firmware models
+			if group.model != "" {
+				groupFw := *fw
+				groupFw.Models = []string{group.model}
+				toInstall = append(toInstall, &groupFw)
+
+				continue
+			}
+
+			toInstall = append(toInstall, fw)
 		}
 	}
 
 	return toInstall
 }
 
+// componentGroup is a group of components of the same model.
+type componentGroup struct {
+	model      string
+	components []*rctypes.Component
+}
+
+// groupComponentsByModel returns the components grouped by model, in the order the models are listed.
+func groupComponentsByModel(components []*rctypes.Component) []*componentGroup {
+	groups := []*componentGroup{}
+	byModel := map[string]*componentGroup{}
+
+	for _, component := range components {
+		key := strings.ToLower(strings.TrimSpace(component.Model))
+
+		group, exists := byModel[key]
+		if !exists {
+			group = &componentGroup{model: strings.TrimSpace(component.Model)}
+			byModel[key] = group
+			groups = append(groups, group)
+		}
+
+		group.components = append(group.components, component)
+	}
+
+	return groups
+}
+
+// versionInstallDecision compares the installed and requested firmware versions,
+// it returns true when the firmware is to be installed and the cause for the decision.
+//
+// Firmware older than the installed firmware is installed based on the task downgrade policy.
+func (t *taskHandler) versionInstallDecision(fw *rctypes.Firmware, currentVersion string) (install bool, cause string) {
+	le := t.Logger.WithFields(logrus.Fields{
+		"component":         fw.Component,
+		"vendor":            fw.Vendor,
+		"installed.version": currentVersion,
+		"mandated.version":  fw.Version,
+	})
+
+	policy := t.Task.Data.DowngradePolicyOrDefault()
+
+	// versions that cannot be ordered may be a downgrade
+	result, err := fwversion.Compare(fw.Vendor, fw.Component, currentVersion, fw.Version)
+	if err != nil {
+		if policy == model.DowngradeDeny {
+			le.WithError(err).WithField("downgrade.policy", policy).Info("firmware install skipped")
+
+			return false, "firmware version order unknown, skipped install, downgrade policy: " + string(policy)
+		}
+
+		le.WithError(err).Debug("firmware queued for install")
+
+		return true, "firmware version order unknown, queued for install"
+	}
+
+	le = le.WithField("version.scheme", result.Scheme)
+
+	switch {
+	case result.Order == 0:
+		le.Debug("component firmware version equal")
+
+		return false, "component firmware version equal"
+
+	case result.Order < 0:
+		le.Debug("firmware queued for install")
+
+		return true, "firmware upgrade queued for install"
+	}
+
+	le = le.WithField("downgrade.policy", policy)
+
+	switch policy {
+	case model.DowngradeDeny:
+		le.Info("firmware downgrade skipped")
+
+		return false, "firmware downgrade denied by downgrade policy, skipped install"
+
+	case model.DowngradeAllow:
+		le.Info("firmware downgrade queued for install")
+
+		return true, "firmware downgrade allowed by downgrade policy, queued for install"
+
+	default:
+		le.Warn("firmware downgrade queued for install")
+
+		return true, "firmware downgrade queued for install, downgrade policy: " + string(policy)
+	}
+}
+
 func (t *taskHandler) OnSuccess(ctx context.Context, _ *model.FirmwareTask) {
+	t.cleanup(ctx)
+}
+
+func (t *taskHandler) OnFailure(ctx context.Context, _ *model.FirmwareTask) {
+	t.cleanup(ctx)
+}
+
+// OnPause releases the task resources when the task is paused for a host power cycle,
+// the cached firmware files and device session are acquired again once the task is resumed.
+func (t *taskHandler) OnPause(ctx context.Context, _ *model.FirmwareTask) {
+	t.cleanup(ctx)
+}
+
+// cleanup releases the cached firmware files and closes the out of band device session.
+func (t *taskHandler) cleanup(ctx context.Context) {
+	t.releaseCachedFirmware()
+
 	if t.mode == model.RunInband || t.DeviceQueryor == nil {
 		return
 	}
@@ -427,13 +818,16 @@ func (t *taskHandler) OnSuccess(ctx context.Context, _ *model.FirmwareTask) {
 	}
 }
 
-func (t *taskHandler) OnFailure(ctx context.Context, _ *model.FirmwareTask) {
-	if t.mode == model.RunInband || t.DeviceQueryor == nil {
+// releaseCachedFirmware releases the cached firmware files referenced by the task actions.
+func (t *taskHandler) releaseCachedFirmware() {
+	if t.FirmwareCache == nil {
 		return
 	}
 
-	if err := t.DeviceQueryor.(device.OutofbandQueryor).Close(ctx); err != nil {
-		t.Logger.WithFields(logrus.Fields{"err": err.Error()}).Warn("device logout error")
+	for _, action := range t.Task.Data.ActionsPlanned {
+		if action.FirmwareTempFile != "" {
+			t.FirmwareCache.Release(action.FirmwareTempFile)
+		}
 	}
 }
 
@@ -2,13 +2,17 @@ package firmware
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/metal-automata/agent/internal/app"
 	"github.com/metal-automata/agent/internal/ctrl"
 	"github.com/metal-automata/agent/internal/device"
 	"github.com/metal-automata/agent/internal/firmware/runner"
 	"github.com/metal-automata/agent/internal/model"
+	"github.com/metal-automata/agent/internal/store"
 	"github.com/metal-automata/rivets/events/registry"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -76,7 +80,7 @@ func TestSortFirmwareByInstallOrder(t *testing.T) {
 	}
 
 	h := taskHandler{}
-	h.sortFirmwareByInstallOrder(have)
+	h.sortFirmwareByInstallOrder(have, nil)
 
 	assert.Equal(t, expected, have)
 }
@@ -151,6 +155,385 @@ func TestRemoveFirmwareAlreadyAtDesiredVersion(t *testing.T) {
 	require.Equal(t, expected[0], got[0])
 }
 
+func TestRemoveFirmwareDowngradePolicy(t *testing.T) {
+	t.Parallel()
+
+	fwSet := []*rctypes.Firmware{
+		{Vendor: "supermicro", Component: "bios", Version: "3.6"},
+		{Vendor: "supermicro", Component: "bmc", Version: "1.10.2"},
+		{Vendor: "supermicro", Component: "nic", Version: "1.2.0"},
+		{Vendor: "supermicro", Component: "cpld", Version: "rev-b"},
+	}
+
+	tests := []struct {
+		name                    string
+		policy                  model.DowngradePolicy
+		expected                []string
+		expectedStatus          string
+		expectedUnorderedStatus string
+	}{
+		{
+			name:                    "default policy warns",
+			expected:                []string{"bios", "nic", "cpld"},
+			expectedStatus:          "[nic] firmware downgrade queued for install, downgrade policy: warn, current=1.4.1, requested=1.2.0",
+			expectedUnorderedStatus: "[cpld] firmware version order unknown, queued for install, current=rev-a, requested=rev-b",
+		},
+		{
+			name:                    "allow",
+			policy:                  model.DowngradeAllow,
+			expected:                []string{"bios", "nic", "cpld"},
+			expectedStatus:          "[nic] firmware downgrade allowed by downgrade policy, queued for install, current=1.4.1, requested=1.2.0",
+			expectedUnorderedStatus: "[cpld] firmware version order unknown, queued for install, current=rev-a, requested=rev-b",
+		},
+		{
+			name:                    "deny",
+			policy:                  model.DowngradeDeny,
+			expected:                []string{"bios"},
+			expectedStatus:          "[nic] firmware downgrade denied by downgrade policy, skipped install, current=1.4.1, requested=1.2.0",
+			expectedUnorderedStatus: "[cpld] firmware version order unknown, skipped install, downgrade policy: deny, current=rev-a, requested=rev-b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := taskHandler{
+				mode: model.RunOutofband,
+				TaskHandlerContext: &runner.TaskHandlerContext{
+					Logger: logrus.NewEntry(logrus.New()),
+					Task: &model.FirmwareTask{
+						Server: &rctypes.Server{
+							Components: []*rctypes.Component{
+								{Name: "bios", InstalledFirmware: &rctypes.InstalledFirmware{Version: "3.5a"}},
+								{Name: "bmc", InstalledFirmware: &rctypes.InstalledFirmware{Version: "01.10.02"}},
+								{Name: "nic", InstalledFirmware: &rctypes.InstalledFirmware{Version: "1.4.1"}},
+								{Name: "cpld", InstalledFirmware: &rctypes.InstalledFirmware{Version: "rev-a"}},
+							},
+						},
+						Parameters: &rctypes.FirmwareInstallTaskParameters{},
+						Data:       &model.FirmwareTaskData{DowngradePolicy: tt.policy},
+					},
+				},
+			}
+
+			got := h.removeFirmwareAlreadyAtDesiredVersion(fwSet)
+
+			components := []string{}
+			for _, fw := range got {
+				components = append(components, fw.Component)
+			}
+
+			assert.Equal(t, tt.expected, components)
+
+			statusMsgs := []string{}
+			for _, msg := range h.Task.Status.StatusMsgs {
+				statusMsgs = append(statusMsgs, msg.Msg)
+			}
+
+			assert.Equal(t, []string{
+				"[bios] firmware upgrade queued for install, current=3.5a, requested=3.6",
+				"[bmc] component firmware version equal, current=01.10.02, requested=1.10.2",
+				tt.expectedStatus,
+				tt.expectedUnorderedStatus,
+			}, statusMsgs)
+		})
+	}
+}
+
+func TestRemoveFirmwareMixedComponentModels(t *testing.T) {
+	t.Parallel()
+
+	fwSet := []*rctypes.Firmware{
+		{Vendor: "dell", Component: "drive", Version: "1.2", Models: []string{"r6515"}},
+		{Vendor: "intel", Component: "nic", Version: "9.0", Models: []string{"x710"}},
+	}
+
+	h := taskHandler{
+		mode: model.RunOutofband,
+		TaskHandlerContext: &runner.TaskHandlerContext{
+			Logger: logrus.NewEntry(logrus.New()),
+			Task: &model.FirmwareTask{
+				Server: &rctypes.Server{
+					Vendor: "dell",
+					Model:  "PowerEdge R6515",
+					Components: []*rctypes.Component{
+						{Name: "drive", Vendor: "samsung", Model: "MZ7LH480HAHQ", Serial: "s1", InstalledFirmware: &rctypes.InstalledFirmware{Version: "1.0"}},
+						{Name: "drive", Vendor: "seagate", Model: "ST4000NM", Serial: "s2", InstalledFirmware: &rctypes.InstalledFirmware{Version: "1.2"}},
+						{Name: "drive", Vendor: "samsung", Model: "MZ7LH480HAHQ", Serial: "s3", InstalledFirmware: &rctypes.InstalledFirmware{Version: "1.2"}},
+						{Name: "nic", Vendor: "Mellanox", Model: "ConnectX-5", Serial: "n1", InstalledFirmware: &rctypes.InstalledFirmware{Version: "14.0"}},
+						{Name: "nic", Vendor: "Intel", Model: "Ethernet Controller X710", Serial: "n2", InstalledFirmware: &rctypes.InstalledFirmware{Version: "8.0"}},
+					},
+				},
+				Parameters: &rctypes.FirmwareInstallTaskParameters{},
+				Data:       &model.FirmwareTaskData{},
+			},
+		},
+	}
+
+	got := h.removeFirmwareAlreadyAtDesiredVersion(fwSet)
+
+	// the drive firmware install is limited to the drive model group to be updated
+	require.Len(t, got, 2)
+	assert.Equal(t, "drive", got[0].Component)
+	assert.Equal(t, []string{"MZ7LH480HAHQ"}, got[0].Models)
+	assert.Equal(t, []string{"r6515"}, fwSet[0].Models)
+	assert.Equal(t, "nic", got[1].Component)
+	assert.Equal(t, []string{"Ethernet Controller X710"}, got[1].Models)
+
+	statusMsgs := []string{}
+	for _, msg := range h.Task.Status.StatusMsgs {
+		statusMsgs = append(statusMsgs, msg.Msg)
+	}
+
+	assert.Equal(t, []string{
+		"[drive model=MZ7LH480HAHQ serial=s1] firmware upgrade queued for install, current=1.0, requested=1.2",
+		"[drive model=MZ7LH480HAHQ serial=s3] component firmware version equal, current=1.2, requested=1.2",
+		"[drive model=ST4000NM serial=s2] component firmware version equal, current=1.2, requested=1.2",
+		"[nic] firmware upgrade queued for install, current=8.0, requested=9.0",
+	}, statusMsgs)
+}
+
+func TestPlanRollback(t *testing.T) {
+	t.Parallel()
+
+	inventory := `
+servers: []
+firmware_sets:
+  - id: 9d70c28c-5f65-4088-b014-205c54ad4ac7
+    vendor: dell
+    model: r6515
+    firmwares:
+      - vendor: dell
+        component: bmc
+        version: "1.0"
+        filename: bmc-1.0.bin
+        URL: https://example.com/bmc-1.0.bin
+        checksum: abc
+        models:
+          - r6515
+`
+	file := filepath.Join(t.TempDir(), "inventory.yaml")
+	require.Nil(t, os.WriteFile(file, []byte(inventory), 0o600))
+
+	repository, err := store.NewYamlStore(context.Background(), &app.YamlStoreOptions{InventoryFile: file}, logrus.New())
+	require.Nil(t, err)
+
+	h := taskHandler{
+		mode: model.RunOutofband,
+		TaskHandlerContext: &runner.TaskHandlerContext{
+			Logger: logrus.NewEntry(logrus.New()),
+			Store:  repository,
+			Task: &model.FirmwareTask{
+				Status: rctypes.NewTaskStatusRecord("initialized task"),
+				Server: &rctypes.Server{
+					Vendor: "dell",
+					Model:  "r6515",
+					Components: []*rctypes.Component{
+						{Name: "bmc", Vendor: "dell", Model: "r6515", InstalledFirmware: &rctypes.InstalledFirmware{Version: "1.0"}},
+						{Name: "nic", Vendor: "intel", Model: "x710", InstalledFirmware: &rctypes.InstalledFirmware{Version: "8.0"}},
+						{Name: "drive", Vendor: "samsung", Model: "MZ7LH480HAHQ", Serial: "s1", InstalledFirmware: &rctypes.InstalledFirmware{Version: "1.0"}},
+						{Name: "drive", Vendor: "samsung", Model: "MZ7LH480HAHQ", Serial: "s2", InstalledFirmware: &rctypes.InstalledFirmware{Version: "1.1"}},
+						{Name: "psu", Vendor: "delta", Model: "dps-800", Serial: "p1", InstalledFirmware: &rctypes.InstalledFirmware{Version: "1.10.2"}},
+						{Name: "psu", Vendor: "delta", Model: "dps-800", Serial: "p2", InstalledFirmware: &rctypes.InstalledFirmware{Version: "01.10.02"}},
+					},
+				},
+				Parameters: &rctypes.FirmwareInstallTaskParameters{},
+				Data:       &model.FirmwareTaskData{RollbackOnFailure: true},
+			},
+		},
+	}
+
+	// the firmware artifact for the installed version is recorded
+	got := h.planRollback(context.Background(), &rctypes.Firmware{Vendor: "dell", Component: "bmc", Version: "2.0", Models: []string{"r6515"}})
+	require.NotNil(t, got)
+	assert.Equal(t, "1.0", got.Version)
+	require.NotNil(t, got.Firmware)
+	assert.Equal(t, "bmc-1.0.bin", got.Firmware.FileName)
+	assert.Equal(t, "https://example.com/bmc-1.0.bin", got.Firmware.URL)
+
+	// the installed version is recorded without a firmware artifact when none is found in the store
+	got = h.planRollback(context.Background(), &rctypes.Firmware{Vendor: "intel", Component: "nic", Version: "9.0", Models: []string{"x710"}})
+	require.NotNil(t, got)
+	assert.Equal(t, "8.0", got.Version)
+	assert.Nil(t, got.Firmware)
+
+	// a single reinstall cannot restore components at different versions
+	got = h.planRollback(context.Background(), &rctypes.Firmware{Vendor: "samsung", Component: "drive", Version: "1.2", Models: []string{"MZ7LH480HAHQ"}})
+	assert.Nil(t, got)
+
+	// instance versions are compared with the version scheme of the component
+	got = h.planRollback(context.Background(), &rctypes.Firmware{Vendor: "delta", Component: "psu", Version: "1.11.0", Models: []string{"dps-800"}})
+	require.NotNil(t, got)
+	assert.Equal(t, "01.10.02", got.Version)
+
+	statusMsgs := []string{}
+	for _, msg := range h.Task.Status.StatusMsgs {
+		statusMsgs = append(statusMsgs, msg.Msg)
+	}
+
+	assert.Equal(t, []string{
+		"initialized task",
+		"[nic] firmware for installed version 8.0 not found, rollback not available",
+		"[drive] installed firmware versions differ, rollback not available",
+		"[psu] firmware for installed version 01.10.02 not found, rollback not available",
+	}, statusMsgs)
+}
+
+func TestCheckInstallRequirements(t *testing.T) {
+	t.Parallel()
+
+	cpldRequiresBIOS := &model.InstallRequirement{Component: "cpld", RequiredComponent: "bios", MinVersion: "3.5"}
+
+	tests := []struct {
+		name          string
+		rules         []*model.InstallRules
+		setRules      *model.InstallRules
+		firmware      []*rctypes.Firmware
+		installedBIOS string
+		expectedOrder []string
+		expectedErr   string
+	}{
+		{
+			name:          "requirement met by installed firmware",
+			rules:         []*model.InstallRules{{Requires: []*model.InstallRequirement{cpldRequiresBIOS}}},
+			firmware:      []*rctypes.Firmware{{Component: "cpld", Version: "2.1"}},
+			installedBIOS: "3.6",
+			expectedOrder: []string{"cpld"},
+		},
+		{
+			name:          "requirement met by firmware installed earlier",
+			rules:         []*model.InstallRules{{Requires: []*model.InstallRequirement{cpldRequiresBIOS}}},
+			firmware:      []*rctypes.Firmware{{Component: "cpld", Version: "2.1"}, {Component: "bios", Version: "3.5"}},
+			installedBIOS: "3.2",
+			expectedOrder: []string{"bios", "cpld"},
+		},
+		{
+			name:          "installed firmware too old",
+			rules:         []*model.InstallRules{{Requires: []*model.InstallRequirement{cpldRequiresBIOS}}},
+			firmware:      []*rctypes.Firmware{{Component: "cpld", Version: "2.1"}},
+			installedBIOS: "3.2",
+			expectedErr:   "[cpld] firmware 2.1 requires bios version >= 3.5: installed bios version \"3.2\", no bios install planned",
+		},
+		{
+			name:          "planned firmware too old",
+			rules:         []*model.InstallRules{{Requires: []*model.InstallRequirement{cpldRequiresBIOS}}},
+			firmware:      []*rctypes.Firmware{{Component: "bios", Version: "3.4"}, {Component: "cpld", Version: "2.1"}},
+			installedBIOS: "3.2",
+			expectedErr:   "[cpld] firmware 2.1 requires bios version >= 3.5: planned bios version 3.4",
+		},
+		{
+			name:          "install order conflicts with requirement",
+			rules:         []*model.InstallRules{{Requires: []*model.InstallRequirement{cpldRequiresBIOS}}},
+			setRules:      &model.InstallRules{Order: []string{"cpld", "bios"}},
+			firmware:      []*rctypes.Firmware{{Component: "bios", Version: "3.5"}, {Component: "cpld", Version: "2.1"}},
+			installedBIOS: "3.2",
+			expectedErr:   "[cpld] firmware 2.1 requires bios version >= 3.5: bios install is ordered after cpld",
+		},
+		{
+			name:          "configured install order",
+			rules:         []*model.InstallRules{{Vendor: "supermicro", Order: []string{"bios", "bmc"}}},
+			firmware:      []*rctypes.Firmware{{Component: "nic", Version: "1.0"}, {Component: "bmc", Version: "1.0"}, {Component: "bios", Version: "1.0"}},
+			expectedOrder: []string{"bios", "bmc", "nic"},
+		},
+		{
+			name:          "configured install order for another vendor",
+			rules:         []*model.InstallRules{{Vendor: "dell", Order: []string{"bios", "bmc"}}},
+			firmware:      []*rctypes.Firmware{{Component: "nic", Version: "1.0"}, {Component: "bios", Version: "1.0"}, {Component: "bmc", Version: "1.0"}},
+			expectedOrder: []string{"bmc", "bios", "nic"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := taskHandler{
+				mode:            model.RunOutofband,
+				setInstallRules: tt.setRules,
+				TaskHandlerContext: &runner.TaskHandlerContext{
+					Logger:       logrus.NewEntry(logrus.New()),
+					InstallRules: tt.rules,
+					Task: &model.FirmwareTask{
+						Server: &rctypes.Server{
+							Vendor: "supermicro",
+							Model:  "x11dph-t",
+							Components: []*rctypes.Component{
+								{Name: "bios", InstalledFirmware: &rctypes.InstalledFirmware{Version: tt.installedBIOS}},
+							},
+						},
+					},
+				},
+			}
+
+			rules := h.installRules()
+			h.sortFirmwareByInstallOrder(tt.firmware, rules)
+
+			err := h.checkInstallRequirements(tt.firmware, rules)
+			if tt.expectedErr != "" {
+				assert.ErrorIs(t, err, errInstallRequirement)
+				assert.ErrorContains(t, err, tt.expectedErr)
+
+				return
+			}
+
+			require.Nil(t, err)
+
+			got := []string{}
+			for _, fw := range tt.firmware {
+				got = append(got, fw.Component)
+			}
+
+			assert.Equal(t, tt.expectedOrder, got)
+		})
+	}
+}
+
+func TestPlanActionDependencies(t *testing.T) {
+	newAction := func(id, component string) *model.Action {
+		return &model.Action{ID: id, Firmware: rctypes.Firmware{Component: component}}
+	}
+
+	actions := model.Actions{
+		newAction("bmc", "bmc"),
+		newAction("drive1", "drive"),
+		newAction("drive2", "drive"),
+		newAction("expander", "backplane-expander"),
+		newAction("nic1", "nic"),
+		newAction("nic2", "nic"),
+		newAction("psu", "psu"),
+	}
+
+	actions[0].First = true
+	// the host is powered off for the install
+	actions[5].HostPowerOffPreInstall = true
+	actions[6].Last = true
+
+	planActionDependencies(actions, nil)
+
+	expected := map[string][]string{
+		"bmc":      nil,
+		"drive1":   {"bmc"},
+		"drive2":   {"bmc"},
+		"expander": {"bmc", "drive1", "drive2"},
+		"nic1":     {"bmc", "drive1", "drive2", "expander"},
+		"nic2":     {"bmc", "drive1", "drive2", "expander", "nic1"},
+		"psu":      {"bmc", "drive1", "drive2", "expander", "nic1", "nic2"},
+	}
+
+	for _, action := range actions {
+		assert.Equal(t, expected[action.ID], action.DependsOn, action.ID)
+	}
+
+	// components missing from the default install order are independent when listed in the install rules order
+	actions = model.Actions{
+		newAction("retimer1", "retimer"),
+		newAction("retimer2", "retimer"),
+	}
+
+	planActionDependencies(actions, nil)
+	assert.Equal(t, []string{"retimer1"}, actions[1].DependsOn)
+
+	planActionDependencies(actions, &model.InstallRules{Order: []string{"retimer"}})
+	assert.Nil(t, actions[1].DependsOn)
+}
+
 func TestPlanInstall_Outofband(t *testing.T) {
 	t.Parallel()
 	fwSet := []*rctypes.Firmware{
@@ -500,3 +883,55 @@ func TestPlanResumedTask(t *testing.T) {
 		}
 	}
 }
+
+func TestPlanResumedTaskOutofband(t *testing.T) {
+	t.Parallel()
+
+	logger := logrus.NewEntry(logrus.New())
+
+	serverID := uuid.MustParse("fa125199-e9dd-47d4-8667-ce1d26f58c4a")
+	taskID := uuid.MustParse("05c3296d-be5d-473a-b90c-4ce66cfdec65")
+	taskHandlerCtx := &runner.TaskHandlerContext{
+		Logger: logger,
+		Task: &model.FirmwareTask{
+			ID:       taskID,
+			WorkerID: registry.GetID("test-app").String(),
+			Data: &model.FirmwareTaskData{
+				ActionsPlanned: []*model.Action{
+					{
+						Firmware:            rctypes.Firmware{Component: "bmc", Version: "1.2.3"},
+						State:               model.StateActive,
+						BMCTaskID:           "JID_1234",
+						FirmwareInstallStep: "upload-initiate-install",
+						Steps: []*model.Step{
+							{
+								Name:  "downloadFirmware",
+								State: model.StateSucceeded,
+							},
+							{
+								Name:  "uploadFirmwareInitiateInstall",
+								State: model.StateSucceeded,
+							},
+							{
+								Name:  "pollInstallStatus",
+								State: model.StateActive,
+							},
+						},
+					},
+				},
+			},
+			Parameters: &rctypes.FirmwareInstallTaskParameters{AssetID: serverID},
+			Server:     &rctypes.Server{UUID: serverID},
+		},
+		DeviceQueryor: new(device.MockOutofbandQueryor),
+	}
+
+	h := taskHandler{mode: model.RunOutofband, TaskHandlerContext: taskHandlerCtx}
+	err := h.planResumedTask()
+	require.NoError(t, err, "no errors returned")
+
+	action := taskHandlerCtx.Task.Data.ActionsPlanned[0]
+	require.Equal(t, "JID_1234", action.BMCTaskID, "expect BMC task ID to be intact")
+	require.Nil(t, action.Steps[1].Handler, "expect no handler on completed upload step")
+	require.NotNil(t, action.Steps[2].Handler, "expect handler on active poll step")
+}
@@ -0,0 +1,86 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// checkTimeout is the time each readiness check is given to complete
+	checkTimeout = 5 * time.Second
+
+	// the check result returned for passing checks
+	checkOK = "ok"
+)
+
+// Check returns an error when the dependency it checks is not ready.
+type Check func(ctx context.Context) error
+
+// Readiness is the readiness endpoint response.
+type Readiness struct {
+	Ready bool `json:"ready"`
+	// Checks lists the check results by name - ok or the check error
+	Checks map[string]string `json:"checks"`
+}
+
+// LivenessHandler returns the http handler for the liveness endpoint,
+// the process is considered live when it is able to serve the request.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(checkOK))
+	})
+}
+
+// ReadinessHandler returns the http handler for the readiness endpoint,
+// the checks are run concurrently and a 503 is returned when any of them fails.
+func ReadinessHandler(checks map[string]Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		readiness := Run(r.Context(), checks)
+
+		w.Header().Set("Content-Type", "application/json")
+		if !readiness.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		_ = json.NewEncoder(w).Encode(readiness)
+	})
+}
+
+// Run runs the checks and returns their results.
+func Run(ctx context.Context, checks map[string]Check) Readiness {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	readiness := Readiness{Ready: true, Checks: make(map[string]string, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			result := checkOK
+			err := check(ctx)
+			if err != nil {
+				result = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			readiness.Checks[name] = result
+			if err != nil {
+				readiness.Ready = false
+			}
+		}(name, check)
+	}
+
+	wg.Wait()
+
+	return readiness
+}
@@ -0,0 +1,63 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		checks         map[string]Check
+		expectedCode   int
+		expectedChecks map[string]string
+	}{
+		{
+			name: "ready",
+			checks: map[string]Check{
+				"store": func(context.Context) error { return nil },
+				"nats":  func(context.Context) error { return nil },
+			},
+			expectedCode:   http.StatusOK,
+			expectedChecks: map[string]string{"store": "ok", "nats": "ok"},
+		},
+		{
+			name: "not ready",
+			checks: map[string]Check{
+				"store": func(context.Context) error { return nil },
+				"nats":  func(context.Context) error { return errors.New("NATS connection status: RECONNECTING") },
+			},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"store": "ok", "nats": "NATS connection status: RECONNECTING"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ReadinessHandler(tt.checks).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+
+			got := Readiness{}
+			require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, tt.expectedCode == http.StatusOK, got.Ready)
+			assert.Equal(t, tt.expectedChecks, got.Checks)
+		})
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", http.NoBody))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok", rec.Body.String())
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel/attribute"
@@ -15,28 +16,43 @@ import (
 )
 
 const (
+	// MetricsEndpoint is the default address the metrics endpoint listens on
 	MetricsEndpoint = "0.0.0.0:9090"
 )
 
 var (
+	// Registry is the registry the agent metrics are registered on, it is served on the /metrics endpoint.
+	Registry = prometheus.NewRegistry()
+
 	EventsCounter *prometheus.CounterVec
 
-	ConditionRunTimeSummary     *prometheus.SummaryVec
-	ActionRuntimeSummary        *prometheus.SummaryVec
-	ActionHandlerRunTimeSummary *prometheus.SummaryVec
+	ConditionRunTimeSummary *prometheus.SummaryVec
+	ConditionsInflight      *prometheus.GaugeVec
+	ActionRuntimeSummary    *prometheus.SummaryVec
+	StepRunTimeHistogram    *prometheus.HistogramVec
+
+	DownloadBytes *prometheus.CounterVec
+	UploadBytes   *prometheus.CounterVec
 
-	DownloadBytes          *prometheus.CounterVec
-	DownloadRunTimeSummary *prometheus.SummaryVec
-	UploadBytes            *prometheus.CounterVec
-	UploadRunTimeSummary   *prometheus.SummaryVec
+	FirmwareCacheRequests *prometheus.CounterVec
+	FirmwareCacheBytes    prometheus.Gauge
 
 	StoreQueryErrorCount *prometheus.CounterVec
+	BMCQueryErrorCount   *prometheus.CounterVec
 
-	NATSErrors *prometheus.CounterVec
+	NATSErrors          *prometheus.CounterVec
+	NATSConnectDuration prometheus.Summary
 )
 
 func init() {
-	EventsCounter = promauto.NewCounterVec(
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	factory := promauto.With(Registry)
+
+	EventsCounter = factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "agent_events_received",
 			Help: "A counter metric to measure the total count of events received",
@@ -44,7 +60,7 @@ func init() {
 		[]string{"valid", "response"}, // valid is true/false, response is ack/nack
 	)
 
-	ConditionRunTimeSummary = promauto.NewSummaryVec(
+	ConditionRunTimeSummary = factory.NewSummaryVec(
 		prometheus.SummaryOpts{
 			Name: "agent_condition_duration_seconds",
 			Help: "A summary metric to measure the total time spent in completing each condition",
@@ -52,7 +68,15 @@ func init() {
 		[]string{"condition", "state"},
 	)
 
-	ActionRuntimeSummary = promauto.NewSummaryVec(
+	ConditionsInflight = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "agent_conditions_inflight",
+			Help: "A gauge metric to measure the conditions being handled by condition kind",
+		},
+		[]string{"condition"},
+	)
+
+	ActionRuntimeSummary = factory.NewSummaryVec(
 		prometheus.SummaryOpts{
 			Name: "agent_install_action_runtime_seconds",
 			Help: "A summary metric to measure the total time spent in each install action",
@@ -60,15 +84,17 @@ func init() {
 		[]string{"vendor", "component", "state"},
 	)
 
-	ActionHandlerRunTimeSummary = promauto.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Name: "agent_install_action_handler_seconds",
-			Help: "A summary metric to measure the total time spent in each install action handler being executed",
+	StepRunTimeHistogram = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "agent_install_step_duration_seconds",
+			Help: "A histogram metric to measure the time spent in each install action step",
+			// steps range from sub second checks to firmware installs that run for an hour
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600, 7200},
 		},
-		[]string{"transition", "vendor", "component", "state"},
+		[]string{"step", "vendor", "model", "component", "state"},
 	)
 
-	DownloadBytes = promauto.NewCounterVec(
+	DownloadBytes = factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "agent_download_bytes",
 			Help: "A counter metric to measure firmware downloaded in bytes",
@@ -76,7 +102,7 @@ func init() {
 		[]string{"component", "vendor"},
 	)
 
-	UploadBytes = promauto.NewCounterVec(
+	UploadBytes = factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "agent_upload_bytes",
 			Help: "A counter metric to measure firmware uploaded in bytes",
@@ -84,7 +110,22 @@ func init() {
 		[]string{"component", "vendor"},
 	)
 
-	StoreQueryErrorCount = promauto.NewCounterVec(
+	FirmwareCacheRequests = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "agent_firmware_cache_requests",
+			Help: "A counter metric to measure firmware cache lookups",
+		},
+		[]string{"result"}, // result is hit/miss
+	)
+
+	FirmwareCacheBytes = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "agent_firmware_cache_bytes",
+			Help: "A gauge metric to measure the size of firmware files held in the firmware cache",
+		},
+	)
+
+	StoreQueryErrorCount = factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "agent_store_query_error_count",
 			Help: "A counter metric to measure the total count of errors querying the asset store.",
@@ -92,22 +133,38 @@ func init() {
 		[]string{"storeKind", "queryKind"},
 	)
 
-	NATSErrors = promauto.NewCounterVec(
+	BMCQueryErrorCount = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "agent_bmc_query_error_count",
+			Help: "A counter metric to measure the total count of errors querying the server BMC.",
+		},
+		[]string{"vendor", "model", "queryKind"},
+	)
+
+	NATSErrors = factory.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "agent_nats_errors",
 			Help: "A count of errors while trying to use NATS.",
 		},
 		[]string{"operation"},
 	)
+
+	NATSConnectDuration = factory.NewSummary(
+		prometheus.SummaryOpts{
+			Name: "agent_nats_connection_time_seconds",
+			Help: "A summary metric to measure the time taken to connect and subscribe to the NATS Jetstream",
+		},
+	)
 }
 
-// ListenAndServeMetrics exposes prometheus metrics as /metrics
-func ListenAndServe() {
+// ListenAndServe exposes prometheus metrics as /metrics on the given address,
+// along with the handlers registered on the default mux.
+func ListenAndServe(address string) {
 	go func() {
-		http.Handle("/metrics", promhttp.Handler())
+		http.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
 
 		server := &http.Server{
-			Addr:              MetricsEndpoint,
+			Addr:              address,
 			ReadHeaderTimeout: 2 * time.Second, // nolint:gomnd // time duration value is clear as is.
 		}
 
@@ -78,6 +78,21 @@ type Action struct {
 	// Last is set to true when its the last action being executed
 	Last bool `json:"last"`
 
+	// DependsOn lists the IDs of the actions to be completed before this action is run,
+	// actions without pending dependencies may run concurrently.
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	// Rollback is the firmware installed on the component before this action,
+	// it is recorded when the action is planned for tasks with rollback on failure enabled.
+	Rollback *Rollback `json:"rollback,omitempty"`
+
+	// RollbackOf is the ID of the failed action this action reinstalls the previous firmware for.
+	RollbackOf string `json:"rollback_of,omitempty"`
+
+	// StepStatus is the task status message published for the running step,
+	// action handlers update this message with the step progress.
+	StepStatus string `json:"-"`
+
 	// Attempts indicates how many times this action has been tried
 	Attempts int `json:"attempts"`
 
@@ -85,6 +100,19 @@ type Action struct {
 	Steps Steps `json:"steps"`
 }
 
+// Rollback holds the firmware installed on the component before an install,
+// the firmware is reinstalled by a rollback action when the install verification fails.
+type Rollback struct {
+	// Version is the component firmware version installed before the install.
+	Version string `json:"version"`
+
+	// Firmware is the firmware artifact of the installed version, this is nil when the artifact was not found in the store.
+	Firmware *rctypes.Firmware `json:"firmware,omitempty"`
+
+	// ActionID is the ID of the action composed to reinstall the firmware, this is set once the rollback is attempted.
+	ActionID string `json:"action_id,omitempty"`
+}
+
 func (a *Action) SetID(taskID, componentSlug string, idx int) {
 	a.ID = fmt.Sprintf("%s-%s-%s", taskID, componentSlug, strconv.Itoa(idx))
 }
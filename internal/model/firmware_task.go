@@ -3,6 +3,8 @@ package model
 import (
 	"encoding/json"
 	"reflect"
+	"slices"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/mitchellh/copystructure"
@@ -35,6 +37,29 @@ const (
 	FromRequestedFirmware FirmwarePlanMethod = "fromRequestedFirmware"
 )
 
+// DowngradePolicy defines how the install of firmware older than the installed firmware is handled.
+type DowngradePolicy string
+
+const (
+	// DowngradeAllow installs firmware older than the installed firmware.
+	DowngradeAllow DowngradePolicy = "allow"
+
+	// DowngradeDeny skips the install of firmware older than the installed firmware,
+	// and of firmware with a version that cannot be ordered against the installed version.
+	DowngradeDeny DowngradePolicy = "deny"
+
+	// DowngradeWarn installs firmware older than the installed firmware, the downgrade is logged as a warning.
+	DowngradeWarn DowngradePolicy = "warn"
+
+	// DefaultDowngradePolicy applies when the task parameters do not set a downgrade policy.
+	DefaultDowngradePolicy = DowngradeWarn
+)
+
+// DowngradePolicies returns the supported downgrade policies.
+func DowngradePolicies() []DowngradePolicy {
+	return []DowngradePolicy{DowngradeAllow, DowngradeDeny, DowngradeWarn}
+}
+
 var (
 	errTaskFirmwareParam = errors.New("firmware task parameters error")
 	ErrInitTask          = errors.New("error initializing new task from condition")
@@ -47,6 +72,39 @@ func (t *FirmwareTask) SetState(s rctypes.State) {
 	t.State = s
 }
 
+// WithLock runs fn holding the task lock.
+//
+// Actions of a task may run concurrently, changes to the task and its actions while actions are running
+// and the task copy made for publishing are done holding this lock.
+func (t *FirmwareTask) WithLock(fn func()) {
+	// actions are planned in the task data, without which there is nothing to run concurrently
+	if t.Data == nil {
+		fn()
+		return
+	}
+
+	t.Data.mu.Lock()
+	defer t.Data.mu.Unlock()
+
+	fn()
+}
+
+// WithPowerLock runs fn holding the task power lock.
+//
+// Actions running concurrently check and change the host power state holding this lock, so one action at a time
+// changes the host power state, the task lock is not held meanwhile since the BMC is queried.
+func (t *FirmwareTask) WithPowerLock(fn func()) {
+	if t.Data == nil {
+		fn()
+		return
+	}
+
+	t.Data.powerMu.Lock()
+	defer t.Data.powerMu.Unlock()
+
+	fn()
+}
+
 func (t *FirmwareTask) MustMarshal() json.RawMessage {
 	b, err := json.Marshal(t)
 	if err != nil {
@@ -114,6 +172,34 @@ type FirmwareTaskData struct {
 
 	// Scratch is an arbitrary key values map available to all task, action handler methods.
 	Scratch map[string]string `json:"scratch,omitempty"`
+
+	// DowngradePolicy is set from the downgrade_policy task parameter,
+	// it is held in the task data since the firmware install task parameters do not include it.
+	DowngradePolicy DowngradePolicy `json:"downgrade_policy,omitempty"`
+
+	// RollbackOnFailure is set from the rollback_on_failure task parameter, when set the firmware installed
+	// before each out-of-band install is reinstalled if the install verification fails.
+	RollbackOnFailure bool `json:"rollback_on_failure,omitempty"`
+
+	// ActionConcurrency is the number of independent actions run concurrently, it is set when the actions are planned.
+	//
+	// Actions are run one after another when this is 0 or 1.
+	ActionConcurrency int `json:"action_concurrency,omitempty"`
+
+	// mu is the task lock
+	mu sync.Mutex
+
+	// powerMu serializes the host power changes of the task actions
+	powerMu sync.Mutex
+}
+
+// DowngradePolicyOrDefault returns the task downgrade policy, the DefaultDowngradePolicy applies when none was set.
+func (td *FirmwareTaskData) DowngradePolicyOrDefault() DowngradePolicy {
+	if td == nil || td.DowngradePolicy == "" {
+		return DefaultDowngradePolicy
+	}
+
+	return td.DowngradePolicy
 }
 
 func (td *FirmwareTaskData) MapStringInterfaceToStruct(m map[string]interface{}) error {
@@ -133,6 +219,26 @@ func (td *FirmwareTaskData) Unmarshal(r json.RawMessage) error {
 	return json.Unmarshal(r, td)
 }
 
+// ActiveActionStep returns the ID of the active action and the name of its active step,
+// empty values are returned when no action is active.
+func (td *FirmwareTaskData) ActiveActionStep() (action, step string) {
+	for _, a := range td.ActionsPlanned {
+		if a.State != StateActive {
+			continue
+		}
+
+		for _, s := range a.Steps {
+			if s.State == StateActive {
+				return a.ID, string(s.Name)
+			}
+		}
+
+		return a.ID, ""
+	}
+
+	return "", ""
+}
+
 func NewTaskFirmware(conditionID uuid.UUID, kind rctypes.Kind, params *rctypes.FirmwareInstallTaskParameters) (FirmwareTask, error) {
 	t := FirmwareTask{
 		StructVersion: rctypes.TaskVersion1,
@@ -186,6 +292,46 @@ func convTaskFirmwareParams(params any) (*rctypes.FirmwareInstallTaskParameters,
 	return fwInstallParams, nil
 }
 
+// taskDataParameters are the Task.Parameters attributes not part of the firmware install task parameters type,
+// these are retained in the task data.
+type taskDataParameters struct {
+	DowngradePolicy   DowngradePolicy `json:"downgrade_policy,omitempty"`
+	RollbackOnFailure bool            `json:"rollback_on_failure,omitempty"`
+}
+
+// convTaskDataParameters returns the downgrade_policy and rollback_on_failure attributes from the Task.Parameters,
+// empty values are returned when the attributes are not set.
+func convTaskDataParameters(params any) (*taskDataParameters, error) {
+	errParamsConv := errors.New("error in Task.Parameters task data attributes conversion")
+
+	attrs := &taskDataParameters{}
+
+	var raw json.RawMessage
+	switch v := params.(type) {
+	case map[string]interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, errors.Wrap(errParamsConv, err.Error())
+		}
+
+		raw = b
+	case json.RawMessage:
+		raw = v
+	default:
+		return attrs, nil
+	}
+
+	if err := json.Unmarshal(raw, attrs); err != nil {
+		return nil, errors.Wrap(errParamsConv, err.Error())
+	}
+
+	if attrs.DowngradePolicy != "" && !slices.Contains(DowngradePolicies(), attrs.DowngradePolicy) {
+		return nil, errors.Wrap(errParamsConv, "unsupported downgrade policy: "+string(attrs.DowngradePolicy))
+	}
+
+	return attrs, nil
+}
+
 func convFirmwareTaskData(data any) (*FirmwareTaskData, error) {
 	errDataConv := errors.New("error in Task.Data conversion")
 
@@ -227,6 +373,19 @@ func CopyAsFirmwareTask(task *rctypes.Task[any, any]) (*FirmwareTask, error) {
 		return nil, errors.Wrap(errTaskConv, err.Error())
 	}
 
+	attrs, err := convTaskDataParameters(task.Parameters)
+	if err != nil {
+		return nil, errors.Wrap(errTaskConv, err.Error())
+	}
+
+	if attrs.DowngradePolicy != "" {
+		data.DowngradePolicy = attrs.DowngradePolicy
+	}
+
+	if attrs.RollbackOnFailure {
+		data.RollbackOnFailure = true
+	}
+
 	// deep copy fields referenced by pointer
 	asset, err := copystructure.Copy(task.Server)
 	if err != nil {
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	rctypes "github.com/metal-automata/rivets/condition"
+)
+
+func TestCopyAsFirmwareTaskDowngradePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      any
+		data        any
+		expected    DowngradePolicy
+		expectedErr string
+	}{
+		{
+			name:     "default policy",
+			params:   json.RawMessage(`{"asset_id":"fa125199-e9dd-47d4-8667-ce1d26f58c4a"}`),
+			data:     json.RawMessage(`{}`),
+			expected: DefaultDowngradePolicy,
+		},
+		{
+			name:     "policy from parameters",
+			params:   map[string]interface{}{"asset_id": "fa125199-e9dd-47d4-8667-ce1d26f58c4a", "downgrade_policy": "deny"},
+			data:     json.RawMessage(`{}`),
+			expected: DowngradeDeny,
+		},
+		{
+			// the published task parameters do not include the policy, it is retained in the task data
+			name:     "policy from resumed task data",
+			params:   json.RawMessage(`{"asset_id":"fa125199-e9dd-47d4-8667-ce1d26f58c4a"}`),
+			data:     json.RawMessage(`{"downgrade_policy":"allow"}`),
+			expected: DowngradeAllow,
+		},
+		{
+			name:        "unsupported policy",
+			params:      json.RawMessage(`{"downgrade_policy":"sometimes"}`),
+			data:        json.RawMessage(`{}`),
+			expectedErr: "unsupported downgrade policy: sometimes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &rctypes.Task[any, any]{
+				ID:         uuid.New(),
+				Kind:       rctypes.FirmwareInstall,
+				Parameters: tt.params,
+				Data:       tt.data,
+				Server:     &rctypes.Server{},
+				Fault:      &rctypes.Fault{},
+			}
+
+			got, err := CopyAsFirmwareTask(task)
+			if tt.expectedErr != "" {
+				require.NotNil(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+
+				return
+			}
+
+			require.Nil(t, err)
+			assert.Equal(t, tt.expected, got.Data.DowngradePolicyOrDefault())
+		})
+	}
+}
+
+func TestCopyAsFirmwareTaskRollbackOnFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   any
+		data     any
+		expected bool
+	}{
+		{
+			name:   "not set",
+			params: json.RawMessage(`{"asset_id":"fa125199-e9dd-47d4-8667-ce1d26f58c4a"}`),
+			data:   json.RawMessage(`{}`),
+		},
+		{
+			name:     "set in parameters",
+			params:   map[string]interface{}{"asset_id": "fa125199-e9dd-47d4-8667-ce1d26f58c4a", "rollback_on_failure": true},
+			data:     json.RawMessage(`{}`),
+			expected: true,
+		},
+		{
+			name:     "set in resumed task data",
+			params:   json.RawMessage(`{"asset_id":"fa125199-e9dd-47d4-8667-ce1d26f58c4a"}`),
+			data:     json.RawMessage(`{"rollback_on_failure":true}`),
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &rctypes.Task[any, any]{
+				ID:         uuid.New(),
+				Kind:       rctypes.FirmwareInstall,
+				Parameters: tt.params,
+				Data:       tt.data,
+				Server:     &rctypes.Server{},
+				Fault:      &rctypes.Fault{},
+			}
+
+			got, err := CopyAsFirmwareTask(task)
+			require.Nil(t, err)
+			assert.Equal(t, tt.expected, got.Data.RollbackOnFailure)
+		})
+	}
+}
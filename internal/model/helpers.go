@@ -10,6 +10,7 @@ import (
 	"github.com/pkg/errors"
 
 	fleetdbapi "github.com/metal-automata/fleetdb/pkg/api/v1"
+	rctypes "github.com/metal-automata/rivets/condition"
 )
 
 var (
@@ -69,3 +70,60 @@ func FindComponentByNameModel(items []*fleetdbapi.ServerComponent, cSlug string,
 
 	return nil
 }
+
+// FindFirmwareComponents returns the server components the firmware applies to, matched by the component slug, vendor and model.
+//
+// The firmware vendor is not matched against the component vendor for OEM firmware or when its the server vendor,
+// the firmware models are matched against the server model and the component model, components with an unknown vendor or model are included.
+func FindFirmwareComponents(server *fleetdbapi.Server, fw *rctypes.Firmware) []*fleetdbapi.ServerComponent {
+	if server == nil {
+		return nil
+	}
+
+	found := []*fleetdbapi.ServerComponent{}
+	for _, component := range server.Components {
+		if !strings.EqualFold(fw.Component, component.Name) {
+			continue
+		}
+
+		// a single BIOS, BMC component is expected on a machine
+		if strings.EqualFold(common.SlugBIOS, fw.Component) || strings.EqualFold(common.SlugBMC, fw.Component) {
+			return []*fleetdbapi.ServerComponent{component}
+		}
+
+		if !firmwareVendorMatch(server, fw, component) || !firmwareModelMatch(server, fw, component) {
+			continue
+		}
+
+		found = append(found, component)
+	}
+
+	return found
+}
+
+func firmwareVendorMatch(server *fleetdbapi.Server, fw *rctypes.Firmware, component *fleetdbapi.ServerComponent) bool {
+	if fw.Oem || fw.Vendor == "" || component.Vendor == "" || strings.EqualFold(fw.Vendor, server.Vendor) {
+		return true
+	}
+
+	return strings.Contains(strings.ToLower(component.Vendor), strings.ToLower(strings.TrimSpace(fw.Vendor)))
+}
+
+func firmwareModelMatch(server *fleetdbapi.Server, fw *rctypes.Firmware, component *fleetdbapi.ServerComponent) bool {
+	if len(fw.Models) == 0 || component.Model == "" {
+		return true
+	}
+
+	for _, find := range fw.Models {
+		find = strings.ToLower(strings.TrimSpace(find))
+		if find == "" {
+			continue
+		}
+
+		if strings.Contains(strings.ToLower(server.Model), find) || strings.Contains(strings.ToLower(component.Model), find) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,169 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FirmwareSetInstallRulesNS is the firmware set attribute namespace the install rules for the firmware set are read from.
+	FirmwareSetInstallRulesNS = "sh.hollow.firmware_set.install_rules"
+)
+
+var (
+	ErrInstallRules = errors.New("firmware install rules error")
+)
+
+// InstallRules define the order firmware is installed in and the dependencies between component firmware installs.
+type InstallRules struct {
+	// Vendor limits the rules to servers of the vendor, the rules apply to all servers when not set.
+	Vendor string `json:"vendor,omitempty" mapstructure:"vendor"`
+
+	// Models limits the rules to servers of the models, the rules apply to all models of the vendor when not set.
+	Models []string `json:"models,omitempty" mapstructure:"models"`
+
+	// Order lists the component slugs in the order firmware is installed,
+	// components not listed are installed after the listed components in the default install order.
+	Order []string `json:"order,omitempty" mapstructure:"order"`
+
+	// Requires lists the component firmware versions a component firmware install depends on.
+	Requires []*InstallRequirement `json:"requires,omitempty" mapstructure:"requires"`
+}
+
+// InstallRequirement is a dependency of the Component firmware install
+// on the RequiredComponent firmware at MinVersion or newer.
+//
+// The requirement is met when the required component firmware is installed at the version
+// or when its planned to be installed before the component firmware.
+type InstallRequirement struct {
+	Component         string `json:"component" mapstructure:"component"`
+	RequiredComponent string `json:"required_component" mapstructure:"required_component"`
+	MinVersion        string `json:"min_version" mapstructure:"min_version"`
+}
+
+func (r *InstallRequirement) String() string {
+	return fmt.Sprintf("%s requires %s at version >= %s", r.Component, r.RequiredComponent, r.MinVersion)
+}
+
+// Validate returns an error when the install rules list a component more than once or a requirement is incomplete.
+func (r *InstallRules) Validate() error {
+	if r == nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, component := range r.Order {
+		slug := strings.ToLower(strings.TrimSpace(component))
+		if slug == "" {
+			return errors.Wrap(ErrInstallRules, "empty component in install order")
+		}
+
+		if seen[slug] {
+			return errors.Wrap(ErrInstallRules, "component listed more than once in install order: "+slug)
+		}
+
+		seen[slug] = true
+	}
+
+	for _, req := range r.Requires {
+		if req == nil || req.Component == "" || req.RequiredComponent == "" || req.MinVersion == "" {
+			return errors.Wrap(ErrInstallRules, "install requirement expects a component, required_component and min_version")
+		}
+
+		if strings.EqualFold(req.Component, req.RequiredComponent) {
+			return errors.Wrap(ErrInstallRules, "component install requires itself: "+req.String())
+		}
+	}
+
+	return nil
+}
+
+// Applies returns true when the install rules apply to servers of the vendor and model.
+func (r *InstallRules) Applies(vendor, model string) bool {
+	if r.Vendor != "" && !strings.EqualFold(r.Vendor, vendor) {
+		return false
+	}
+
+	if len(r.Models) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(r.Models, func(m string) bool {
+		return strings.EqualFold(m, model)
+	})
+}
+
+// MergeInstallRules returns the install rules applicable to servers of the vendor and model,
+// the install order is taken from the last rules listing an order and the requirements are combined.
+func MergeInstallRules(vendor, model string, rules ...*InstallRules) *InstallRules {
+	merged := &InstallRules{}
+
+	for _, r := range rules {
+		if r == nil || !r.Applies(vendor, model) {
+			continue
+		}
+
+		if len(r.Order) > 0 {
+			merged.Order = r.Order
+		}
+
+		merged.Requires = append(merged.Requires, r.Requires...)
+	}
+
+	return merged
+}
+
+// Rank returns the install rank of the component, firmware is installed in the increasing order of the rank.
+//
+// Components listed in the install order are ranked before the rest of the components, which are ranked by FirmwareInstallOrder.
+func (r *InstallRules) Rank(component string) int {
+	slug := strings.ToLower(component)
+
+	if r == nil {
+		return FirmwareInstallOrder[slug]
+	}
+
+	for idx, c := range r.Order {
+		if strings.EqualFold(strings.TrimSpace(c), slug) {
+			return idx
+		}
+	}
+
+	return len(r.Order) + FirmwareInstallOrder[slug]
+}
+
+// Ordered returns true when the component is listed in the install order or the default FirmwareInstallOrder.
+func (r *InstallRules) Ordered(component string) bool {
+	slug := strings.ToLower(component)
+
+	if _, exists := FirmwareInstallOrder[slug]; exists {
+		return true
+	}
+
+	if r == nil {
+		return false
+	}
+
+	return slices.ContainsFunc(r.Order, func(c string) bool {
+		return strings.EqualFold(strings.TrimSpace(c), slug)
+	})
+}
+
+// RequirementsFor returns the install requirements of the component.
+func (r *InstallRules) RequirementsFor(component string) []*InstallRequirement {
+	if r == nil {
+		return nil
+	}
+
+	var found []*InstallRequirement
+	for _, req := range r.Requires {
+		if strings.EqualFold(req.Component, component) {
+			found = append(found, req)
+		}
+	}
+
+	return found
+}
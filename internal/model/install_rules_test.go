@@ -0,0 +1,95 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstallRulesValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       *InstallRules
+		expectedErr string
+	}{
+		{
+			name: "valid",
+			rules: &InstallRules{
+				Order:    []string{"bios", "bmc"},
+				Requires: []*InstallRequirement{{Component: "cpld", RequiredComponent: "bios", MinVersion: "2.1"}},
+			},
+		},
+		{
+			name:        "component listed twice",
+			rules:       &InstallRules{Order: []string{"bios", "BIOS"}},
+			expectedErr: "component listed more than once in install order: bios",
+		},
+		{
+			name:        "incomplete requirement",
+			rules:       &InstallRules{Requires: []*InstallRequirement{{Component: "cpld", RequiredComponent: "bios"}}},
+			expectedErr: "install requirement expects a component, required_component and min_version",
+		},
+		{
+			name:        "component requires itself",
+			rules:       &InstallRules{Requires: []*InstallRequirement{{Component: "bios", RequiredComponent: "bios", MinVersion: "2.1"}}},
+			expectedErr: "component install requires itself: bios requires bios at version >= 2.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rules.Validate()
+			if tt.expectedErr != "" {
+				assert.ErrorIs(t, err, ErrInstallRules)
+				assert.ErrorContains(t, err, tt.expectedErr)
+
+				return
+			}
+
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestMergeInstallRules(t *testing.T) {
+	configured := []*InstallRules{
+		{
+			Vendor: "supermicro",
+			Order:  []string{"bios", "bmc"},
+		},
+		{
+			Vendor:   "supermicro",
+			Models:   []string{"X11DPH-T"},
+			Requires: []*InstallRequirement{{Component: "cpld", RequiredComponent: "bios", MinVersion: "3.5"}},
+		},
+		{
+			Vendor: "dell",
+			Order:  []string{"drive"},
+		},
+	}
+
+	rules := MergeInstallRules("supermicro", "x11dph-t", configured...)
+	assert.Equal(t, []string{"bios", "bmc"}, rules.Order)
+	assert.Len(t, rules.RequirementsFor("CPLD"), 1)
+
+	// components listed in the order are ranked first, the rest follow in the default install order
+	assert.Equal(t, 0, rules.Rank("bios"))
+	assert.Equal(t, 1, rules.Rank("bmc"))
+	assert.Equal(t, 2+FirmwareInstallOrder["cpld"], rules.Rank("cpld"))
+	assert.Less(t, rules.Rank("drive"), rules.Rank("nic"))
+
+	// the firmware set order takes precedence
+	rules = MergeInstallRules("supermicro", "x11dph-t", append(configured, &InstallRules{Order: []string{"nic"}})...)
+	assert.Equal(t, []string{"nic"}, rules.Order)
+
+	// rules for other models are not applied
+	rules = MergeInstallRules("supermicro", "x12dpt-b6", configured...)
+	assert.Empty(t, rules.RequirementsFor("cpld"))
+
+	// without rules, the default install order applies
+	var none *InstallRules
+	assert.Equal(t, FirmwareInstallOrder["nic"], none.Rank("NIC"))
+	assert.True(t, none.Ordered("NIC"))
+	assert.False(t, none.Ordered("retimer"))
+	assert.True(t, (&InstallRules{Order: []string{"Retimer"}}).Ordered("retimer"))
+}
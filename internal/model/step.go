@@ -15,6 +15,12 @@ const (
 var (
 	ErrInstalledFirmwareEqual = errors.New("installed and expected firmware are equal, no action necessary")
 	ErrHostPowerCycleRequired = errors.New("host powercycle required")
+
+	// ErrConditionCancelled is the cause set on the handler context when a cancel request for the condition is received.
+	ErrConditionCancelled = errors.New("cancelled by operator")
+
+	// ErrInstallVerification is returned when the firmware installed on the component could not be verified to equal the expected firmware.
+	ErrInstallVerification = errors.New("installed firmware verification failed")
 )
 
 // A Task comprises of Action(s) for each firmware to be installed,
@@ -2,8 +2,10 @@ package service
 
 import (
 	"context"
+	"os"
 
 	"github.com/metal-automata/agent/internal/ctrl"
+	"github.com/metal-automata/agent/internal/device"
 	"github.com/metal-automata/agent/internal/firmware"
 	"github.com/metal-automata/agent/internal/model"
 	"github.com/metal-automata/agent/internal/store"
@@ -16,21 +18,32 @@ import (
 
 // implements the controller.TaskHandler interface
 type InbandConditionTaskHandler struct {
-	store          store.Repository
-	logger         *logrus.Logger
-	facilityCode   string
-	dryrun         bool
-	faultInjection bool
+	store store.Repository
+	// firmwareOptions are the parameters passed to the firmware install handler
+	firmwareOptions []firmware.Option
+	logger          *logrus.Logger
+	facilityCode    string
+	dryrun          bool
+	faultInjection  bool
 }
 
 // RunInband initializes the inband agent
+//
+// In the daemon mode the agent keeps running to handle successive conditions,
+// otherwise it returns once a condition is handled.
+//
+// When a condition requires the host to be power cycled, the task state is published by the task runner
+// and the reboot is handed off to the reboot coordinator once the task handler returns.
 func RunInband(
 	ctx context.Context,
 	dryrun,
-	faultInjection bool,
+	faultInjection,
+	daemon bool,
 	facilityCode string,
 	repository store.Repository,
+	firmwareOptions []firmware.Option,
 	nc *ctrl.HTTPController,
+	rebooter device.RebootCoordinator,
 	logger *logrus.Logger,
 ) {
 	ctx, span := otel.Tracer(pkgName).Start(
@@ -47,22 +60,54 @@ func RunInband(
 			"branch":         v.GitBranch,
 			"dry-run":        dryrun,
 			"faultInjection": faultInjection,
+			"daemon":         daemon,
+			"reboot":         rebooter.Kind(),
 		},
 	).Info("Inband agent running")
 
 	inbHandler := InbandConditionTaskHandler{
-		store:          repository,
-		logger:         logger,
-		dryrun:         dryrun,
-		faultInjection: faultInjection,
-		facilityCode:   facilityCode,
+		store:           repository,
+		firmwareOptions: firmwareOptions,
+		logger:          logger,
+		dryrun:          dryrun,
+		faultInjection:  faultInjection,
+		facilityCode:    facilityCode,
 	}
 
-	if err := nc.Run(ctx, &inbHandler); err != nil {
+	run := nc.Run
+	if daemon {
+		run = nc.RunDaemon
+	}
+
+	if err := run(ctx, &inbHandler); err != nil {
+		if errors.Is(err, model.ErrHostPowerCycleRequired) {
+			rebootHost(ctx, rebooter, logger)
+
+			// the daemon is stopped by the host shutdown
+			if daemon {
+				<-ctx.Done()
+			}
+
+			return
+		}
+
 		logger.Fatal(err)
 	}
 }
 
+// rebootHost flushes the logs and hands off the host reboot to the reboot coordinator.
+func rebootHost(ctx context.Context, rebooter device.RebootCoordinator, logger *logrus.Logger) {
+	logger.WithField("reboot", rebooter.Kind()).Info("host powercycle required to proceed, rebooting host")
+
+	if f, ok := logger.Out.(*os.File); ok {
+		_ = f.Sync()
+	}
+
+	if err := rebooter.Reboot(ctx); err != nil {
+		logger.WithError(err).Fatal("host reboot failed")
+	}
+}
+
 // Handle implements the ctrl.ConditionHandler interface
 func (h *InbandConditionTaskHandler) HandleTask(
 	ctx context.Context,
@@ -80,6 +125,7 @@ func (h *InbandConditionTaskHandler) HandleTask(
 			"",
 			h.store,
 			publisher,
+			h.firmwareOptions...,
 		)
 
 		return fwHandler.Run(ctx, genericTask, h.logger)
@@ -23,13 +23,15 @@ const (
 )
 
 type OobConditionTaskHandler struct {
-	store          store.Repository
-	syncWG         *sync.WaitGroup
-	logger         *logrus.Logger
-	facilityCode   string
-	controllerID   string
-	dryrun         bool
-	faultInjection bool
+	store store.Repository
+	// firmwareOptions are the parameters passed to the firmware install handler
+	firmwareOptions []firmware.Option
+	syncWG          *sync.WaitGroup
+	logger          *logrus.Logger
+	facilityCode    string
+	controllerID    string
+	dryrun          bool
+	faultInjection  bool
 }
 
 // RunOutofband initializes the Out of band Condition handler and listens for events
@@ -38,6 +40,7 @@ func RunOutofband(
 	dryrun,
 	faultInjection bool,
 	repository store.Repository,
+	firmwareOptions []firmware.Option,
 	nc *ctrl.NatsController,
 	logger *logrus.Logger,
 ) {
@@ -60,13 +63,14 @@ func RunOutofband(
 
 	handlerFactory := func() ctrl.TaskHandler {
 		return &OobConditionTaskHandler{
-			store:          repository,
-			syncWG:         &sync.WaitGroup{},
-			logger:         logger,
-			dryrun:         dryrun,
-			faultInjection: faultInjection,
-			facilityCode:   nc.FacilityCode(),
-			controllerID:   nc.ID(),
+			store:           repository,
+			firmwareOptions: firmwareOptions,
+			syncWG:          &sync.WaitGroup{},
+			logger:          logger,
+			dryrun:          dryrun,
+			faultInjection:  faultInjection,
+			facilityCode:    nc.FacilityCode(),
+			controllerID:    nc.ID(),
 		}
 	}
 
@@ -99,6 +103,7 @@ func (h *OobConditionTaskHandler) HandleTask(
 			h.controllerID,
 			h.store,
 			publisher,
+			h.firmwareOptions...,
 		)
 
 		if err := fwHandler.Run(ctx, genericTask, h.logger); err != nil {
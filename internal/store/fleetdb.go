@@ -2,8 +2,10 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
@@ -62,6 +64,9 @@ var (
 	ErrServerserviceQuery = errors.New("fleetdb API query returned error")
 
 	ErrFirmwareSetLookup = errors.New("firmware set error")
+
+	// ErrFirmwareNotFound is returned when no firmware matches the firmware lookup.
+	ErrFirmwareNotFound = errors.New("firmware not found")
 )
 
 type FleetDBAPI struct {
@@ -234,6 +239,34 @@ func (s *FleetDBAPI) FirmwareSetByID(ctx context.Context, id uuid.UUID) ([]*rcty
 	return intoFirmwaresSlice(firmwareset.ComponentFirmware), nil
 }
 
+// FirmwareSetInstallRules returns the firmware install rules listed in the attributes of the firmware set identified by the given id.
+func (s *FleetDBAPI) FirmwareSetInstallRules(ctx context.Context, id uuid.UUID) (*model.InstallRules, error) {
+	ctx, span := otel.Tracer(pkgName).Start(ctx, "FleetDBAPI.FirmwareSetInstallRules")
+	defer span.End()
+
+	firmwareset, _, err := s.client.GetServerComponentFirmwareSet(ctx, id)
+	if err != nil {
+		s.registerErrorMetric("GetFirmwareSet")
+
+		return nil, errors.Wrap(ErrServerserviceQuery, "GetFirmwareSet: "+err.Error())
+	}
+
+	for _, attr := range firmwareset.Attributes {
+		if attr.Namespace != model.FirmwareSetInstallRulesNS {
+			continue
+		}
+
+		rules := &model.InstallRules{}
+		if err := json.Unmarshal(attr.Data, rules); err != nil {
+			return nil, errors.Wrap(ErrFirmwareSetLookup, "invalid install rules attribute: "+err.Error())
+		}
+
+		return rules, nil
+	}
+
+	return nil, nil // nolint:nilnil // install rules for a firmware set are optional
+}
+
 // FirmwareByDeviceVendorModel returns the firmware for the device vendor, model.
 func (s *FleetDBAPI) FirmwareByDeviceVendorModel(ctx context.Context, deviceVendor, deviceModel string) ([]*rctypes.Firmware, error) {
 	// lookup agent task attribute
@@ -302,6 +335,48 @@ func (s *FleetDBAPI) FirmwareByDeviceVendorModel(ctx context.Context, deviceVend
 	return found, nil
 }
 
+// FirmwareByComponentVersion returns the firmware of the vendor component at the version, applicable to any of the models.
+func (s *FleetDBAPI) FirmwareByComponentVersion(ctx context.Context, vendor, component, version string, models []string) (*rctypes.Firmware, error) {
+	ctx, span := otel.Tracer(pkgName).Start(ctx, "FleetDBAPI.FirmwareByComponentVersion")
+	defer span.End()
+
+	params := &fleetdbapi.ComponentFirmwareVersionListParams{
+		Vendor:    vendor,
+		Component: component,
+		Version:   version,
+	}
+
+	found, _, err := s.client.ListServerComponentFirmware(ctx, params)
+	if err != nil {
+		s.registerErrorMetric("ListServerComponentFirmware")
+
+		return nil, errors.Wrap(ErrServerserviceQuery, "ListServerComponentFirmware: "+err.Error())
+	}
+
+	return firmwareForModels(intoFirmwaresSlice(found), vendor, component, version, models)
+}
+
+// firmwareForModels returns the first firmware applicable to any of the models,
+// firmware without models listed applies to all models.
+func firmwareForModels(firmwares []*rctypes.Firmware, vendor, component, version string, models []string) (*rctypes.Firmware, error) {
+	for _, fw := range firmwares {
+		if len(models) == 0 || len(fw.Models) == 0 {
+			return fw, nil
+		}
+
+		for _, m := range models {
+			if slices.ContainsFunc(fw.Models, func(fm string) bool { return strings.EqualFold(fm, m) }) {
+				return fw, nil
+			}
+		}
+	}
+
+	return nil, errors.Wrap(
+		ErrFirmwareNotFound,
+		fmt.Sprintf("vendor: %s, component: %s, version: %s, models: %s", vendor, component, version, strings.Join(models, ",")),
+	)
+}
+
 func intoFirmwaresSlice(componentFirmware []fleetdbapi.ComponentFirmwareVersion) []*rctypes.Firmware {
 	strSliceToLower := func(sl []string) []string {
 		lowered := make([]string, 0, len(sl))
@@ -405,6 +480,17 @@ func (s *FleetDBAPI) createServerComponentTypes(ctx context.Context) error {
 	return nil
 }
 
+// Ping queries the fleetdb API for a single credential type to verify it is reachable and the client is authorized.
+func (s *FleetDBAPI) Ping(ctx context.Context) error {
+	if _, _, err := s.client.ListServerCredentialTypes(ctx, &fleetdbapi.PaginationParams{Limit: 1}); err != nil {
+		s.registerErrorMetric("Ping")
+
+		return errors.Wrap(ErrServerserviceQuery, "Ping: "+err.Error())
+	}
+
+	return nil
+}
+
 func (s *FleetDBAPI) listServerComponentTypes(ctx context.Context) (fleetdbapi.ServerComponentTypeSlice, error) {
 	existing, _, err := s.client.ListServerComponentTypes(ctx, nil)
 	if err != nil {
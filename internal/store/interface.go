@@ -15,9 +15,15 @@ type Repository interface {
 
 	FirmwareSetByID(ctx context.Context, id uuid.UUID) ([]*rctypes.Firmware, error)
 
+	// FirmwareSetInstallRules returns the firmware install rules listed for the firmware set, nil is returned when none are listed.
+	FirmwareSetInstallRules(ctx context.Context, id uuid.UUID) (*model.InstallRules, error)
+
 	// FirmwareByDeviceVendorModel returns the firmware for the device vendor, model.
 	FirmwareByDeviceVendorModel(ctx context.Context, deviceVendor, deviceModel string) ([]*rctypes.Firmware, error)
 
+	// FirmwareByComponentVersion returns the firmware of the vendor component at the version, applicable to any of the models.
+	FirmwareByComponentVersion(ctx context.Context, vendor, component, version string, models []string) (*rctypes.Firmware, error)
+
 	// Converts from the common.Device to the fleetdbapi.Server type
 	//
 	// checkComponentSlug when set will cause the convertor to verify the components are of a valid ComponentSlugType in fleetdbapi
@@ -26,4 +32,7 @@ type Repository interface {
 
 	// Initialize or update component inventory
 	SetComponentInventory(ctx context.Context, serverID uuid.UUID, device *common.Device, method model.CollectionMethod) error
+
+	// Ping returns an error when the store is not reachable.
+	Ping(ctx context.Context) error
 }
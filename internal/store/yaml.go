@@ -0,0 +1,389 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmc-toolbox/common"
+	"github.com/ghodss/yaml"
+	"github.com/google/uuid"
+	"github.com/metal-automata/agent/internal/app"
+	"github.com/metal-automata/agent/internal/metrics"
+	"github.com/metal-automata/agent/internal/model"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+
+	rctypes "github.com/metal-automata/rivets/condition"
+)
+
+var (
+	ErrYamlStore      = errors.New("yaml inventory store error")
+	ErrAssetNotFound  = errors.New("asset not found in inventory store")
+	ErrYamlStoreWrite = errors.New("error writing yaml inventory store")
+)
+
+// Yaml is a file backed inventory store.
+//
+// The inventory file is read on each query so that operators can edit it while the agent is running,
+// component inventory updates are written back to the same file.
+type Yaml struct {
+	config *app.YamlStoreOptions
+	logger *logrus.Logger
+	// mu serializes read-modify-write cycles on the inventory file.
+	mu sync.Mutex
+}
+
+// yamlInventory is the on disk representation of the inventory file.
+//
+// The fields are (un)marshalled through their JSON tags, and so the keys in the file
+// match the keys of the corresponding fleetdb API objects.
+type yamlInventory struct {
+	Servers      []*rctypes.Server  `json:"servers"`
+	FirmwareSets []*yamlFirmwareSet `json:"firmware_sets,omitempty"`
+}
+
+// yamlFirmwareSet is a list of firmware applicable to a server vendor, model.
+type yamlFirmwareSet struct {
+	ID        uuid.UUID           `json:"id"`
+	Name      string              `json:"name"`
+	Vendor    string              `json:"vendor"`
+	Model     string              `json:"model"`
+	Firmwares []*rctypes.Firmware `json:"firmwares"`
+	// InstallRules are the firmware install ordering and dependency rules for the firmware set.
+	InstallRules *model.InstallRules `json:"install_rules,omitempty"`
+}
+
+// NewYamlStore returns a Repository backed by the inventory file configured in YamlStoreOptions.
+func NewYamlStore(_ context.Context, config *app.YamlStoreOptions, logger *logrus.Logger) (Repository, error) {
+	if config == nil || config.InventoryFile == "" {
+		return nil, errors.Wrap(ErrYamlStore, "expected an inventory file parameter")
+	}
+
+	s := &Yaml{
+		config: config,
+		logger: logger,
+	}
+
+	// validate the inventory file is readable
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Yaml) registerErrorMetric(queryKind string) {
+	metrics.StoreQueryErrorCount.With(
+		prometheus.Labels{
+			"storeKind": string(model.InventoryStoreYAML),
+			"queryKind": queryKind,
+		},
+	).Inc()
+}
+
+func (s *Yaml) load() (*yamlInventory, error) {
+	b, err := os.ReadFile(s.config.InventoryFile)
+	if err != nil {
+		return nil, errors.Wrap(ErrYamlStore, err.Error())
+	}
+
+	inv := &yamlInventory{}
+	if err := yaml.Unmarshal(b, inv); err != nil {
+		return nil, errors.Wrap(ErrYamlStore, "inventory file unmarshal error: "+err.Error())
+	}
+
+	return inv, nil
+}
+
+// save writes the inventory to a temporary file which is then renamed over the inventory file,
+// this ensures a crash while writing does not leave behind a truncated inventory file.
+func (s *Yaml) save(inv *yamlInventory) error {
+	b, err := yaml.Marshal(inv)
+	if err != nil {
+		return errors.Wrap(ErrYamlStoreWrite, err.Error())
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.config.InventoryFile), ".inventory-*.yaml")
+	if err != nil {
+		return errors.Wrap(ErrYamlStoreWrite, err.Error())
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return errors.Wrap(ErrYamlStoreWrite, err.Error())
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(ErrYamlStoreWrite, err.Error())
+	}
+
+	if err := os.Rename(tmp.Name(), s.config.InventoryFile); err != nil {
+		return errors.Wrap(ErrYamlStoreWrite, err.Error())
+	}
+
+	return nil
+}
+
+func (inv *yamlInventory) serverByID(id uuid.UUID) *rctypes.Server {
+	for _, server := range inv.Servers {
+		if server.UUID == id {
+			return server
+		}
+	}
+
+	return nil
+}
+
+// Ping verifies the inventory file is readable.
+func (s *Yaml) Ping(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.load(); err != nil {
+		s.registerErrorMetric("Ping")
+		return err
+	}
+
+	return nil
+}
+
+// AssetByID returns the server along with its BMC credentials.
+func (s *Yaml) AssetByID(ctx context.Context, id string) (*rctypes.Server, error) {
+	_, span := otel.Tracer(pkgName).Start(ctx, "Yaml.AssetByID")
+	defer span.End()
+
+	deviceUUID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.Wrap(ErrDeviceID, err.Error()+id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, err := s.load()
+	if err != nil {
+		s.registerErrorMetric("AssetByID")
+		return nil, err
+	}
+
+	server := inv.serverByID(deviceUUID)
+	if server == nil {
+		s.registerErrorMetric("AssetByID")
+		return nil, errors.Wrap(ErrAssetNotFound, id)
+	}
+
+	if server.BMC == nil || server.BMC.IPAddress == "" {
+		return nil, errors.Wrap(ErrBMCAddress, "no BMC address defined for server: "+id)
+	}
+
+	return server, nil
+}
+
+// FirmwareSetByID returns a list of firmwares part of a firmware set identified by the given id.
+func (s *Yaml) FirmwareSetByID(ctx context.Context, id uuid.UUID) ([]*rctypes.Firmware, error) {
+	_, span := otel.Tracer(pkgName).Start(ctx, "Yaml.FirmwareSetByID")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, err := s.load()
+	if err != nil {
+		s.registerErrorMetric("FirmwareSetByID")
+		return nil, err
+	}
+
+	for _, set := range inv.FirmwareSets {
+		if set.ID == id {
+			return normalizeFirmwares(set.Firmwares), nil
+		}
+	}
+
+	return nil, errors.Wrap(ErrFirmwareSetLookup, "no firmware set found by id: "+id.String())
+}
+
+// FirmwareSetInstallRules returns the firmware install rules listed for the firmware set identified by the given id.
+func (s *Yaml) FirmwareSetInstallRules(ctx context.Context, id uuid.UUID) (*model.InstallRules, error) {
+	_, span := otel.Tracer(pkgName).Start(ctx, "Yaml.FirmwareSetInstallRules")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, err := s.load()
+	if err != nil {
+		s.registerErrorMetric("FirmwareSetInstallRules")
+		return nil, err
+	}
+
+	for _, set := range inv.FirmwareSets {
+		if set.ID == id {
+			return set.InstallRules, nil
+		}
+	}
+
+	return nil, errors.Wrap(ErrFirmwareSetLookup, "no firmware set found by id: "+id.String())
+}
+
+// FirmwareByDeviceVendorModel returns the firmware for the device vendor, model.
+func (s *Yaml) FirmwareByDeviceVendorModel(ctx context.Context, deviceVendor, deviceModel string) ([]*rctypes.Firmware, error) {
+	_, span := otel.Tracer(pkgName).Start(ctx, "Yaml.FirmwareByDeviceVendorModel")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, err := s.load()
+	if err != nil {
+		s.registerErrorMetric("FirmwareByDeviceVendorModel")
+		return nil, err
+	}
+
+	found := []*yamlFirmwareSet{}
+	for _, set := range inv.FirmwareSets {
+		if strings.EqualFold(set.Vendor, deviceVendor) && strings.EqualFold(set.Model, deviceModel) {
+			found = append(found, set)
+		}
+	}
+
+	switch {
+	case len(found) == 0:
+		return nil, errors.Wrap(
+			ErrFirmwareSetLookup,
+			fmt.Sprintf("lookup by device vendor: %s, model: %s returned no firmware set", deviceVendor, deviceModel),
+		)
+	case len(found) > 1:
+		return nil, errors.Wrap(
+			ErrFirmwareSetLookup,
+			fmt.Sprintf("lookup by device vendor: %s, model: %s returned multiple firmware sets, expected one", deviceVendor, deviceModel),
+		)
+	case len(found[0].Firmwares) == 0:
+		return nil, errors.Wrap(
+			ErrFirmwareSetLookup,
+			fmt.Sprintf("lookup by device vendor: %s, model: %s returned firmware set with no component firmware", deviceVendor, deviceModel),
+		)
+	}
+
+	return normalizeFirmwares(found[0].Firmwares), nil
+}
+
+// FirmwareByComponentVersion returns the firmware of the vendor component at the version listed in any firmware set,
+// applicable to any of the models.
+func (s *Yaml) FirmwareByComponentVersion(ctx context.Context, vendor, component, version string, models []string) (*rctypes.Firmware, error) {
+	_, span := otel.Tracer(pkgName).Start(ctx, "Yaml.FirmwareByComponentVersion")
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, err := s.load()
+	if err != nil {
+		s.registerErrorMetric("FirmwareByComponentVersion")
+		return nil, err
+	}
+
+	found := []*rctypes.Firmware{}
+	for _, set := range inv.FirmwareSets {
+		for _, fw := range normalizeFirmwares(set.Firmwares) {
+			if strings.EqualFold(fw.Vendor, vendor) && strings.EqualFold(fw.Component, component) &&
+				strings.TrimSpace(fw.Version) == strings.TrimSpace(version) {
+				found = append(found, fw)
+			}
+		}
+	}
+
+	return firmwareForModels(found, vendor, component, version, models)
+}
+
+// normalizeFirmwares returns a copy of the firmware records with the vendor, model and component fields lowercased,
+// this matches the records returned by the fleetdb API store.
+func normalizeFirmwares(firmwares []*rctypes.Firmware) []*rctypes.Firmware {
+	normalized := make([]*rctypes.Firmware, 0, len(firmwares))
+
+	for _, firmware := range firmwares {
+		fw := *firmware
+		fw.Vendor = strings.ToLower(fw.Vendor)
+		fw.Component = strings.ToLower(fw.Component)
+
+		fw.Models = make([]string, 0, len(firmware.Models))
+		for _, m := range firmware.Models {
+			fw.Models = append(fw.Models, strings.ToLower(m))
+		}
+
+		normalized = append(normalized, &fw)
+	}
+
+	return normalized
+}
+
+// ConvertCommonDevice converts the common.Device to the fleetdbapi.Server type.
+//
+// The yaml store does not maintain a list of component slugs and so checkComponentSlug is not applicable.
+func (s *Yaml) ConvertCommonDevice(serverID uuid.UUID, hw *common.Device, collectionMethod model.CollectionMethod, _ bool) (*rctypes.Server, error) {
+	return ConvertCommonDeviceNoSlugValidate(serverID, hw, collectionMethod)
+}
+
+// SetComponentInventory replaces the component inventory of the server and writes it back to the inventory file.
+func (s *Yaml) SetComponentInventory(ctx context.Context, serverID uuid.UUID, device *common.Device, method model.CollectionMethod) error {
+	_, span := otel.Tracer(pkgName).Start(ctx, "Yaml.SetComponentInventory")
+	defer span.End()
+
+	newInventory, err := s.ConvertCommonDevice(serverID, device, method, false)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, err := s.load()
+	if err != nil {
+		s.registerErrorMetric("SetComponentInventory")
+		return err
+	}
+
+	server := inv.serverByID(serverID)
+	if server == nil {
+		s.registerErrorMetric("SetComponentInventory")
+		return errors.Wrap(ErrAssetNotFound, serverID.String())
+	}
+
+	if server.Vendor == "" {
+		server.Vendor = newInventory.Vendor
+	}
+
+	if server.Model == "" {
+		server.Model = newInventory.Model
+	}
+
+	if server.Serial == "" {
+		server.Serial = newInventory.Serial
+	}
+
+	server.Components = newInventory.Components
+	server.InventoryRefreshedAt = time.Now()
+
+	if err := s.save(inv); err != nil {
+		s.registerErrorMetric("SetComponentInventory")
+		return err
+	}
+
+	s.logger.WithFields(
+		logrus.Fields{
+			"Server":     serverID.String(),
+			"components": len(newInventory.Components),
+			"file":       s.config.InventoryFile,
+		},
+	).Info("Component inventory written")
+
+	return nil
+}
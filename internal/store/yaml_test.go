@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bmc-toolbox/common"
+	"github.com/google/uuid"
+	"github.com/metal-automata/agent/internal/app"
+	"github.com/metal-automata/agent/internal/model"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testInventory = `
+servers:
+  - uuid: fa125199-e9dd-47d4-8667-ce1d26f58c4a
+    vendor: dell
+    model: r6515
+    bmc:
+      ipaddress: 127.0.0.1
+      username: foo
+      password: bar
+  - uuid: 8ee5f0a3-5b5b-4d0e-a0c5-f5b1bca3c3d8
+firmware_sets:
+  - id: 9d70c28c-5f65-4088-b014-205c54ad4ac7
+    vendor: Dell
+    model: R6515
+    firmwares:
+      - vendor: Dell
+        component: BIOS
+        version: 2.6.6
+        filename: BIOS_C4FT0_WN64_2.6.6.EXE
+        URL: https://dl.dell.com/FOLDER08105057M/1/BIOS_C4FT0_WN64_2.6.6.EXE
+        models:
+          - R6515
+    install_rules:
+      order: [bios, bmc]
+      requires:
+        - component: cpld
+          required_component: bios
+          min_version: 2.6.0
+  - id: 3a1b5e6c-4d2b-4c9e-8a55-2f3f54c1f0a2
+    vendor: supermicro
+    model: x11dph-t
+    firmwares: []
+`
+
+func newTestYamlStore(t *testing.T) (Repository, string) {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "inventory.yaml")
+	require.Nil(t, os.WriteFile(file, []byte(testInventory), 0o600))
+
+	s, err := NewYamlStore(context.Background(), &app.YamlStoreOptions{InventoryFile: file}, logrus.New())
+	require.Nil(t, err)
+
+	return s, file
+}
+
+func TestYamlStoreAssetByID(t *testing.T) {
+	s, _ := newTestYamlStore(t)
+
+	server, err := s.AssetByID(context.Background(), "fa125199-e9dd-47d4-8667-ce1d26f58c4a")
+	require.Nil(t, err)
+	assert.Equal(t, "127.0.0.1", server.BMC.IPAddress)
+	assert.Equal(t, "foo", server.BMC.Username)
+	assert.Equal(t, "bar", server.BMC.Password)
+
+	_, err = s.AssetByID(context.Background(), uuid.NewString())
+	assert.ErrorIs(t, err, ErrAssetNotFound)
+
+	// server without BMC attributes
+	_, err = s.AssetByID(context.Background(), "8ee5f0a3-5b5b-4d0e-a0c5-f5b1bca3c3d8")
+	assert.ErrorIs(t, err, ErrBMCAddress)
+
+	_, err = s.AssetByID(context.Background(), "foo")
+	assert.ErrorIs(t, err, ErrDeviceID)
+}
+
+func TestYamlStoreFirmwareLookup(t *testing.T) {
+	s, _ := newTestYamlStore(t)
+
+	firmwares, err := s.FirmwareSetByID(context.Background(), uuid.MustParse("9d70c28c-5f65-4088-b014-205c54ad4ac7"))
+	require.Nil(t, err)
+	require.Len(t, firmwares, 1)
+	assert.Equal(t, "bios", firmwares[0].Component)
+	assert.Equal(t, "dell", firmwares[0].Vendor)
+	assert.Equal(t, []string{"r6515"}, firmwares[0].Models)
+
+	_, err = s.FirmwareSetByID(context.Background(), uuid.New())
+	assert.ErrorIs(t, err, ErrFirmwareSetLookup)
+
+	firmwares, err = s.FirmwareByDeviceVendorModel(context.Background(), "dell", "r6515")
+	require.Nil(t, err)
+	assert.Len(t, firmwares, 1)
+
+	_, err = s.FirmwareByDeviceVendorModel(context.Background(), "supermicro", "x11dph-t")
+	assert.ErrorIs(t, err, ErrFirmwareSetLookup)
+
+	_, err = s.FirmwareByDeviceVendorModel(context.Background(), "asrockrack", "e3c246d4i-nl")
+	assert.ErrorIs(t, err, ErrFirmwareSetLookup)
+}
+
+func TestYamlStoreFirmwareByComponentVersion(t *testing.T) {
+	s, _ := newTestYamlStore(t)
+
+	fw, err := s.FirmwareByComponentVersion(context.Background(), "dell", "bios", "2.6.6", []string{"r6515"})
+	require.Nil(t, err)
+	assert.Equal(t, "BIOS_C4FT0_WN64_2.6.6.EXE", fw.FileName)
+	assert.Equal(t, "bios", fw.Component)
+
+	_, err = s.FirmwareByComponentVersion(context.Background(), "dell", "bios", "2.6.6", []string{"r750"})
+	assert.ErrorIs(t, err, ErrFirmwareNotFound)
+
+	_, err = s.FirmwareByComponentVersion(context.Background(), "dell", "bios", "2.5.0", nil)
+	assert.ErrorIs(t, err, ErrFirmwareNotFound)
+}
+
+func TestYamlStoreFirmwareSetInstallRules(t *testing.T) {
+	s, _ := newTestYamlStore(t)
+
+	rules, err := s.FirmwareSetInstallRules(context.Background(), uuid.MustParse("9d70c28c-5f65-4088-b014-205c54ad4ac7"))
+	require.Nil(t, err)
+	require.NotNil(t, rules)
+	assert.Equal(t, []string{"bios", "bmc"}, rules.Order)
+	assert.Equal(t, []*model.InstallRequirement{{Component: "cpld", RequiredComponent: "bios", MinVersion: "2.6.0"}}, rules.Requires)
+
+	// firmware set without install rules
+	rules, err = s.FirmwareSetInstallRules(context.Background(), uuid.MustParse("3a1b5e6c-4d2b-4c9e-8a55-2f3f54c1f0a2"))
+	require.Nil(t, err)
+	assert.Nil(t, rules)
+
+	_, err = s.FirmwareSetInstallRules(context.Background(), uuid.New())
+	assert.ErrorIs(t, err, ErrFirmwareSetLookup)
+}
+
+func TestYamlStoreSetComponentInventory(t *testing.T) {
+	s, file := newTestYamlStore(t)
+
+	serverID := uuid.MustParse("fa125199-e9dd-47d4-8667-ce1d26f58c4a")
+	device := &common.Device{
+		Common: common.Common{Vendor: "dell", Model: "r6515"},
+		BIOS: &common.BIOS{
+			Common: common.Common{Vendor: "dell", Firmware: &common.Firmware{Installed: "2.6.5"}},
+		},
+	}
+
+	err := s.SetComponentInventory(context.Background(), serverID, device, model.InstallMethodOutofband)
+	require.Nil(t, err)
+
+	// reload the store from disk to verify the inventory was persisted
+	reloaded, err := NewYamlStore(context.Background(), &app.YamlStoreOptions{InventoryFile: file}, logrus.New())
+	require.Nil(t, err)
+
+	server, err := reloaded.AssetByID(context.Background(), serverID.String())
+	require.Nil(t, err)
+
+	found := model.FindComponentByNameModel(server.Components, common.SlugBIOS, nil)
+	require.NotNil(t, found)
+	assert.Equal(t, "2.6.5", found.InstalledFirmware.Version)
+	assert.Equal(t, "foo", server.BMC.Username)
+
+	err = s.SetComponentInventory(context.Background(), uuid.New(), device, model.InstallMethodOutofband)
+	assert.ErrorIs(t, err, ErrAssetNotFound)
+}
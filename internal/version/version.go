@@ -44,8 +44,9 @@ func Current() Version {
 	}
 }
 
-func ExportBuildInfoMetric() {
-	buildInfo := promauto.NewGaugeVec(
+// ExportBuildInfoMetric registers the build info metric on the given registerer.
+func ExportBuildInfoMetric(registerer prometheus.Registerer) {
+	buildInfo := promauto.With(registerer).NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "agent_build_info",
 			Help: "A metric with a constant '1' value, labeled by branch, commit, summary, builddate, version, Go version from which Agent was built.",